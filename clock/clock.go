@@ -0,0 +1,125 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package clock abstracts the passing of time, so that time-dependent code
+// can run against the wall clock or a manually advanced one
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+type Clock interface {
+	Now() time.Time
+	// AfterFunc calls f once d has passed
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+type Timer interface {
+	// Stop prevents the timer from firing, it returns false if the timer
+	// already fired or was stopped
+	Stop() bool
+}
+
+type realClock struct{}
+
+// Real is the wall clock
+var Real Clock = realClock{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// Manual only moves forward when told so. Timers fire synchronously in the
+// goroutine advancing the clock, in the order of their deadlines.
+type Manual struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+type manualTimer struct {
+	m        *Manual
+	deadline time.Time
+	f        func()
+}
+
+func NewManual(start time.Time) *Manual {
+	return &Manual{now: start}
+}
+
+func (m *Manual) Now() time.Time {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.now
+}
+
+func (m *Manual) AfterFunc(d time.Duration, f func()) Timer {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	t := &manualTimer{m, m.now.Add(d), f}
+	// keep timers with equal deadlines in the order they were created
+	i := sort.Search(len(m.timers), func(i int) bool {
+		return m.timers[i].deadline.After(t.deadline)
+	})
+	m.timers = append(m.timers, nil)
+	copy(m.timers[i+1:], m.timers[i:])
+	m.timers[i] = t
+	return t
+}
+
+func (t *manualTimer) Stop() bool {
+	t.m.mu.Lock()
+	defer t.m.mu.Unlock()
+	for i, o := range t.m.timers {
+		if o == t {
+			t.m.timers = append(t.m.timers[:i], t.m.timers[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Set moves the clock forward to now, firing all timers that are due on
+// the way. Moving the clock backwards is ignored.
+func (m *Manual) Set(now time.Time) {
+	for {
+		m.mu.Lock()
+		if len(m.timers) == 0 || m.timers[0].deadline.After(now) {
+			if now.After(m.now) {
+				m.now = now
+			}
+			m.mu.Unlock()
+			return
+		}
+		t := m.timers[0]
+		m.timers = m.timers[1:]
+		if t.deadline.After(m.now) {
+			m.now = t.deadline
+		}
+		m.mu.Unlock()
+		t.f()
+	}
+}
+
+// Advance moves the clock forward by d, see Set
+func (m *Manual) Advance(d time.Duration) {
+	m.Set(m.Now().Add(d))
+}
@@ -0,0 +1,69 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManual(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := NewManual(start)
+	var fired []int
+	var at []time.Time
+	timer := func(i int) func() {
+		return func() {
+			fired = append(fired, i)
+			at = append(at, c.Now())
+		}
+	}
+	c.AfterFunc(3*time.Second, timer(3))
+	c.AfterFunc(time.Second, timer(1))
+	stopped := c.AfterFunc(2*time.Second, timer(2))
+	c.AfterFunc(time.Second, func() {
+		// timers scheduled while firing are due relative to their deadline
+		timer(11)()
+		c.AfterFunc(time.Second, timer(12))
+	})
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("expected only the first Stop to succeed")
+	}
+
+	c.Advance(2500 * time.Millisecond)
+	want := []int{1, 11, 12}
+	if len(fired) != len(want) {
+		t.Fatalf("fired %v, want %v", fired, want)
+	}
+	for i := range want {
+		if fired[i] != want[i] {
+			t.Fatalf("fired %v, want %v", fired, want)
+		}
+	}
+	if !at[2].Equal(start.Add(2 * time.Second)) {
+		t.Errorf("timer 12 fired at %s", at[2])
+	}
+	if now := c.Now(); !now.Equal(start.Add(2500 * time.Millisecond)) {
+		t.Errorf("now = %s", now)
+	}
+
+	c.Set(start)
+	if now := c.Now(); !now.Equal(start.Add(2500 * time.Millisecond)) {
+		t.Error("clock moved backwards")
+	}
+	c.Advance(time.Second)
+	if fired[len(fired)-1] != 3 {
+		t.Errorf("fired %v, want 3 last", fired)
+	}
+}
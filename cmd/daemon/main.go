@@ -17,34 +17,100 @@ import (
 	"flag"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"time"
 
 	"runtime/pprof"
 
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/lucas-clemente/quic-go/qlog"
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/history"
+	"github.com/netsys-lab/pan-lua/logger"
 	"github.com/netsys-lab/pan-lua/lua"
+	"github.com/netsys-lab/pan-lua/metrics"
+	"github.com/netsys-lab/pan-lua/probe"
 	"github.com/netsys-lab/pan-lua/rpc"
 	"github.com/netsys-lab/pan-lua/selector"
+	"github.com/netsys-lab/pan-lua/trace"
+	"go.uber.org/zap"
+)
+
+// policyCheckInterval is how often the mandatory path policy file is checked
+// for changes
+const policyCheckInterval = 5 * time.Second
+
+// historySaveInterval is how often the performance history is saved
+const historySaveInterval = time.Minute
+
+// probeTimeout is how long to wait for the answer to a probe, and probeBurst
+// how many probes scripts may send at once
+const (
+	probeTimeout = time.Second
+	probeBurst   = 10
 )
 
 func main() {
 	var (
-		script string
-		cpulog string
-		sel    rpc.ServerSelector
-		err    error
+		script      string
+		backend     string
+		cpulog      string
+		metricsAddr string
+		logCfg      logger.Config
+		logSinks    string
+		traceFile   string
+		traceSize   int64
+		traceFiles  int
+		timeout     time.Duration
+		mwSpec      string
+		policyFile  string
+		decay       time.Duration
+		histFile    string
+		halfLife    time.Duration
+		prober      string
+		probeRate   float64
+		sel         rpc.ServerSelector
+		err         error
 	)
 
 	flag.StringVar(&script, "script", "", "Lua script for path selection")
+	flag.StringVar(&backend, "backend", "lua", "Path selection backend: lua, running -script, or profiles, the built-in capacity profiles")
 	flag.StringVar(&cpulog, "cpulog", "", "Write profiling information to file")
+	flag.StringVar(&metricsAddr, "metrics", "", "Serve Prometheus metrics on this address (e.g. :9273)")
+	flag.StringVar(&logCfg.Level, "log-level", "info", "Log level: debug, info, warn or error")
+	flag.StringVar(&logCfg.Format, "log-format", "text", "Log format: text or json")
+	flag.StringVar(&logSinks, "log", "stderr", "Comma-separated log sinks: stderr, stdout or file names")
+	flag.Int64Var(&logCfg.MaxSize, "log-max-size", 100, "Rotate log files after this many MiB, 0 disables rotation")
+	flag.IntVar(&logCfg.MaxFiles, "log-max-files", 5, "Number of rotated log files to keep")
+	flag.StringVar(&traceFile, "trace", "", "Record all selector and tracer events to this file")
+	flag.Int64Var(&traceSize, "trace-max-size", 100, "Rotate trace files after this many MiB, 0 disables rotation")
+	flag.IntVar(&traceFiles, "trace-max-files", 5, "Number of rotated trace files to keep")
+	flag.DurationVar(&timeout, "script-timeout", 0, "Abort calls into the script that take longer, 0 disables the limit")
+	flag.StringVar(&mwSpec, "middleware", "", "Comma-separated selector middleware, outermost first: log, cache=<duration>, fallback or hysteresis=<dwell>[:<margin>]; cache and hysteresis reduce path sets to a single path")
+	flag.StringVar(&policyFile, "policy", "", "Mandatory path policy for all connections, a JSON file that is reloaded on change")
+	flag.DurationVar(&decay, "interface-decay", time.Minute, "Consider interfaces reported down up again after this long without further reports")
+	flag.StringVar(&histFile, "history", "", "Keep the performance history of paths in this file, otherwise in memory only")
+	flag.DurationVar(&halfLife, "history-half-life", 24*time.Hour, "Time after which the performance history has lost half of its weight")
+	flag.StringVar(&prober, "probe", "", "Let scripts probe paths with panapi.Probe: scmp, with SCMP echo requests, or none")
+	flag.Float64Var(&probeRate, "probe-rate", 10, "Maximum number of probes per second")
 	flag.Parse()
 
+	logCfg.Sinks = strings.Split(logSinks, ",")
+	logCfg.MaxSize <<= 20
+	zl, err := logger.New(logCfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging configuration:", err)
+		os.Exit(2)
+	}
+	logger.SetDefault(zl)
+	log := zl.Named("daemon").Sugar()
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, syscall.SIGTERM, os.Kill, os.Interrupt)
 
@@ -52,7 +118,7 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not start daemon: %s", err)
 	}
-	log.Println("Starting daemon")
+	log.Info("Starting daemon")
 
 	// remove the underlying socket file on close
 	l.SetUnlinkOnClose(true)
@@ -60,29 +126,132 @@ func main() {
 	if cpulog != "" {
 		f, err := os.Create(cpulog)
 		if err != nil {
-			log.Fatal("cpuprofile:", err)
+			log.Fatalf("cpuprofile: %s", err)
 		}
 		if err = pprof.StartCPUProfile(f); err != nil {
-			log.Fatal("cpuprofile:", err)
+			log.Fatalf("cpuprofile: %s", err)
 		}
 	}
 
 	lua_state := lua.NewState()
-	sel = lua.NewSelector(lua_state)
-	stats := lua.NewStats(lua_state)
-	err = lua_state.LoadScript(script)
+	lua_state.SetLogger(zl.Named("lua"))
+	lua_state.SetTimeout(timeout)
+	health := rpc.NewInterfaceHealth(decay, clock.Real)
+	lua_state.SetInterfaceHealth(health)
+	db, err := history.Open(histFile, halfLife, clock.Real)
 	if err != nil {
-		log.Printf("Could not load path-selection script: %s", err)
-		log.Println("Falling back to default selector")
-		sel = rpc.NewServerSelectorFunc(func(pan.UDPAddr, pan.UDPAddr) selector.Selector {
-			return &selector.DefaultSelector{}
-		})
+		log.Fatalf("Could not open performance history: %s", err)
+	}
+	lua_state.SetHistory(db)
+	switch prober {
+	case "", "none":
+	case "scmp":
+		p, err := probe.NewSCMP(probeTimeout)
+		if err != nil {
+			log.Fatalf("Could not set up probing: %s", err)
+		}
+		lua_state.SetProber(probe.Limit(p, probeRate, probeBurst, clock.Real))
+	default:
+		log.Fatalf("Unknown prober %q", prober)
+	}
+	luaSel := lua.NewSelector(lua_state, clock.Real)
+	// the script is told about overrides directly, it is wrapped in middleware
+	// by the time the admin selector sees it
+	var observer rpc.OverrideObserver = luaSel
+	sel = luaSel
+	var stats rpc.ServerConnectionTracer = lua.NewStats(lua_state, clock.Real)
+
+	var m *metrics.Metrics
+	if metricsAddr != "" {
+		// before loading the script, which may define its own metrics
+		m = metrics.New()
+		lua_state.SetCallObserver(m.ObserveLuaCall)
+		lua_state.SetScriptMetrics(m.Script())
+	}
+	reload := lua_state.Reload
+	switch backend {
+	case "lua":
+		err = lua_state.LoadScript(script)
+		if err != nil {
+			log.Errorw("Could not load path-selection script", "script", script, "error", err)
+			log.Warn("Falling back to default selector")
+			sel = rpc.NewServerSelectorFunc(func(pan.UDPAddr, pan.UDPAddr) selector.Selector {
+				return &selector.DefaultSelector{}
+			})
+			reload, observer = nil, nil
+		}
+	case "profiles":
+		log.Info("Selecting paths by capacity profile")
+		profiles := rpc.NewProfileBackend()
+		sel, stats, reload, observer = profiles, profiles.ConnectionTracer(), nil, nil
+	default:
+		log.Fatalf("Unknown backend %q", backend)
+	}
+	// the backend only gets to see the paths complying with the policy of
+	// the connection
+	sel = rpc.PathPolicies(sel)
+
+	var recorder *trace.Writer
+	if traceFile != "" {
+		recorder, err = trace.Create(traceFile, traceSize<<20, traceFiles)
+		if err != nil {
+			log.Fatalf("Could not create trace file: %s", err)
+		}
+		// record what the script sees and decides, before any overrides
+		r := trace.NewRecorder(recorder, clock.Real)
+		sel = r.Selector(sel)
+		stats = r.ConnectionTracer(stats)
+		log.Infow("Recording events", "file", traceFile)
+	}
+	mws, tracers, err := middleware(mwSpec, zl.Named("selector").Sugar())
+	if err != nil {
+		log.Fatalf("Invalid middleware: %s", err)
+	}
+	// after recording, so that the trace shows the choices of the backend
+	sel = rpc.Chain(sel, mws...)
+	for _, t := range tracers {
+		stats = t(stats)
+	}
+	// outside of the recorder, so that replays see the interfaces reported
+	// down on other connections, and of the middleware, so that caches and
+	// hysteresis learn about them too
+	sel = health.Middleware(sel)
+	admin := rpc.NewAdminSelector(sel, reload, observer)
+
+	var (
+		serverSelector rpc.ServerSelector         = admin
+		serverTracer   rpc.ServerConnectionTracer = stats
+	)
+	var policy *rpc.MandatoryPolicy
+	if policyFile != "" {
+		policy, err = rpc.NewMandatoryPolicy(policyFile, clock.Real)
+		if err != nil {
+			log.Fatalf("Could not load mandatory path policy: %s", err)
+		}
+		// outside of the admin selector, so that overrides can not bypass it
+		serverSelector = policy.Middleware(serverSelector)
+		policy.Watch(policyCheckInterval)
+		log.Infow("Enforcing mandatory path policy", "file", policyFile)
+	}
+	// the history needs the paths actually used, after all overrides
+	serverSelector = db.Middleware(serverSelector)
+	serverTracer = db.ConnectionTracer(serverTracer)
+	db.SaveEvery(historySaveInterval, func(err error) {
+		log.Errorw("Could not save performance history", "error", err)
+	})
+	if m != nil {
+		serverSelector = m.Selector(serverSelector)
+		serverTracer = m.ConnectionTracer(serverTracer)
+		go func() {
+			log.Infow("Serving metrics", "address", metricsAddr)
+			log.Error(m.ListenAndServe(metricsAddr))
+		}()
 	}
 
 	tracer := qlog.NewTracer(
 		func(p logging.Perspective, connectionID []byte) io.WriteCloser {
 			fname := fmt.Sprintf("/tmp/quic-tracer-%d-%x.log", p, connectionID)
-			log.Println("quic tracer file opened as", fname)
+			log.Debugw("quic tracer file opened", "file", fname)
 			f, err := os.Create(fname)
 			if err != nil {
 				panic(err)
@@ -90,21 +259,91 @@ func main() {
 			return f
 		})
 	//serverselector := rpc.NewServerSelectorFunc(func(raddr,
-	server, err := rpc.NewServer(sel, tracer, stats)
+	server, err := rpc.NewServer(serverSelector, tracer, serverTracer)
 	if err != nil {
-		log.Fatalln(err)
+		log.Fatal(err)
+	}
+	err = server.Register(rpc.NewAdminServer(admin))
+	if err != nil {
+		log.Fatal(err)
 	}
 	go func() {
-		log.Println("Started listening for rpc calls")
+		log.Info("Started listening for rpc calls")
 		server.Accept(l)
 	}()
 	sig := <-c
-	log.Printf("Got signal [%s]: running defered cleanup and exiting.", sig)
+	log.Infof("Got signal [%s]: running defered cleanup and exiting.", sig)
 	err = l.Close()
 	if err != nil {
-		log.Println(err)
+		log.Error(err)
+	}
+	if policy != nil {
+		policy.Stop()
+	}
+	if err := db.Close(); err != nil {
+		log.Error(err)
+	}
+	if recorder != nil {
+		if err := recorder.Close(); err != nil {
+			log.Error(err)
+		}
 	}
 	//should be NOP if profiler is not running
 	pprof.StopCPUProfile()
+	zl.Sync()
 	os.Exit(0)
 }
+
+// middleware parses the -middleware flag. Some middleware also needs to see
+// the connection tracer calls, it comes with tracers to wrap it in.
+func middleware(spec string, l *zap.SugaredLogger) ([]rpc.Middleware, []func(rpc.ServerConnectionTracer) rpc.ServerConnectionTracer, error) {
+	var (
+		mws     []rpc.Middleware
+		tracers []func(rpc.ServerConnectionTracer) rpc.ServerConnectionTracer
+	)
+	if spec == "" {
+		return mws, tracers, nil
+	}
+	for _, name := range strings.Split(spec, ",") {
+		name, arg := name, ""
+		if i := strings.IndexByte(name, '='); i >= 0 {
+			name, arg = name[:i], name[i+1:]
+		}
+		switch name {
+		case "log":
+			mws = append(mws, rpc.Logging(l))
+		case "cache":
+			ttl, err := time.ParseDuration(arg)
+			if err != nil {
+				return nil, nil, fmt.Errorf("cache: %w", err)
+			}
+			mws = append(mws, rpc.Cache(ttl, clock.Real))
+		case "fallback":
+			mws = append(mws, rpc.Fallback(rpc.NewServerSelectorFunc(func(pan.UDPAddr, pan.UDPAddr) selector.Selector {
+				return &selector.DefaultSelector{}
+			})))
+		case "hysteresis":
+			var margin float64
+			dwell, m := arg, ""
+			if i := strings.IndexByte(arg, ':'); i >= 0 {
+				dwell, m = arg[:i], arg[i+1:]
+			}
+			d, err := time.ParseDuration(dwell)
+			if err == nil && m != "" {
+				margin, err = strconv.ParseFloat(m, 64)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("hysteresis: %w", err)
+			}
+			h, err := rpc.NewHysteresis(d, margin, clock.Real)
+			if err != nil {
+				return nil, nil, fmt.Errorf("hysteresis: %w", err)
+			}
+			mws = append(mws, h.Middleware)
+			tracers = append(tracers, h.ConnectionTracer)
+		default:
+			return nil, nil, fmt.Errorf("unknown middleware %q", name)
+		}
+	}
+	return mws, tracers, nil
+}
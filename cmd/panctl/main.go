@@ -0,0 +1,500 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/lua"
+	"github.com/netsys-lab/pan-lua/rpc"
+	"github.com/netsys-lab/pan-lua/sim"
+	"github.com/netsys-lab/pan-lua/trace"
+)
+
+const usage = `Usage: panctl [-socket path] <command> [arguments]
+
+Commands:
+  list                          list connections and their paths
+  selection                     show the currently selected path per connection
+  prefs <id> <key=value>...     replace the preferences of a connection
+  pin [-ttl d] <id> <fingerprint>
+                                force a connection onto a path
+  pin [-ttl d] -dest <ISD-AS> <fingerprint>
+                                force all connections to ISD-AS onto a path
+  unpin <id>                    remove all pins of a connection
+  exclude [-ttl d] [-conn id] [-dest ISD-AS] <ISD-AS>[#<interface>]
+                                keep connections off an AS or interface
+  overrides                     list operator overrides
+  unoverride <override-id>      remove an operator override
+  reload                        reload the path-selection script
+  dump                          dump the daemon state as JSON
+  replay -script <file> <trace>...
+                                run a script against recorded trace files
+                                and show where its path decisions differ
+  simulate [flags] <script>...  compare scripts on a synthetic network,
+                                see simulate -h for the network flags
+`
+
+func main() {
+	var socket string
+	flag.StringVar(&socket, "socket", rpc.DefaultDaemonAddress.Name, "daemon socket")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if args[0] == "simulate" {
+		if err := simulate(args[1:]); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if args[0] == "replay" {
+		// works offline, without a daemon
+		differ, err := replay(args[1:])
+		if err != nil {
+			fatal(err)
+		}
+		if differ {
+			os.Exit(1)
+		}
+		return
+	}
+
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		fatal(err)
+	}
+	client, err := rpc.NewClient(conn)
+	if err != nil {
+		fatal(err)
+	}
+	admin := rpc.NewAdminClient(client)
+	defer admin.Close()
+
+	switch cmd, args := args[0], args[1:]; cmd {
+	case "list":
+		err = list(admin)
+	case "selection":
+		err = selection(admin)
+	case "prefs":
+		err = prefs(admin, args)
+	case "pin":
+		err = pin(admin, args)
+	case "unpin":
+		err = unpin(admin, args)
+	case "exclude":
+		err = exclude(admin, args)
+	case "overrides":
+		err = overrides(admin)
+	case "unoverride":
+		err = unoverride(admin, args)
+	case "reload":
+		err = admin.Reload()
+	case "dump":
+		err = dump(admin)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fatal(err)
+	}
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "panctl:", err)
+	os.Exit(1)
+}
+
+func connectionID(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0, fmt.Errorf("missing connection id")
+	}
+	return strconv.Atoi(args[0])
+}
+
+func fingerprintOf(p *pan.PathFingerprint) string {
+	if p == nil {
+		return "-"
+	}
+	return string(*p)
+}
+
+func list(admin *rpc.AdminClient) error {
+	conns, err := admin.Connections()
+	if err != nil {
+		return err
+	}
+	for _, c := range conns {
+		fmt.Printf("[%d] %s -> %s %s\n", c.ID, c.Local, c.Remote, formatPreferences(c.Preferences))
+		for _, p := range c.Paths {
+			mark := " "
+			if c.Current != nil && *c.Current == p.Fingerprint {
+				mark = "*"
+			}
+			pinned := ""
+			if c.Pinned != nil && *c.Pinned == p.Fingerprint {
+				pinned = " (pinned)"
+			}
+			fmt.Printf("  %s %s%s\n", mark, p.PanPath(), pinned)
+			fmt.Printf("      fingerprint: %s\n", p.Fingerprint)
+		}
+	}
+	return nil
+}
+
+func selection(admin *rpc.AdminClient) error {
+	conns, err := admin.Connections()
+	if err != nil {
+		return err
+	}
+	for _, c := range conns {
+		pinned := ""
+		if c.Pinned != nil {
+			pinned = " (pinned)"
+		}
+		fmt.Printf("[%d] %s -> %s: %s%s\n", c.ID, c.Local, c.Remote, fingerprintOf(c.Current), pinned)
+	}
+	return nil
+}
+
+func prefs(admin *rpc.AdminClient, args []string) error {
+	id, err := connectionID(args)
+	if err != nil {
+		return err
+	}
+	prefs := map[string]string{}
+	for _, kv := range args[1:] {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return fmt.Errorf("preference %q is not of the form key=value", kv)
+		}
+		prefs[kv[:i]] = kv[i+1:]
+	}
+	return admin.SetConnectionPreferences(id, prefs)
+}
+
+func pin(admin *rpc.AdminClient, args []string) error {
+	var (
+		ttl  time.Duration
+		dest string
+	)
+	fs := flag.NewFlagSet("pin", flag.ExitOnError)
+	fs.DurationVar(&ttl, "ttl", 0, "drop the pin after this long (0 means never)")
+	fs.StringVar(&dest, "dest", "", "pin all connections to this ISD-AS")
+	fs.Parse(args)
+	args = fs.Args()
+
+	o := rpc.Override{Kind: rpc.OverridePin}
+	if dest != "" {
+		ia, err := pan.ParseIA(dest)
+		if err != nil {
+			return err
+		}
+		o.Destination = ia
+	} else {
+		id, err := connectionID(args)
+		if err != nil {
+			return err
+		}
+		o.Connection = id
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("missing fingerprint")
+	}
+	// fingerprints contain spaces, so allow them to be passed unquoted
+	o.Fingerprint = pan.PathFingerprint(strings.Join(args, " "))
+	if ttl > 0 {
+		o.Expires = time.Now().Add(ttl)
+	}
+	id, err := admin.AddOverride(o)
+	if err != nil {
+		return err
+	}
+	fmt.Println("added override", id)
+	return nil
+}
+
+func unpin(admin *rpc.AdminClient, args []string) error {
+	id, err := connectionID(args)
+	if err != nil {
+		return err
+	}
+	return admin.Unpin(id)
+}
+
+func exclude(admin *rpc.AdminClient, args []string) error {
+	var (
+		ttl  time.Duration
+		conn int
+		dest string
+	)
+	fs := flag.NewFlagSet("exclude", flag.ExitOnError)
+	fs.DurationVar(&ttl, "ttl", 0, "drop the exclusion after this long (0 means never)")
+	fs.IntVar(&conn, "conn", 0, "only apply to this connection")
+	fs.StringVar(&dest, "dest", "", "only apply to connections to this ISD-AS")
+	fs.Parse(args)
+	args = fs.Args()
+	if len(args) != 1 {
+		return fmt.Errorf("expected exactly one ISD-AS or ISD-AS#interface")
+	}
+
+	o := rpc.Override{Kind: rpc.OverrideExcludeIA, Connection: conn}
+	target := args[0]
+	if i := strings.Index(target, "#"); i >= 0 {
+		ifid, err := strconv.ParseUint(target[i+1:], 10, 64)
+		if err != nil {
+			return err
+		}
+		o.Kind = rpc.OverrideExcludeInterface
+		o.IfID = pan.IfID(ifid)
+		target = target[:i]
+	}
+	ia, err := pan.ParseIA(target)
+	if err != nil {
+		return err
+	}
+	o.IA = ia
+	if dest != "" {
+		if o.Destination, err = pan.ParseIA(dest); err != nil {
+			return err
+		}
+	}
+	if ttl > 0 {
+		o.Expires = time.Now().Add(ttl)
+	}
+	id, err := admin.AddOverride(o)
+	if err != nil {
+		return err
+	}
+	fmt.Println("added override", id)
+	return nil
+}
+
+func overrides(admin *rpc.AdminClient) error {
+	overrides, err := admin.Overrides()
+	if err != nil {
+		return err
+	}
+	for _, o := range overrides {
+		fmt.Println(o)
+	}
+	return nil
+}
+
+func unoverride(admin *rpc.AdminClient, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("missing override id")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return err
+	}
+	return admin.RemoveOverride(id)
+}
+
+func formatPreferences(prefs map[string]string) string {
+	keys := make([]string, 0, len(prefs))
+	for k := range prefs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s := make([]string, len(keys))
+	for i, k := range keys {
+		s[i] = k + "=" + prefs[k]
+	}
+	return "{" + strings.Join(s, ", ") + "}"
+}
+
+type jsonPath struct {
+	Fingerprint string    `json:"fingerprint"`
+	Source      string    `json:"source"`
+	Destination string    `json:"destination"`
+	Expiry      time.Time `json:"expiry"`
+	Interfaces  []string  `json:"interfaces,omitempty"`
+	MTU         uint16    `json:"mtu,omitempty"`
+	Latency     []string  `json:"latency,omitempty"`
+	Bandwidth   []uint64  `json:"bandwidth,omitempty"`
+	Notes       []string  `json:"notes,omitempty"`
+}
+
+type jsonConnection struct {
+	ID          int               `json:"id"`
+	Local       string            `json:"local"`
+	Remote      string            `json:"remote"`
+	Created     time.Time         `json:"created"`
+	Preferences map[string]string `json:"preferences"`
+	Current     *string           `json:"current"`
+	Pinned      *string           `json:"pinned"`
+	Paths       []jsonPath        `json:"paths"`
+}
+
+func newJSONPath(p *rpc.Path) jsonPath {
+	j := jsonPath{
+		Fingerprint: string(p.Fingerprint),
+		Source:      p.Source.String(),
+		Destination: p.Destination.String(),
+		Expiry:      p.Expiry,
+	}
+	if p.Metadata != nil {
+		for _, i := range p.Metadata.Interfaces {
+			j.Interfaces = append(j.Interfaces, fmt.Sprintf("%s#%d", i.IA, i.IfID))
+		}
+		for _, l := range p.Metadata.Latency {
+			j.Latency = append(j.Latency, l.String())
+		}
+		j.MTU = p.Metadata.MTU
+		j.Bandwidth = p.Metadata.Bandwidth
+		j.Notes = p.Metadata.Notes
+	}
+	return j
+}
+
+func optionalFingerprint(p *pan.PathFingerprint) *string {
+	if p == nil {
+		return nil
+	}
+	s := string(*p)
+	return &s
+}
+
+func dump(admin *rpc.AdminClient) error {
+	conns, err := admin.Connections()
+	if err != nil {
+		return err
+	}
+	out := make([]jsonConnection, len(conns))
+	for i, c := range conns {
+		out[i] = jsonConnection{
+			ID:          c.ID,
+			Local:       c.Local.String(),
+			Remote:      c.Remote.String(),
+			Created:     c.Created,
+			Preferences: c.Preferences,
+			Current:     optionalFingerprint(c.Current),
+			Pinned:      optionalFingerprint(c.Pinned),
+			Paths:       make([]jsonPath, len(c.Paths)),
+		}
+		for k, p := range c.Paths {
+			out[i].Paths[k] = newJSONPath(p)
+		}
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
+
+// replay runs a script against recorded events under a virtual clock and
+// reports whether any of its path decisions differ from the recorded ones
+func replay(args []string) (bool, error) {
+	var script string
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.StringVar(&script, "script", "", "candidate path-selection script")
+	fs.Parse(args)
+	if script == "" || fs.NArg() == 0 {
+		return false, fmt.Errorf("replay needs a -script and at least one trace file")
+	}
+
+	var events []*trace.Event
+	for _, name := range fs.Args() {
+		es, err := trace.ReadFile(name)
+		if err != nil {
+			return false, err
+		}
+		events = append(events, es...)
+	}
+	if len(events) == 0 {
+		return false, fmt.Errorf("no events recorded")
+	}
+
+	c := clock.NewManual(events[0].Time)
+	state := lua.NewState()
+	sel := lua.NewSelector(state, c)
+	stats := lua.NewStats(state, c)
+	if err := state.LoadScript(script); err != nil {
+		return false, err
+	}
+
+	r := trace.NewReplayer(sel, stats, c)
+	var decisions, differences, failures int
+	for _, e := range events {
+		d, err := r.Replay(e)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, e.Time.Format("15:04:05.000000"), err)
+			failures++
+			continue
+		}
+		if e.Method == "SelectorServer.Path" {
+			decisions++
+		}
+		if d != nil {
+			fmt.Println(d)
+			differences++
+		}
+	}
+	fmt.Printf("replayed %d events: %d of %d path decisions differ, %d calls failed\n",
+		len(events), differences, decisions, failures)
+	return differences > 0, nil
+}
+
+// simulate runs scripts against the same synthetic network and prints what
+// each of them achieved
+func simulate(args []string) error {
+	cfg, opts := sim.DefaultConfig, sim.DefaultOptions
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	fs.IntVar(&cfg.Paths, "paths", cfg.Paths, "number of paths")
+	fs.IntVar(&cfg.MaxTransit, "transit", cfg.MaxTransit, "maximum number of transit ASes per path")
+	fs.IntVar(&cfg.Failures, "failures", cfg.Failures, "number of link failures")
+	fs.IntVar(&cfg.Congestions, "congestions", cfg.Congestions, "number of congestion episodes")
+	fs.Int64Var(&cfg.Seed, "seed", cfg.Seed, "seed of the network")
+	fs.DurationVar(&opts.Duration, "duration", opts.Duration, "simulated time")
+	fs.DurationVar(&opts.Step, "step", opts.Step, "interval between path decisions")
+	fs.Uint64Var(&opts.Demand, "demand", opts.Demand, "sending rate in Kbit/s")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return fmt.Errorf("simulate needs at least one script")
+	}
+	cfg.Duration = opts.Duration
+
+	var strategies []sim.Strategy
+	for _, script := range fs.Args() {
+		strategies = append(strategies, sim.LuaStrategy(script))
+	}
+	reports, err := sim.Compare(sim.Generate(cfg), opts, strategies...)
+	if err != nil {
+		return err
+	}
+	for _, r := range reports {
+		fmt.Println(r)
+	}
+	return nil
+}
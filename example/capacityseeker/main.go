@@ -27,6 +27,7 @@ import (
 	quic "github.com/lucas-clemente/quic-go"
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
 	lib "github.com/netsys-lab/pan-lua"
+	"github.com/netsys-lab/pan-lua/selector"
 	"inet.af/netaddr"
 )
 
@@ -34,6 +35,7 @@ func main() {
 	var (
 		remote, local, p                             string
 		server, client, daemontracer, daemonselector bool
+		inprocess                                    bool
 		bytes                                        int64
 	)
 
@@ -44,6 +46,7 @@ func main() {
 	flag.StringVar(&p, "profile", "CapacitySeeking", "SCION capacity profile (Default|CapacitySeeking|Scavenger|LowLatency)")
 	flag.BoolVar(&daemontracer, "daemontracer", false, "use PANAPI daemon tracer")
 	flag.BoolVar(&daemonselector, "daemonselector", false, "use PANAPI daemon selector")
+	flag.BoolVar(&inprocess, "inprocess", false, "select paths in-process instead of asking the daemon")
 	flag.Int64Var(&bytes, "bytes", 1000*1000*10, "amount of bytes to transfer during experiment")
 
 	flag.Parse()
@@ -64,14 +67,24 @@ func main() {
 	if len(local) > 0 {
 		log.Println(runServer(local, &tlsConf))
 	} else {
-		var qconf quic.Config
-		selector, tracer, err := lib.RPCClientHelper()
-		selector.SetPreferences(map[string]string{"ConnCapacityProfile": p})
-		if err != nil {
+		var (
+			qconf quic.Config
+			sel   selector.Selector
+		)
+		if inprocess {
+			s := selector.NewProfileSelector(nil)
+			sel, qconf.Tracer = s, s.Tracer()
+		} else {
+			var err error
+			sel, qconf.Tracer, err = lib.RPCClientHelper()
+			if err != nil {
+				log.Fatalln(err)
+			}
+		}
+		if err := sel.SetPreferences(map[string]string{selector.ProfileKey: p}); err != nil {
 			log.Fatalln(err)
 		}
-		qconf.Tracer = tracer
-		err = runClient(bytes, remote, selector, &qconf, &tlsConf)
+		err := runClient(bytes, remote, sel, &qconf, &tlsConf)
 		if err != nil {
 			log.Println(err)
 		}
@@ -5,7 +5,10 @@ go 1.17
 require (
 	github.com/lucas-clemente/quic-go v0.26.0
 	github.com/netsec-ethz/scion-apps v0.5.0
+	github.com/prometheus/client_golang v1.7.1
+	github.com/scionproto/scion v0.6.1-0.20210929154253-764d6e2afe47
 	github.com/yuin/gopher-lua v0.0.0-20220504180219-658193537a64
+	go.uber.org/zap v1.17.0
 	inet.af/netaddr v0.0.0-20210903134321-85fa6c94624e
 )
 
@@ -38,16 +41,13 @@ require (
 	github.com/onsi/ginkgo v1.16.4 // indirect
 	github.com/opentracing/opentracing-go v1.2.0 // indirect
 	github.com/pelletier/go-toml v1.9.3 // indirect
-	github.com/prometheus/client_golang v1.7.1 // indirect
 	github.com/prometheus/client_model v0.2.0 // indirect
 	github.com/prometheus/common v0.10.0 // indirect
 	github.com/prometheus/procfs v0.1.3 // indirect
-	github.com/scionproto/scion v0.6.1-0.20210929154253-764d6e2afe47 // indirect
 	github.com/uber/jaeger-client-go v2.29.1+incompatible // indirect
 	github.com/uber/jaeger-lib v2.0.0+incompatible // indirect
 	go.uber.org/atomic v1.7.0 // indirect
 	go.uber.org/multierr v1.6.0 // indirect
-	go.uber.org/zap v1.17.0 // indirect
 	go4.org/intern v0.0.0-20210108033219-3eb7198706b2 // indirect
 	go4.org/unsafe/assume-no-moving-gc v0.0.0-20201222180813-1025295fd063 // indirect
 	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519 // indirect
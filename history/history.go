@@ -0,0 +1,324 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package history keeps long-term performance records of paths and
+// interfaces, such that path selection can draw on what earlier connections
+// experienced. Records decay exponentially with time and are stored on disk.
+package history
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+// rttBuckets are the upper bounds of the RTT histogram, in seconds. Larger
+// samples are counted in an extra bucket.
+var rttBuckets = []float64{.001, .002, .005, .01, .02, .05, .1, .2, .5, 1, 2, 5}
+
+// Record aggregates the performance of a path or an interface. All counts
+// are decayed, they are weighted by how recent the events were.
+type Record struct {
+	Updated time.Time
+	// Samples is the number of RTT samples
+	Samples float64
+	// RTT counts the samples per bucket of rttBuckets, plus the larger ones
+	RTT []float64
+	// RTTSum is the sum of the samples, in seconds
+	RTTSum float64
+	// RateSum is the sum of the rates at the time of the samples, the
+	// congestion window over the RTT, in Kbit/s
+	RateSum     float64
+	Acked, Lost float64
+	Failures    float64
+}
+
+func newRecord(now time.Time) *Record {
+	return &Record{Updated: now, RTT: make([]float64, len(rttBuckets)+1)}
+}
+
+// decay ages r to now
+func (r *Record) decay(now time.Time, halfLife time.Duration) {
+	if !now.After(r.Updated) {
+		return
+	}
+	f := math.Exp2(-now.Sub(r.Updated).Seconds() / halfLife.Seconds())
+	r.Samples *= f
+	for i := range r.RTT {
+		r.RTT[i] *= f
+	}
+	r.RTTSum *= f
+	r.RateSum *= f
+	r.Acked *= f
+	r.Lost *= f
+	r.Failures *= f
+	r.Updated = now
+}
+
+// weight tells how much is left of the record
+func (r *Record) weight() float64 {
+	return r.Samples + r.Acked + r.Lost + r.Failures
+}
+
+// quantile returns the upper bound of the bucket containing the quantile q
+// of the RTT samples
+func (r *Record) quantile(q float64) float64 {
+	var n float64
+	for i, c := range r.RTT {
+		n += c
+		if n >= q*r.Samples && i < len(rttBuckets) {
+			return rttBuckets[i]
+		}
+	}
+	return rttBuckets[len(rttBuckets)-1]
+}
+
+// Stats summarizes a record
+type Stats struct {
+	// Samples is the decayed number of RTT samples
+	Samples float64
+	// RTT statistics in seconds. The percentiles are upper bounds, taken
+	// from a histogram.
+	RTTMean, RTTP50, RTTP90 float64
+	// Loss is the fraction of packets lost
+	Loss float64
+	// Throughput is the mean rate in Kbit/s
+	Throughput float64
+	// Failures is the decayed number of times the path or interface was
+	// reported down
+	Failures float64
+}
+
+func (r *Record) stats() Stats {
+	s := Stats{Samples: r.Samples, Failures: r.Failures}
+	if r.Samples > 0 {
+		s.RTTMean = r.RTTSum / r.Samples
+		s.RTTP50 = r.quantile(.5)
+		s.RTTP90 = r.quantile(.9)
+		s.Throughput = r.RateSum / r.Samples
+	}
+	if r.Acked+r.Lost > 0 {
+		s.Loss = r.Lost / (r.Acked + r.Lost)
+	}
+	return s
+}
+
+// forgotten is the weight below which records are dropped
+const forgotten = 0.01
+
+// DB is the performance history of the paths and interfaces used on the
+// host, keyed by path fingerprint and by interface as IA#IfID
+type DB struct {
+	file     string
+	halfLife time.Duration
+	clock    clock.Clock
+	mu       sync.Mutex
+	paths    map[string]*Record
+	ifs      map[string]*Record
+	// the path currently used by each connection
+	current map[string]*pan.Path
+	timer   clock.Timer
+}
+
+// dbFile is the format of the file
+type dbFile struct {
+	Paths      map[string]*Record
+	Interfaces map[string]*Record
+}
+
+// Open loads the history in file, if it exists. Records lose half of their
+// weight every halfLife. Without file, the history is kept in memory only.
+func Open(file string, halfLife time.Duration, c clock.Clock) (*DB, error) {
+	if halfLife <= 0 {
+		return nil, errors.New("half-life must be positive")
+	}
+	db := &DB{
+		file:     file,
+		halfLife: halfLife,
+		clock:    c,
+		paths:    map[string]*Record{},
+		ifs:      map[string]*Record{},
+		current:  map[string]*pan.Path{},
+	}
+	if file == "" {
+		return db, nil
+	}
+	b, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return db, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var f dbFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	for _, m := range []map[string]*Record{f.Paths, f.Interfaces} {
+		for k, r := range m {
+			if r == nil || len(r.RTT) != len(rttBuckets)+1 {
+				delete(m, k)
+			}
+		}
+	}
+	if f.Paths != nil {
+		db.paths = f.Paths
+	}
+	if f.Interfaces != nil {
+		db.ifs = f.Interfaces
+	}
+	return db, nil
+}
+
+// prune ages all records to now and drops those that decayed to almost
+// nothing. The caller must hold the lock.
+func (db *DB) prune(now time.Time) {
+	for _, m := range []map[string]*Record{db.paths, db.ifs} {
+		for k, r := range m {
+			r.decay(now, db.halfLife)
+			if r.weight() < forgotten {
+				delete(m, k)
+			}
+		}
+	}
+}
+
+// Save writes the history to its file, replacing it atomically. Records that
+// decayed to almost nothing are dropped.
+func (db *DB) Save() error {
+	db.mu.Lock()
+	db.prune(db.clock.Now())
+	if db.file == "" {
+		db.mu.Unlock()
+		return nil
+	}
+	b, err := json.Marshal(dbFile{db.paths, db.ifs})
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(db.file), filepath.Base(db.file)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), db.file)
+}
+
+// SaveEvery saves the history every interval, until Close. Errors are
+// passed to report. Records that decayed to almost nothing are dropped
+// every interval as well, also when the history is kept in memory only.
+func (db *DB) SaveEvery(interval time.Duration, report func(error)) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var save func()
+	save = func() {
+		if err := db.Save(); err != nil {
+			report(err)
+		}
+		db.mu.Lock()
+		if db.timer != nil {
+			db.timer = db.clock.AfterFunc(interval, save)
+		}
+		db.mu.Unlock()
+	}
+	db.timer = db.clock.AfterFunc(interval, save)
+}
+
+// Close stops saving periodically and saves the history a last time
+func (db *DB) Close() error {
+	db.mu.Lock()
+	if db.timer != nil {
+		db.timer.Stop()
+		db.timer = nil
+	}
+	db.mu.Unlock()
+	return db.Save()
+}
+
+func interfaceKey(pi pan.PathInterface) string {
+	return fmt.Sprintf("%s#%d", pi.IA, pi.IfID)
+}
+
+// records returns the records of p and its interfaces, aged to now. The
+// caller must hold the lock.
+func (db *DB) records(p *pan.Path, now time.Time) []*Record {
+	get := func(m map[string]*Record, k string) *Record {
+		r, ok := m[k]
+		if !ok {
+			r = newRecord(now)
+			m[k] = r
+		}
+		r.decay(now, db.halfLife)
+		return r
+	}
+	rs := []*Record{get(db.paths, string(p.Fingerprint))}
+	if p.Metadata != nil {
+		for _, pi := range p.Metadata.Interfaces {
+			rs = append(rs, get(db.ifs, interfaceKey(pi)))
+		}
+	}
+	return rs
+}
+
+// update applies f to the records of the path the connection is using
+func (db *DB) update(local, remote *pan.UDPAddr, f func(*Record)) {
+	if local == nil || remote == nil {
+		return
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	p, ok := db.current[local.String()+remote.String()]
+	if !ok {
+		return
+	}
+	for _, r := range db.records(p, db.clock.Now()) {
+		f(r)
+	}
+}
+
+// Path returns the history of the path with fingerprint fp
+func (db *DB) Path(fp pan.PathFingerprint) (Stats, bool) {
+	return db.lookup(db.paths, string(fp))
+}
+
+// Interface returns the history of the interface pi
+func (db *DB) Interface(pi pan.PathInterface) (Stats, bool) {
+	return db.lookup(db.ifs, interfaceKey(pi))
+}
+
+func (db *DB) lookup(m map[string]*Record, k string) (Stats, bool) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	r, ok := m[k]
+	if !ok {
+		return Stats{}, false
+	}
+	r.decay(db.clock.Now(), db.halfLife)
+	return r.stats(), true
+}
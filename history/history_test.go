@@ -0,0 +1,131 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package history
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// firstPath selects the first path
+type firstPath struct {
+	paths []*pan.Path
+}
+
+func (s *firstPath) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.paths = paths
+	return nil
+}
+func (s *firstPath) SetPreferences(map[string]string, pan.UDPAddr, pan.UDPAddr) error { return nil }
+func (s *firstPath) Path(pan.UDPAddr, pan.UDPAddr) (*pan.Path, error)                 { return s.paths[0], nil }
+func (s *firstPath) PathDown(pan.UDPAddr, pan.UDPAddr, pan.PathFingerprint, pan.PathInterface) error {
+	return nil
+}
+func (s *firstPath) Refresh(pan.UDPAddr, pan.UDPAddr, []*pan.Path) error { return nil }
+func (s *firstPath) Close(pan.UDPAddr, pan.UDPAddr) error                { return nil }
+
+func TestDB(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	ia := pan.MustParseIA("1-ff00:0:110")
+	pi := pan.PathInterface{IA: ia, IfID: 1}
+	paths := []*pan.Path{{Fingerprint: "a", Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{pi}}}}
+	file := filepath.Join(t.TempDir(), "history.json")
+	c := clock.NewManual(time.Unix(0, 0))
+	db, err := Open(file, time.Hour, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := db.Middleware(&firstPath{})
+	ct := db.ConnectionTracer(rpc.NopConnectionTracer{})
+
+	s.Initialize(nil, local, remote, paths)
+	// nothing is attributed before a path was selected
+	ct.UpdatedMetrics(&local, &remote, &rpc.RTTStats{LatestRTT: time.Second}, 1000, 0, 0)
+	if _, ok := db.Path("a"); ok {
+		t.Error("history of a before it was used")
+	}
+	s.Path(local, remote)
+	for _, rtt := range []time.Duration{8, 9, 10, 100} {
+		ct.UpdatedMetrics(&local, &remote, &rpc.RTTStats{LatestRTT: rtt * time.Millisecond}, 12500, 0, 0)
+	}
+	for i := 0; i < 3; i++ {
+		ct.AcknowledgedPacket(&local, &remote, 0, 0)
+	}
+	ct.LostPacket(&local, &remote, 0, 0, 0)
+	s.PathDown(local, remote, "a", pi)
+
+	st, ok := db.Path("a")
+	if !ok || st.Samples != 4 || st.RTTP50 != .01 || st.RTTP90 != .1 || st.Loss != .25 || st.Failures != 1 {
+		t.Errorf("Path(a) = %+v, %v", st, ok)
+	}
+	if math.Abs(st.RTTMean-.03175) > 1e-9 {
+		t.Errorf("RTTMean = %v, want 0.03175", st.RTTMean)
+	}
+	if st, ok := db.Interface(pi); !ok || st.Samples != 4 || st.Failures != 1 {
+		t.Errorf("Interface = %+v, %v", st, ok)
+	}
+
+	c.Advance(time.Hour)
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	db, err = Open(file, time.Hour, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// half of it is left, but the proportions are the same
+	st, ok = db.Path("a")
+	if !ok || math.Abs(st.Samples-2) > 1e-9 || math.Abs(st.Loss-.25) > 1e-9 || st.RTTP50 != .01 {
+		t.Errorf("Path(a) after an hour = %+v, %v", st, ok)
+	}
+	// until it is forgotten
+	c.Advance(24 * time.Hour)
+	if err := db.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := db.Path("a"); ok {
+		t.Error("history of a not forgotten")
+	}
+}
+
+func TestPruneInMemory(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	c := clock.NewManual(time.Unix(0, 0))
+	db, err := Open("", time.Hour, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.SaveEvery(time.Hour, func(err error) { t.Error(err) })
+	defer db.Close()
+	s := db.Middleware(&firstPath{})
+	ct := db.ConnectionTracer(rpc.NopConnectionTracer{})
+	s.Initialize(nil, local, remote, []*pan.Path{{Fingerprint: "a"}})
+	s.Path(local, remote)
+	ct.UpdatedMetrics(&local, &remote, &rpc.RTTStats{LatestRTT: time.Millisecond}, 1000, 0, 0)
+	s.Close(local, remote)
+
+	c.Advance(24 * time.Hour)
+	db.mu.Lock()
+	n := len(db.paths)
+	db.mu.Unlock()
+	if n != 0 {
+		t.Errorf("%d path records kept in memory, want none", n)
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package history
+
+import (
+	"sort"
+
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// Middleware tracks the paths the connections of next use, and counts paths
+// and interfaces reported down as failures
+func (db *DB) Middleware(next rpc.ServerSelector) rpc.ServerSelector {
+	return &selector{db: db, next: next}
+}
+
+type selector struct {
+	db   *DB
+	next rpc.ServerSelector
+}
+
+func (s *selector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	return s.next.Initialize(prefs, local, remote, paths)
+}
+
+func (s *selector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	return s.next.SetPreferences(prefs, local, remote)
+}
+
+func (s *selector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	p, err := s.next.Path(local, remote)
+	if p != nil {
+		s.db.mu.Lock()
+		s.db.current[local.String()+remote.String()] = p
+		s.db.mu.Unlock()
+	}
+	return p, err
+}
+
+func (s *selector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.db.mu.Lock()
+	now := s.db.clock.Now()
+	if fp != "" {
+		for _, r := range s.db.records(&pan.Path{Fingerprint: fp}, now) {
+			r.Failures++
+		}
+	}
+	if pi != (pan.PathInterface{}) {
+		k := interfaceKey(pi)
+		r, ok := s.db.ifs[k]
+		if !ok {
+			r = newRecord(now)
+			s.db.ifs[k] = r
+		}
+		r.decay(now, s.db.halfLife)
+		r.Failures++
+	}
+	s.db.mu.Unlock()
+	return s.next.PathDown(local, remote, fp, pi)
+}
+
+func (s *selector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	return s.next.Refresh(local, remote, paths)
+}
+
+func (s *selector) Close(local, remote pan.UDPAddr) error {
+	s.db.mu.Lock()
+	delete(s.db.current, local.String()+remote.String())
+	s.db.mu.Unlock()
+	return s.next.Close(local, remote)
+}
+
+// ConnectionTracer records the RTT, rate and losses of the connections on
+// the paths they use, passing all calls on to next
+func (db *DB) ConnectionTracer(next rpc.ServerConnectionTracer) rpc.ServerConnectionTracer {
+	return tracer{next, db}
+}
+
+type tracer struct {
+	rpc.ServerConnectionTracer
+	db *DB
+}
+
+func (t tracer) UpdatedMetrics(local, remote *pan.UDPAddr, rttStats *rpc.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) error {
+	if rttStats != nil && rttStats.LatestRTT > 0 {
+		rtt := rttStats.LatestRTT.Seconds()
+		rate := float64(cwnd) * 8 / 1000 / rtt
+		bucket := sort.SearchFloat64s(rttBuckets, rtt)
+		t.db.update(local, remote, func(r *Record) {
+			r.Samples++
+			r.RTT[bucket]++
+			r.RTTSum += rtt
+			r.RateSum += rate
+		})
+	}
+	return t.ServerConnectionTracer.UpdatedMetrics(local, remote, rttStats, cwnd, bytesInFlight, packetsInFlight)
+}
+
+func (t tracer) AcknowledgedPacket(local, remote *pan.UDPAddr, level logging.EncryptionLevel, pn logging.PacketNumber) error {
+	t.db.update(local, remote, func(r *Record) { r.Acked++ })
+	return t.ServerConnectionTracer.AcknowledgedPacket(local, remote, level, pn)
+}
+
+func (t tracer) LostPacket(local, remote *pan.UDPAddr, level logging.EncryptionLevel, pn logging.PacketNumber, reason logging.PacketLossReason) error {
+	t.db.update(local, remote, func(r *Record) { r.Lost++ })
+	return t.ServerConnectionTracer.LostPacket(local, remote, level, pn, reason)
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logger sets up the structured, levelled logger shared by the
+// daemon, the Lua state and the RPC layer
+package logger
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type Config struct {
+	// Level is one of debug, info, warn or error, info if empty
+	Level string
+	// Format is text or json, text if empty
+	Format string
+	// Sinks are "stderr", "stdout" or file names, stderr if empty
+	Sinks []string
+	// MaxSize is the size in bytes after which file sinks are rotated, 0
+	// disables rotation
+	MaxSize int64
+	// MaxFiles is the number of rotated files kept per file sink
+	MaxFiles int
+}
+
+// New builds a logger according to cfg
+func New(cfg Config) (*zap.Logger, error) {
+	level := zapcore.InfoLevel
+	if cfg.Level != "" {
+		if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+			return nil, err
+		}
+	}
+
+	var enc zapcore.Encoder
+	switch cfg.Format {
+	case "", "text":
+		ec := zap.NewDevelopmentEncoderConfig()
+		ec.EncodeCaller = nil
+		enc = zapcore.NewConsoleEncoder(ec)
+	case "json":
+		ec := zap.NewProductionEncoderConfig()
+		ec.EncodeTime = zapcore.ISO8601TimeEncoder
+		enc = zapcore.NewJSONEncoder(ec)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	sinks := cfg.Sinks
+	if len(sinks) == 0 {
+		sinks = []string{"stderr"}
+	}
+	ws := make([]zapcore.WriteSyncer, len(sinks))
+	for i, s := range sinks {
+		switch s {
+		case "stderr":
+			ws[i] = zapcore.Lock(os.Stderr)
+		case "stdout":
+			ws[i] = zapcore.Lock(os.Stdout)
+		default:
+			f, err := OpenRotatingFile(s, cfg.MaxSize, cfg.MaxFiles)
+			if err != nil {
+				return nil, err
+			}
+			ws[i] = f
+		}
+	}
+	core := zapcore.NewCore(enc, zapcore.NewMultiWriteSyncer(ws...), level)
+	return zap.New(core), nil
+}
+
+var (
+	mu  sync.RWMutex
+	def *zap.Logger
+)
+
+func init() {
+	def, _ = New(Config{})
+}
+
+// Default returns the process-wide logger. Packages pick it up when their
+// components are created, so it should be set up before that.
+func Default() *zap.Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	return def
+}
+
+// SetDefault replaces the process-wide logger and routes the output of the
+// standard library's log package to it
+func SetDefault(l *zap.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	def = l
+	zap.RedirectStdLog(l)
+}
@@ -0,0 +1,87 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const clockScript = `
+down, fired, ticks = "", 0, 0
+local paths
+function panapi.Initialize(prefs, laddr, raddr, ps) paths = ps end
+function panapi.Path(laddr, raddr) return paths[1] end
+function panapi.PathDown(laddr, raddr, fp, pi) down = down .. fp end
+function panapi.Periodic(seconds) ticks = ticks + seconds end
+
+panapi.After(0.5, function() fired = panapi.Now() end)
+local t = panapi.After(0.5, function() fired = -1 end)
+t:Stop()
+`
+
+func TestVirtualClock(t *testing.T) {
+	start := time.Unix(1000, 0)
+	c := clock.NewManual(start)
+	state := NewState()
+	sel := NewSelector(state, c)
+	NewStats(state, c)
+	if err := state.DoString(clockScript); err != nil {
+		t.Fatal(err)
+	}
+
+	local := pan.UDPAddr{Port: 1}
+	remote := pan.UDPAddr{IA: pan.MustParseIA("1-ff00:0:110"), Port: 2}
+	paths := []*pan.Path{
+		{Fingerprint: "a", Expiry: start.Add(1500 * time.Millisecond)},
+		{Fingerprint: "b"},
+	}
+	if err := sel.Initialize(nil, local, remote, paths); err != nil {
+		t.Fatal(err)
+	}
+
+	number := func(name string) float64 {
+		return float64(state.GetGlobal(name).(lua.LNumber))
+	}
+	c.Advance(time.Second)
+	if fired := number("fired"); fired != float64(start.Add(500*time.Millisecond).UnixMicro()) {
+		t.Errorf("timer fired at %v", fired)
+	}
+	if ticks := number("ticks"); ticks != 1 {
+		t.Errorf("Periodic saw %v seconds, want 1", ticks)
+	}
+	if down := state.GetGlobal("down").String(); down != "" {
+		t.Errorf("paths %q down before expiry", down)
+	}
+
+	c.Advance(time.Second)
+	if down := state.GetGlobal("down").String(); down != "a" {
+		t.Errorf("paths %q down after expiry, want a", down)
+	}
+	c.Advance(10 * time.Second)
+	if down := state.GetGlobal("down").String(); down != "a" {
+		t.Errorf("paths %q down, want a only once", down)
+	}
+
+	if err := state.DoString("now = stats.Now()"); err != nil {
+		t.Fatal(err)
+	}
+	if now := number("now"); now != float64(start.Add(12*time.Second).UnixMicro()) {
+		t.Errorf("stats.Now returned %v", now)
+	}
+}
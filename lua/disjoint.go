@@ -0,0 +1,96 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/selector"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// registerDisjointness adds SharedLinks(p1, p2), Disjointness(p1, p2) and
+// MostDisjoint(paths, reference, k) to mod, which compare paths by the
+// interfaces in their metadata
+func (s *State) registerDisjointness(mod map[string]lua.LGFunction) {
+	mod["SharedLinks"] = func(L *lua.LState) int {
+		shared := selector.SharedLinks(checkPath(L, 1), checkPath(L, 2))
+		t := L.NewTable()
+		for _, pi := range shared {
+			t.Append(newLuaPathInterface(pi))
+		}
+		L.Push(t)
+		return 1
+	}
+	mod["Disjointness"] = func(L *lua.LState) int {
+		L.Push(lua.LNumber(selector.Disjointness(checkPath(L, 1), checkPath(L, 2))))
+		return 1
+	}
+	mod["MostDisjoint"] = func(L *lua.LState) int {
+		lpaths := L.CheckTable(1)
+		var reference *pan.Path
+		if L.Get(2) != lua.LNil {
+			reference = checkPath(L, 2)
+		}
+		k := L.OptInt(3, 1)
+
+		// picked paths are returned as the tables they were given as
+		var paths []*pan.Path
+		tables := map[*pan.Path]lua.LValue{}
+		lpaths.ForEach(func(_, v lua.LValue) {
+			t, ok := v.(*lua.LTable)
+			if !ok {
+				L.ArgError(1, "table of paths expected")
+			}
+			p := toPath(t)
+			paths = append(paths, p)
+			tables[p] = t
+		})
+		res := L.NewTable()
+		for _, p := range selector.MostDisjoint(paths, reference, k) {
+			res.Append(tables[p])
+		}
+		L.Push(res)
+		return 1
+	}
+}
+
+func checkPath(L *lua.LState, n int) *pan.Path {
+	return toPath(L.CheckTable(n))
+}
+
+// toPath reads the fingerprint and the interfaces of a path table, as created
+// by newLuaPath
+func toPath(t *lua.LTable) *pan.Path {
+	p := &pan.Path{Fingerprint: pan.PathFingerprint(lua.LVAsString(t.RawGetString("Fingerprint")))}
+	meta, ok := t.RawGetString("Metadata").(*lua.LTable)
+	if !ok {
+		return p
+	}
+	p.Metadata = &pan.PathMetadata{}
+	if ifaces, ok := meta.RawGetString("Interfaces").(*lua.LTable); ok {
+		ifaces.ForEach(func(_, v lua.LValue) {
+			iface, ok := v.(*lua.LTable)
+			if !ok {
+				return
+			}
+			ia, err := pan.ParseIA(lua.LVAsString(iface.RawGetString("IA")))
+			if err != nil {
+				return
+			}
+			ifid := lua.LVAsNumber(iface.RawGetString("IfID"))
+			p.Metadata.Interfaces = append(p.Metadata.Interfaces, pan.PathInterface{IA: ia, IfID: pan.IfID(ifid)})
+		})
+	}
+	return p
+}
@@ -0,0 +1,52 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua_test
+
+import (
+	"testing"
+
+	"github.com/netsys-lab/pan-lua/pantest"
+)
+
+// sends on the path most disjoint from the first one, which is kept as
+// primary
+const backup = `
+local paths = {}
+function panapi.Initialize(prefs, laddr, raddr, ps) paths[raddr] = ps end
+function panapi.Refresh(laddr, raddr, ps) paths[raddr] = ps end
+function panapi.PathDown(laddr, raddr, fp, pi) end
+function panapi.Path(laddr, raddr)
+	local ps = paths[raddr]
+	local b = panapi.MostDisjoint(ps, ps[1], 1)[1]
+	local shared = panapi.SharedLinks(ps[1], ps[2])
+	assert(#shared == 2 and shared[2].IA == "1-ff00:0:112" and shared[2].IfID == 2)
+	assert(panapi.Disjointness(ps[1], b) == 1)
+	return b
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+`
+
+func TestMostDisjoint(t *testing.T) {
+	h := pantest.NewHarness(t, backup)
+	h.Initialize(nil, pantest.Paths(
+		pantest.NewPath().Fingerprint("primary").
+			Interfaces("1-ff00:0:110#1", "1-ff00:0:112#2", "1-ff00:0:112#3", "1-ff00:0:111#4"),
+		pantest.NewPath().Fingerprint("partial").
+			Interfaces("1-ff00:0:110#1", "1-ff00:0:112#2", "1-ff00:0:112#5", "1-ff00:0:111#6"),
+		pantest.NewPath().Fingerprint("disjoint").
+			Interfaces("1-ff00:0:110#7", "1-ff00:0:113#8", "1-ff00:0:113#9", "1-ff00:0:111#10"),
+	)...)
+	h.ExpectPath("disjoint")
+}
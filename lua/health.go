@@ -0,0 +1,49 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"fmt"
+
+	"github.com/netsys-lab/pan-lua/rpc"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SetInterfaceHealth gives scripts access to the health table h through
+// panapi.InterfaceHealth. Without it, the table is empty.
+func (s *State) SetInterfaceHealth(h *rpc.InterfaceHealth) {
+	s.Lock()
+	defer s.Unlock()
+	s.health = h
+}
+
+// registerHealth adds InterfaceHealth() to mod, which returns the health
+// table keyed by "IA#IfID"
+func (s *State) registerHealth(mod map[string]lua.LGFunction) {
+	mod["InterfaceHealth"] = func(L *lua.LState) int {
+		t := L.NewTable()
+		if s.health != nil {
+			for _, st := range s.health.Table() {
+				e := newLuaPathInterface(st.Interface)
+				e.RawSetString("Down", lua.LBool(st.Down))
+				e.RawSetString("Since", lua.LNumber(st.Since.UnixMicro()))
+				e.RawSetString("Reported", lua.LNumber(st.Reported.UnixMicro()))
+				e.RawSetString("Reports", lua.LNumber(st.Reports))
+				t.RawSetString(fmt.Sprintf("%s#%d", st.Interface.IA, st.Interface.IfID), e)
+			}
+		}
+		L.Push(t)
+		return 1
+	}
+}
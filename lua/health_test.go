@@ -0,0 +1,113 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// healthHarness runs script behind a table of interface health, as the
+// daemon does
+func healthHarness(t *testing.T, script string) *pantest.Harness {
+	t.Helper()
+	h := pantest.NewHarness(t, script)
+	health := rpc.NewInterfaceHealth(time.Minute, h.Clock)
+	h.State.SetInterfaceHealth(health)
+	h.Use(health.Middleware)
+	return h
+}
+
+// avoids paths through interfaces that are down on any connection
+const healthAware = `
+local paths = {}
+function panapi.Initialize(prefs, laddr, raddr, ps) paths[raddr] = ps end
+function panapi.Refresh(laddr, raddr, ps) paths[raddr] = ps end
+function panapi.PathDown(laddr, raddr, fp, pi) end
+function panapi.Path(laddr, raddr)
+	local health = panapi.InterfaceHealth()
+	for _, p in ipairs(paths[raddr]) do
+		local up = true
+		for _, pi in ipairs(p.Metadata.Interfaces) do
+			local h = health[pi.IA .. "#" .. pi.IfID]
+			if h and h.Down then up = false end
+		end
+		if up then return p end
+	end
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+`
+
+func TestInterfaceHealth(t *testing.T) {
+	h := healthHarness(t, healthAware)
+	paths := pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("via-112"),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:111").Fingerprint("via-113"),
+	)
+	h.Initialize(nil, paths...)
+	h.ExpectPath("via-112")
+
+	// another connection finds 1-ff00:0:112 down
+	other := pantest.Addr("1-ff00:0:111,127.0.0.3:3000")
+	if err := h.Selector.Initialize(nil, h.Local, other, paths[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Selector.PathDown(h.Local, other, "", paths[0].Metadata.Interfaces[1]); err != nil {
+		t.Fatal(err)
+	}
+	h.ExpectPath("via-113")
+	h.Advance(time.Minute)
+	h.ExpectPath("via-112")
+}
+
+// avoids the paths reported down to it, by fingerprint
+const fingerprintAware = `
+local paths, down = {}, {}
+function panapi.Initialize(prefs, laddr, raddr, ps) paths[raddr] = ps end
+function panapi.Refresh(laddr, raddr, ps) paths[raddr] = ps end
+function panapi.PathDown(laddr, raddr, fp, pi) down[fp] = true end
+function panapi.Path(laddr, raddr)
+	for _, p in ipairs(paths[raddr]) do
+		if not down[p.Fingerprint] then return p end
+	end
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+`
+
+func TestInterfaceHealthFingerprints(t *testing.T) {
+	h := healthHarness(t, fingerprintAware)
+	paths := pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("via-112"),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:111").Fingerprint("via-113"),
+	)
+	h.Initialize(nil, paths...)
+	h.ExpectPath("via-112")
+
+	// another connection reports its own path through 1-ff00:0:112 down
+	other := pantest.Addr("1-ff00:0:111,127.0.0.3:3000")
+	theirs := pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("their-112").Build()
+	if err := h.Selector.Initialize(nil, h.Local, other, []*pan.Path{theirs}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Selector.PathDown(h.Local, other, theirs.Fingerprint, theirs.Metadata.Interfaces[1]); err != nil {
+		t.Fatal(err)
+	}
+	h.ExpectPath("via-113")
+}
@@ -0,0 +1,78 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/history"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SetHistory gives scripts access to the performance history db through
+// panapi.PathHistory and panapi.InterfaceHistory. Without it, nothing is
+// known about any path.
+func (s *State) SetHistory(db *history.DB) {
+	s.Lock()
+	defer s.Unlock()
+	s.history = db
+}
+
+func newLuaHistory(st history.Stats) *lua.LTable {
+	t := &lua.LTable{}
+	t.RawSetString("Samples", lua.LNumber(st.Samples))
+	t.RawSetString("RTTMean", lua.LNumber(st.RTTMean))
+	t.RawSetString("RTTP50", lua.LNumber(st.RTTP50))
+	t.RawSetString("RTTP90", lua.LNumber(st.RTTP90))
+	t.RawSetString("Loss", lua.LNumber(st.Loss))
+	t.RawSetString("Throughput", lua.LNumber(st.Throughput))
+	t.RawSetString("Failures", lua.LNumber(st.Failures))
+	return t
+}
+
+// registerHistory adds PathHistory(fp) and InterfaceHistory(pi) to mod,
+// which return what is known about a path or interface, or nil
+func (s *State) registerHistory(mod map[string]lua.LGFunction) {
+	push := func(L *lua.LState, st history.Stats, ok bool) int {
+		if !ok {
+			L.Push(lua.LNil)
+		} else {
+			L.Push(newLuaHistory(st))
+		}
+		return 1
+	}
+	mod["PathHistory"] = func(L *lua.LState) int {
+		fp := L.CheckString(1)
+		if s.history == nil {
+			return push(L, history.Stats{}, false)
+		}
+		st, ok := s.history.Path(pan.PathFingerprint(fp))
+		return push(L, st, ok)
+	}
+	mod["InterfaceHistory"] = func(L *lua.LState) int {
+		t := L.CheckTable(1)
+		ia, err := pan.ParseIA(t.RawGetString("IA").String())
+		if err != nil {
+			L.ArgError(1, err.Error())
+		}
+		ifid, ok := t.RawGetString("IfID").(lua.LNumber)
+		if !ok {
+			L.ArgError(1, "IfID expected")
+		}
+		if s.history == nil {
+			return push(L, history.Stats{}, false)
+		}
+		st, found := s.history.Interface(pan.PathInterface{IA: ia, IfID: pan.IfID(ifid)})
+		return push(L, st, found)
+	}
+}
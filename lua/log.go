@@ -0,0 +1,74 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"sort"
+
+	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
+)
+
+// registerLogging adds panapi.Debug, Info, Warn, Error and the older Log to
+// the panapi module. Each takes a message and an optional table of fields.
+func (s *State) registerLogging(mod map[string]lua.LGFunction) {
+	level := func(log func(*zap.SugaredLogger, string, ...interface{})) lua.LGFunction {
+		return func(L *lua.LState) int {
+			msg := L.CheckString(1)
+			kv := s.logContext()
+			if t := L.OptTable(2, nil); t != nil {
+				kv = append(kv, luaFields(t)...)
+			}
+			log(s.log.Named("script"), msg, kv...)
+			return 0
+		}
+	}
+	mod["Debug"] = level((*zap.SugaredLogger).Debugw)
+	mod["Info"] = level((*zap.SugaredLogger).Infow)
+	mod["Warn"] = level((*zap.SugaredLogger).Warnw)
+	mod["Error"] = level((*zap.SugaredLogger).Errorw)
+
+	mod["Log"] = func(L *lua.LState) int {
+		msg := ""
+		for i := 1; i <= L.GetTop(); i++ {
+			msg += L.Get(i).String() + " "
+		}
+		s.log.Named("script").Infow(msg, s.logContext()...)
+		return 0
+	}
+}
+
+// luaFields turns a table into alternating keys and values, sorted by key
+func luaFields(t *lua.LTable) []interface{} {
+	var keys []string
+	values := map[string]interface{}{}
+	t.ForEach(func(k, v lua.LValue) {
+		key := k.String()
+		keys = append(keys, key)
+		switch v := v.(type) {
+		case lua.LNumber:
+			values[key] = float64(v)
+		case lua.LBool:
+			values[key] = bool(v)
+		default:
+			values[key] = v.String()
+		}
+	})
+	sort.Strings(keys)
+	kv := make([]interface{}, 0, 2*len(keys))
+	for _, k := range keys {
+		kv = append(kv, k, values[k])
+	}
+	return kv
+}
@@ -14,27 +14,53 @@
 package lua
 
 import (
-	//"io/ioutil"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/netsys-lab/pan-lua/history"
+	"github.com/netsys-lab/pan-lua/logger"
+	"github.com/netsys-lab/pan-lua/probe"
+	"github.com/netsys-lab/pan-lua/rpc"
 	lua "github.com/yuin/gopher-lua"
+	"go.uber.org/zap"
 )
 
+// CallObserver gets informed about the duration and outcome of every call
+// into the script, fn is the qualified name of the function (e.g.
+// "panapi.Path")
+type CallObserver func(fn string, d time.Duration, err error)
+
 type State struct {
 	*lua.LState
 	sync.Mutex
-	*log.Logger
+	log      *zap.SugaredLogger
+	script   string
+	observer CallObserver
+	metrics  ScriptMetrics
+	timeout  time.Duration
+	health   *rpc.InterfaceHealth
+	history  *history.DB
+	prober   probe.Prober
+	// the connection the current call into the script is about, attached
+	// to the log messages of the script
+	local, remote fmt.Stringer
 }
 
 func NewState() *State {
 	L := lua.NewState()
-	//l := log.New(ioutil.Discard, "lua ", log.Ltime)
-	l := log.Default()
-	l.SetFlags(log.Ltime | log.Lshortfile)
-	l.SetPrefix("lua ")
-	return &State{L, sync.Mutex{}, l}
+	l := logger.Default().Named("lua").Sugar()
+	return &State{LState: L, log: l}
+}
+
+// SetLogger replaces the logger of the state and of the scripts it runs
+func (s *State) SetLogger(l *zap.Logger) {
+	s.Lock()
+	defer s.Unlock()
+	s.log = l.Sugar()
 }
 
 func (s *State) LoadScript(fname string) error {
@@ -45,8 +71,85 @@ func (s *State) LoadScript(fname string) error {
 	if fn, err := s.Load(file, fname); err != nil {
 		return err
 	} else {
-		s.Printf("loaded selector from file %s", fname)
+		s.log.Infow("loaded script", "file", fname)
+		s.script = fname
 		s.Push(fn)
 		return s.PCall(0, lua.MultRet, nil)
 	}
 }
+
+// Reload executes the most recently loaded script again. Functions and
+// globals defined by the script are replaced, anything the new version of
+// the script does not assign keeps its old value.
+func (s *State) Reload() error {
+	s.Lock()
+	defer s.Unlock()
+	if s.script == "" {
+		return errors.New("no script loaded")
+	}
+	return s.LoadScript(s.script)
+}
+
+// SetTimeout aborts calls into the script that take longer than d, which
+// then fail with rpc.ErrScriptTimeout. Zero, the default, disables the limit.
+func (s *State) SetTimeout(d time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+	s.timeout = d
+}
+
+// SetCallObserver installs o to be informed about all calls into the script
+func (s *State) SetCallObserver(o CallObserver) {
+	s.Lock()
+	defer s.Unlock()
+	s.observer = o
+}
+
+// forConnection attaches the connection to the log messages of the script
+// until the next call into it returns. The caller must hold the lock.
+func (s *State) forConnection(local, remote fmt.Stringer) {
+	s.local, s.remote = local, remote
+}
+
+// logContext returns the fields attached to the log messages of the script
+func (s *State) logContext() []interface{} {
+	if s.local == nil {
+		return nil
+	}
+	return []interface{}{"local", s.local, "remote", s.remote}
+}
+
+// callModule calls function fn of the module table mod in protected mode,
+// expecting nret return values. Errors carry rpc.CodeScriptError or
+// rpc.CodeScriptTimeout. The caller must hold the lock.
+func (s *State) callModule(mod *lua.LTable, name, fn string, nret int, args ...lua.LValue) error {
+	defer s.forConnection(nil, nil)
+	ctx := context.Background()
+	if s.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.timeout)
+		defer cancel()
+		s.SetContext(ctx)
+		defer s.RemoveContext()
+	}
+	start := time.Now()
+	err := s.CallByParam(
+		lua.P{
+			Fn:      mod.RawGetString(fn),
+			NRet:    nret,
+			Protect: true,
+		},
+		args...,
+	)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = rpc.NewError(rpc.CodeScriptTimeout, err)
+		} else {
+			err = rpc.NewError(rpc.CodeScriptError, err)
+		}
+	}
+	if s.observer != nil {
+		s.observer(name+"."+fn, time.Since(start), err)
+	}
+	return err
+}
@@ -0,0 +1,144 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	lua "github.com/yuin/gopher-lua"
+)
+
+type MetricKind int
+
+const (
+	CounterMetric MetricKind = iota
+	GaugeMetric
+	HistogramMetric
+)
+
+func (k MetricKind) String() string {
+	switch k {
+	case CounterMetric:
+		return "counter"
+	case GaugeMetric:
+		return "gauge"
+	case HistogramMetric:
+		return "histogram"
+	}
+	return "unknown"
+}
+
+// ScriptMetrics exports the metrics that scripts define through
+// panapi.Counter, panapi.Gauge and panapi.Histogram
+type ScriptMetrics interface {
+	// Define returns the metric called name, creating it if necessary.
+	// Defining an existing metric again with the same kind and labels
+	// returns the existing metric, so that scripts can be reloaded. Buckets
+	// are only used for histograms, nil means default buckets.
+	Define(kind MetricKind, name string, labels []string, buckets []float64) (ScriptMetric, error)
+}
+
+// ScriptMetric is a metric defined by a script. Labels maps label names to
+// values, labels that are not given are empty.
+type ScriptMetric interface {
+	Add(v float64, labels map[string]string) error
+	Set(v float64, labels map[string]string) error
+	Observe(v float64, labels map[string]string) error
+}
+
+const metricTypeName = "panapi.metric"
+
+// SetScriptMetrics installs m to export the metrics defined by scripts.
+// Without it, metric handles in the script silently discard all updates.
+func (s *State) SetScriptMetrics(m ScriptMetrics) {
+	s.Lock()
+	defer s.Unlock()
+	s.metrics = m
+}
+
+// registerMetrics adds the metric constructors to the panapi module
+func (s *State) registerMetrics(mod map[string]lua.LGFunction) {
+	mt := s.NewTypeMetatable(metricTypeName)
+	s.SetField(mt, "__index", s.SetFuncs(s.NewTable(), map[string]lua.LGFunction{
+		"Inc": func(L *lua.LState) int {
+			return updateMetric(L, ScriptMetric.Add, 1, 2)
+		},
+		"Dec": func(L *lua.LState) int {
+			return updateMetric(L, ScriptMetric.Add, -1, 2)
+		},
+		"Add": func(L *lua.LState) int {
+			return updateMetric(L, ScriptMetric.Add, float64(L.CheckNumber(2)), 3)
+		},
+		"Set": func(L *lua.LState) int {
+			return updateMetric(L, ScriptMetric.Set, float64(L.CheckNumber(2)), 3)
+		},
+		"Observe": func(L *lua.LState) int {
+			return updateMetric(L, ScriptMetric.Observe, float64(L.CheckNumber(2)), 3)
+		},
+	}))
+
+	define := func(kind MetricKind) lua.LGFunction {
+		return func(L *lua.LState) int {
+			name := L.CheckString(1)
+			var labels []string
+			if t := L.OptTable(2, nil); t != nil {
+				t.ForEach(func(_, v lua.LValue) {
+					labels = append(labels, v.String())
+				})
+			}
+			var buckets []float64
+			if t := L.OptTable(3, nil); t != nil && kind == HistogramMetric {
+				t.ForEach(func(_, v lua.LValue) {
+					if n, ok := v.(lua.LNumber); ok {
+						buckets = append(buckets, float64(n))
+					}
+				})
+			}
+
+			ud := L.NewUserData()
+			if s.metrics != nil {
+				m, err := s.metrics.Define(kind, name, labels, buckets)
+				if err != nil {
+					L.RaiseError("%s %s: %s", kind, name, err)
+				}
+				ud.Value = m
+			}
+			L.SetMetatable(ud, L.GetTypeMetatable(metricTypeName))
+			L.Push(ud)
+			return 1
+		}
+	}
+	mod["Counter"] = define(CounterMetric)
+	mod["Gauge"] = define(GaugeMetric)
+	mod["Histogram"] = define(HistogramMetric)
+}
+
+// updateMetric applies op with value v to the metric handle that is the
+// first argument, the label table is expected at index labels
+func updateMetric(L *lua.LState, op func(ScriptMetric, float64, map[string]string) error, v float64, labels int) int {
+	ud := L.CheckUserData(1)
+	m, ok := ud.Value.(ScriptMetric)
+	if !ok {
+		// metrics are disabled
+		return 0
+	}
+	values := map[string]string{}
+	if t := L.OptTable(labels, nil); t != nil {
+		t.ForEach(func(k, v lua.LValue) {
+			values[k.String()] = v.String()
+		})
+	}
+	if err := op(m, v, values); err != nil {
+		L.RaiseError("%s", err)
+	}
+	return 0
+}
@@ -0,0 +1,102 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"errors"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/rpc"
+	"github.com/netsys-lab/pan-lua/selector"
+	"github.com/yuin/gopher-lua"
+)
+
+var ErrInvalidPathSet = errors.New("path set entries must be paths or tables with a Path")
+
+// pathSet schedules the packets of a connection whose script returned a set
+// of paths
+type pathSet struct {
+	scheduler string
+	s         selector.Scheduler
+}
+
+// schedule returns the next path of the set lt returned by the script for the
+// connection to remote. The scheduler of the connection is kept as long as the
+// script sticks to the same kind. The caller must hold the lock.
+func (s *LuaSelector) schedule(remote pan.UDPAddr, lt *lua.LTable) (*pan.Path, error) {
+	set, name, err := s.toPathSet(lt)
+	if err != nil {
+		return nil, rpc.NewError(rpc.CodeScriptError, err)
+	}
+	raddr := remote.String()
+	ps, ok := s.sets[raddr]
+	if !ok || ps.scheduler != name {
+		sched, err := selector.NewScheduler(name, s.clock)
+		if err != nil {
+			return nil, rpc.NewError(rpc.CodeScriptError, err)
+		}
+		ps = &pathSet{name, sched}
+		s.sets[raddr] = ps
+	}
+	if err := ps.s.Update(set); err != nil {
+		return nil, rpc.NewError(rpc.CodeScriptError, err)
+	}
+	return ps.s.Next(), nil
+}
+
+// toPathSet converts a set of paths returned by the script. Entries are paths,
+// weighing 1, or tables with a Path and optionally its Weight, Cap in Kbit/s
+// and RTT in seconds. Paths the selector no longer knows are left out.
+func (s *LuaSelector) toPathSet(lt *lua.LTable) ([]selector.WeightedPath, string, error) {
+	var set []selector.WeightedPath
+	var err error
+	lt.ForEach(func(k, v lua.LValue) {
+		if _, ok := k.(lua.LNumber); !ok || err != nil {
+			return
+		}
+		e, ok := v.(*lua.LTable)
+		if !ok {
+			err = ErrInvalidPathSet
+			return
+		}
+		wp := selector.WeightedPath{Weight: 1}
+		if p, ok := s.ppaths[e]; ok {
+			wp.Path = p
+		} else if lp, ok := e.RawGetString("Path").(*lua.LTable); ok {
+			wp.Path = s.ppaths[lp]
+			wp.Weight = number(e, "Weight", 1)
+			wp.Cap = number(e, "Cap", 0)
+			wp.RTT = time.Duration(number(e, "RTT", 0) * float64(time.Second))
+		} else if e.RawGetString("Fingerprint") != lua.LNil {
+			// a path dropped by a refresh
+			return
+		} else {
+			err = ErrInvalidPathSet
+			return
+		}
+		if wp.Path != nil {
+			set = append(set, wp)
+		}
+	})
+	return set, lua.LVAsString(lt.RawGetString("Scheduler")), err
+}
+
+// number returns the number in field key of t, or def if there is none
+func number(t *lua.LTable, key string, def float64) float64 {
+	if n, ok := t.RawGetString(key).(lua.LNumber); ok {
+		return float64(n)
+	}
+	return def
+}
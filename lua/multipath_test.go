@@ -0,0 +1,80 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua_test
+
+import (
+	"testing"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/pantest"
+)
+
+// spreads the packets across all paths, twice as many on the first
+const spreading = `
+local paths = {}
+function panapi.Initialize(prefs, laddr, raddr, ps) paths[raddr] = ps end
+function panapi.Refresh(laddr, raddr, ps) paths[raddr] = ps end
+function panapi.PathDown(laddr, raddr, fp, pi) end
+function panapi.Path(laddr, raddr)
+	local ps = paths[raddr]
+	if #ps == 1 then return ps[1] end
+	local set = {Scheduler = "WeightedRoundRobin", {Path = ps[1], Weight = 2}}
+	for i = 2, #ps do table.insert(set, ps[i]) end
+	return set
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+`
+
+func TestPathSet(t *testing.T) {
+	h := pantest.NewHarness(t, spreading)
+	paths := pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("via-112"),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:111").Fingerprint("via-113"),
+	)
+	h.Initialize(nil, paths...)
+	for _, fp := range []string{"via-112", "via-113", "via-112", "via-112", "via-113", "via-112"} {
+		h.ExpectPath(pan.PathFingerprint(fp))
+	}
+	h.Refresh(paths[1])
+	h.ExpectPath("via-113")
+	h.ExpectPath("via-113")
+}
+
+// adds refreshed paths to those it already has, keeping the ones that are gone
+const stale = `
+local paths = {}
+function panapi.Initialize(prefs, laddr, raddr, ps) paths[raddr] = ps end
+function panapi.Refresh(laddr, raddr, ps)
+	for _, p in ipairs(ps) do table.insert(paths[raddr], p) end
+end
+function panapi.PathDown(laddr, raddr, fp, pi) end
+function panapi.Path(laddr, raddr) return paths[raddr] end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+`
+
+func TestPathSetSkipsStalePaths(t *testing.T) {
+	h := pantest.NewHarness(t, stale)
+	paths := pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("via-112"),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:111").Fingerprint("via-113"),
+	)
+	h.Initialize(nil, paths...)
+	h.ExpectPath("via-112")
+	h.ExpectPath("via-113")
+	h.Refresh(paths[1])
+	h.ExpectPath("via-113")
+	h.ExpectPath("via-113")
+}
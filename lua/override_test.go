@@ -0,0 +1,87 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/lua"
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// overrideAware sticks to the path an operator last moved it to
+const overrideAware = `
+local paths, pinned = {}, nil
+function panapi.Initialize(prefs, laddr, raddr, ps) paths = ps end
+function panapi.Refresh(laddr, raddr, ps) paths = ps end
+function panapi.PathDown(laddr, raddr, fp, pi) end
+function panapi.Path(laddr, raddr)
+	for _, p in ipairs(paths) do
+		if p.Fingerprint == pinned then return p end
+	end
+	return paths[1]
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+function panapi.Overridden(laddr, raddr, chosen, actual, reason) pinned = actual end
+`
+
+func TestOverriddenThroughMiddleware(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "script.lua")
+	if err := os.WriteFile(name, []byte(overrideAware), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c := clock.NewManual(pantest.Epoch)
+	state := lua.NewState()
+	defer state.Close()
+	script := lua.NewSelector(state, c)
+	if err := state.LoadScript(name); err != nil {
+		t.Fatal(err)
+	}
+	hyst, err := rpc.NewHysteresis(time.Second, 0, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// wrapped as in the daemon
+	sel := rpc.Chain(rpc.PathPolicies(script), hyst.Middleware)
+	sel = rpc.NewInterfaceHealth(time.Minute, c).Middleware(sel)
+	admin := rpc.NewAdminSelector(sel, state.Reload, script)
+
+	local, remote := pantest.Addr("1-ff00:0:110,127.0.0.1:1000"), pantest.Addr("1-ff00:0:111,127.0.0.2:2000")
+	paths := pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:111").Fingerprint("a"),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("b"),
+	)
+	if err := admin.Initialize(nil, local, remote, paths); err != nil {
+		t.Fatal(err)
+	}
+	pin, err := admin.AddOverride(rpc.Override{Kind: rpc.OverridePin, Fingerprint: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := admin.Path(local, remote); p == nil || p.Fingerprint != "b" {
+		t.Fatalf("Path() = %v, want pinned path b", p)
+	}
+	if err := admin.RemoveOverride(pin); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := admin.Path(local, remote); p == nil || p.Fingerprint != "b" {
+		t.Errorf("Path() after unpinning = %v, want b, the script was not told about the pin", p)
+	}
+}
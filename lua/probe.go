@@ -0,0 +1,101 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"github.com/netsys-lab/pan-lua/probe"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// SetProber lets scripts probe paths with panapi.Probe. Without it, probes
+// fail.
+func (s *State) SetProber(p probe.Prober) {
+	s.Lock()
+	defer s.Unlock()
+	s.prober = p
+}
+
+// registerProbe adds Probe(fp [, raddr]) to mod, which probes a path of the
+// connection to raddr, by default the one the current callback is about. It
+// returns true if the probe was sent, or nil and the reason why not. The
+// result is passed to the optional panapi.ProbeResult(laddr, raddr, fp,
+// result) later on.
+func (s *LuaSelector) registerProbe(mod map[string]lua.LGFunction) {
+	mod["ProbeResult"] = func(L *lua.LState) int {
+		return 0
+	}
+	mod["Probe"] = func(L *lua.LState) int {
+		fp := L.CheckString(1)
+		raddr := L.OptString(2, "")
+		if raddr == "" {
+			if s.remote == nil {
+				L.ArgError(2, "remote address expected outside of connection callbacks")
+			}
+			raddr = s.remote.String()
+		}
+		fail := func(msg string) int {
+			L.Push(lua.LNil)
+			L.Push(lua.LString(msg))
+			return 2
+		}
+		conn, ok := s.conns[raddr]
+		if !ok {
+			return fail("unknown connection")
+		}
+		p := s.ppaths[s.lpaths[raddr][fp]]
+		if p == nil {
+			return fail("unknown path")
+		}
+		if s.prober == nil {
+			return fail("no prober")
+		}
+		if err := s.prober.Probe(conn.local, conn.remote, p, func(r probe.Result) {
+			s.probeResult(conn, r)
+		}); err != nil {
+			return fail(err.Error())
+		}
+		L.Push(lua.LTrue)
+		return 1
+	}
+}
+
+// probeResult passes r to the script, unless the connection is gone by now
+func (s *LuaSelector) probeResult(conn addrPair, r probe.Result) {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.conns[conn.remote.String()]; !ok {
+		return
+	}
+	err := s.callFor(conn.local, conn.remote, "ProbeResult", 0,
+		lua.LString(conn.local.String()),
+		lua.LString(conn.remote.String()),
+		lua.LString(r.Fingerprint),
+		newLuaProbeResult(r),
+	)
+	if err != nil {
+		s.log.Errorw("ProbeResult failed", "remote", conn.remote.String(), "fingerprint", r.Fingerprint, "error", err)
+	}
+}
+
+func newLuaProbeResult(r probe.Result) *lua.LTable {
+	t := &lua.LTable{}
+	t.RawSetString("Lost", lua.LBool(r.Lost))
+	if !r.Lost && r.Err == nil {
+		t.RawSetString("RTT", lua.LNumber(r.RTT.Seconds()))
+	}
+	if r.Err != nil {
+		t.RawSetString("Error", lua.LString(r.Err.Error()))
+	}
+	return t
+}
@@ -0,0 +1,62 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/probe"
+)
+
+// probes all paths and sends on the one with the lowest probed RTT
+const probing = `
+local paths, rtts = {}, {}
+function panapi.Initialize(prefs, laddr, raddr, ps)
+	paths[raddr] = ps
+	for _, p in ipairs(ps) do assert(panapi.Probe(p.Fingerprint)) end
+	local ok, err = panapi.Probe("unknown")
+	assert(not ok and err == "unknown path")
+end
+function panapi.Refresh(laddr, raddr, ps) paths[raddr] = ps end
+function panapi.PathDown(laddr, raddr, fp, pi) end
+function panapi.ProbeResult(laddr, raddr, fp, result)
+	if not result.Lost then rtts[fp] = result.RTT end
+end
+function panapi.Path(laddr, raddr)
+	local best
+	for _, p in ipairs(paths[raddr]) do
+		local rtt = rtts[p.Fingerprint]
+		if rtt and (best == nil or rtt < rtts[best.Fingerprint]) then best = p end
+	end
+	return best or paths[raddr][1]
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+`
+
+func TestProbe(t *testing.T) {
+	h := pantest.NewHarness(t, probing)
+	h.State.SetProber(probe.NewFake(probe.MetadataModel, time.Second, h.Clock, 1))
+	h.Initialize(nil, pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("slow").
+			Latency(50*time.Millisecond, time.Millisecond, 50*time.Millisecond),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:111").Fingerprint("fast").
+			Latency(5*time.Millisecond, time.Millisecond, 5*time.Millisecond),
+	)...)
+	h.ExpectPath("slow")
+	h.Advance(100 * time.Millisecond)
+	h.ExpectPath("fast")
+}
@@ -15,11 +15,11 @@ package lua
 
 import (
 	"fmt"
-	"log"
+	"sort"
 	"time"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
-	"github.com/netsys-lab/pan-lua/rpc"
+	"github.com/netsys-lab/pan-lua/clock"
 	"github.com/yuin/gopher-lua"
 )
 
@@ -111,16 +111,23 @@ func lua_table_slice_to_table(s []*lua.LTable) *lua.LTable {
 	return &res
 }
 
+type addrPair struct {
+	local, remote pan.UDPAddr
+}
+
 // help to translate lua to pan pointers back and forth
 type state struct {
 	lpaths map[string]map[string]*lua.LTable
 	ppaths map[*lua.LTable]*pan.Path
+	// the connections the paths belong to, by remote address
+	conns map[string]addrPair
 }
 
 func new_state() state {
 	return state{
 		make(map[string]map[string]*lua.LTable),
 		make(map[*lua.LTable]*pan.Path),
+		make(map[string]addrPair),
 	}
 }
 
@@ -131,7 +138,7 @@ func (s state) get_pan_path(lpath *lua.LTable) *pan.Path {
 func (s state) clear_addr(addr pan.UDPAddr) {
 	raddr := addr.String()
 	for _, lt := range s.lpaths[raddr] {
-		s.ppaths[lt] = nil
+		delete(s.ppaths, lt)
 	}
 	s.lpaths[raddr] = map[string]*lua.LTable{}
 }
@@ -151,14 +158,23 @@ func (s state) set_paths(addr pan.UDPAddr, ppaths []*pan.Path) (lpaths []*lua.LT
 type LuaSelector struct {
 	*State
 	state
-	mod *lua.LTable
-	d   time.Duration
+	mod   *lua.LTable
+	d     time.Duration
+	clock clock.Clock
+	// the connections that were given a set of paths, by remote address
+	sets map[string]*pathSet
 }
 
-// func NewLuaSelector(script string) (*LuaSelector, error) {
-func NewSelector(state *State) rpc.ServerSelector {
+// NewSelector registers the panapi module in state. The clock c drives
+// panapi.Now, panapi.Periodic, timers and the expiry of paths, nil means the
+// wall clock. Advancing a manual clock must not happen while holding the lock
+// of the state, as timers acquire it.
+func NewSelector(state *State, c clock.Clock) *LuaSelector {
 	state.Lock()
 	defer state.Unlock()
+	if c == nil {
+		c = clock.Real
+	}
 
 	mod := map[string]lua.LGFunction{}
 	for _, fn := range []string{
@@ -172,48 +188,102 @@ func NewSelector(state *State) rpc.ServerSelector {
 	} {
 		s := fmt.Sprintf("function %s not implemented in script", fn)
 		mod[fn] = func(L *lua.LState) int {
-			state.Logger.Panic(s)
+			state.log.Panic(s)
 			return 0
 		}
 	}
 
-	mod["Log"] = func(L *lua.LState) int {
-		s := ""
-		for i := 1; i <= L.GetTop(); i++ {
-			s += L.Get(i).String() + " "
-		}
-		state.Println(s)
+	// optional, scripts only implement this if they care about operator
+	// overrides of their path choices
+	mod["Overridden"] = func(L *lua.LState) int {
 		return 0
 	}
 
 	mod["Now"] = func(L *lua.LState) int {
-		L.Push(lua.LNumber(time.Now().UnixMicro()))
+		L.Push(lua.LNumber(c.Now().UnixMicro()))
 		return 1
 	}
 
-	panapi := state.RegisterModule("panapi", mod).(*lua.LTable)
-
-	s := &LuaSelector{state, new_state(), panapi, time.Second}
-
-	go func(s *LuaSelector) {
-		old := time.Now()
-		for {
-			time.Sleep(s.d)
-			s.Lock()
-			seconds := time.Since(old).Seconds()
-			s.CallByParam(
-				lua.P{
-					Protect: true,
-					Fn:      s.mod.RawGetString("Periodic"),
-					NRet:    0,
-				},
-				lua.LNumber(seconds),
+	s := &LuaSelector{
+		State: state,
+		state: new_state(),
+		d:     time.Second,
+		clock: c,
+		sets:  map[string]*pathSet{},
+	}
+
+	state.registerTimers(mod, c)
+	state.registerLogging(mod)
+	state.registerMetrics(mod)
+	state.registerStatistics(mod, c)
+	state.registerHealth(mod)
+	state.registerHistory(mod)
+	state.registerDisjointness(mod)
+	s.registerProbe(mod)
+
+	s.mod = state.RegisterModule("panapi", mod).(*lua.LTable)
+
+	old := c.Now()
+	var periodic func()
+	periodic = func() {
+		s.Lock()
+		now := s.clock.Now()
+		s.expire(now)
+		s.call("Periodic", 0, lua.LNumber(now.Sub(old).Seconds()))
+		old = now
+		s.clock.AfterFunc(s.d, periodic)
+		s.Unlock()
+	}
+	c.AfterFunc(s.d, periodic)
+	return s
+}
+
+// expire reports paths that expired by now to the script via PathDown, with
+// an empty path interface, and forgets about them. The caller must hold the
+// lock.
+func (s *LuaSelector) expire(now time.Time) {
+	raddrs := make([]string, 0, len(s.lpaths))
+	for raddr := range s.lpaths {
+		raddrs = append(raddrs, raddr)
+	}
+	sort.Strings(raddrs)
+	for _, raddr := range raddrs {
+		conn, ok := s.conns[raddr]
+		if !ok {
+			continue
+		}
+		var expired []string
+		for fp, lt := range s.lpaths[raddr] {
+			p := s.ppaths[lt]
+			if p != nil && !p.Expiry.IsZero() && !p.Expiry.After(now) {
+				expired = append(expired, fp)
+			}
+		}
+		sort.Strings(expired)
+		for _, fp := range expired {
+			delete(s.ppaths, s.lpaths[raddr][fp])
+			delete(s.lpaths[raddr], fp)
+			err := s.callFor(conn.local, conn.remote, "PathDown", 0,
+				lua.LString(conn.local.String()),
+				lua.LString(raddr),
+				lua.LString(fp),
+				newLuaPathInterface(pan.PathInterface{}),
 			)
-			old = time.Now()
-			s.Unlock()
+			if err != nil {
+				s.log.Errorw("PathDown for expired path failed", "remote", raddr, "fingerprint", fp, "error", err)
+			}
 		}
-	}(s)
-	return s
+	}
+}
+
+func (s *LuaSelector) call(fn string, nret int, args ...lua.LValue) error {
+	return s.callModule(s.mod, "panapi", fn, nret, args...)
+}
+
+// callFor calls fn on behalf of the connection from local to remote
+func (s *LuaSelector) callFor(local, remote pan.UDPAddr, fn string, nret int, args ...lua.LValue) error {
+	s.forConnection(local, remote)
+	return s.call(fn, nret, args...)
 }
 
 func (s *LuaSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
@@ -225,24 +295,20 @@ func (s *LuaSelector) Initialize(prefs map[string]string, local, remote pan.UDPA
 	//meaning that anything we already know can be flushed
 	s.state.clear_addr(remote)
 	lpaths := s.set_paths(remote, paths)
+	s.conns[remote.String()] = addrPair{local, remote}
 
 	//call the "Initialize" function in the Lua script
 	//with two arguments
 	//and don't expect a return value
 
-	err := s.CallByParam(
-		lua.P{
-			Protect: true,
-			Fn:      s.mod.RawGetString("Initialize"),
-			NRet:    0,
-		},
+	err := s.callFor(local, remote, "Initialize", 0,
 		newLuaPreferences(prefs),
 		lua.LString(local.String()),
 		lua.LString(remote.String()),
 		lua_table_slice_to_table(lpaths),
 	)
 	if err != nil {
-		log.Println(err)
+		s.log.Errorw("Initialize failed", "local", local.String(), "remote", remote.String(), "error", err)
 	}
 	return err
 
@@ -251,10 +317,7 @@ func (s *LuaSelector) SetPreferences(prefs map[string]string, local, remote pan.
 	s.Lock()
 	defer s.Unlock()
 
-	return s.CallByParam(lua.P{
-		Protect: true,
-		Fn:      s.mod.RawGetString("SetPreferences"),
-		NRet:    0},
+	return s.callFor(local, remote, "SetPreferences", 0,
 		newLuaPreferences(prefs),
 		lua.LString(local.String()),
 		lua.LString(remote.String()),
@@ -267,10 +330,7 @@ func (s *LuaSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
 
 	//call the "Path" function from the Lua script
 	//expect 1 return value
-	err := s.CallByParam(lua.P{
-		Protect: true,
-		Fn:      s.mod.RawGetString("Path"),
-		NRet:    1},
+	err := s.callFor(local, remote, "Path", 1,
 		lua.LString(local.String()),
 		lua.LString(remote.String()),
 	)
@@ -280,7 +340,12 @@ func (s *LuaSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
 	lt := s.ToTable(-1)
 	//pop element from the stack
 	s.Pop(1)
-	return s.state.get_pan_path(lt), nil
+	if p := s.state.get_pan_path(lt); p != nil || lt == nil || lt.Len() == 0 {
+		delete(s.sets, remote.String())
+		return p, nil
+	}
+	// a set of paths to spread the packets across
+	return s.schedule(remote, lt)
 }
 
 func (s *LuaSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
@@ -288,12 +353,7 @@ func (s *LuaSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint
 	s.Lock()
 	defer s.Unlock()
 	//s.Printf("PathDown called with fp %v and pi %v", fp, pi)
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("PathDown"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.callFor(local, remote, "PathDown", 0,
 		lua.LString(local.String()),
 		lua.LString(remote.String()),
 		lua.LString(fp),
@@ -303,7 +363,6 @@ func (s *LuaSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint
 }
 
 func (s *LuaSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
-	s.Println("Refresh()")
 	s.Lock()
 	defer s.Unlock()
 
@@ -311,16 +370,12 @@ func (s *LuaSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) erro
 	//meaning that anything we already know can be flushed
 	s.state.clear_addr(remote)
 	lpaths := s.state.set_paths(remote, paths)
+	s.conns[remote.String()] = addrPair{local, remote}
 
 	//call the "setpaths" function in the Lua script
 	//with two arguments
 	//and don't expect a return value
-	return s.CallByParam(
-		lua.P{
-			Protect: true,
-			Fn:      s.mod.RawGetString("Refresh"),
-			NRet:    0,
-		},
+	return s.callFor(local, remote, "Refresh", 0,
 		lua.LString(local.String()),
 		lua.LString(remote.String()),
 		lua_table_slice_to_table(lpaths),
@@ -333,19 +388,28 @@ func (s *LuaSelector) Close(local, remote pan.UDPAddr) error {
 
 	//call the "selectpath" function from the Lua script
 	//expect 1 return value
-	err := s.CallByParam(
-		lua.P{
-			Protect: true,
-			Fn:      s.mod.RawGetString("Close"),
-			NRet:    1,
-		},
+	delete(s.conns, remote.String())
+	delete(s.sets, remote.String())
+	err := s.callFor(local, remote, "Close", 1,
 		lua.LString(local.String()),
 		lua.LString(remote.String()),
 	)
 
 	if err != nil {
-		log.Println("Close called on LuaSelector:", err)
+		s.log.Errorw("Close failed", "local", local.String(), "remote", remote.String(), "error", err)
 	}
 	//s.L.Close()
 	return err
 }
+
+func (s *LuaSelector) Overridden(local, remote pan.UDPAddr, chosen, actual pan.PathFingerprint, reason string) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.callFor(local, remote, "Overridden", 0,
+		lua.LString(local.String()),
+		lua.LString(remote.String()),
+		lua.LString(chosen),
+		lua.LString(actual),
+		lua.LString(reason),
+	)
+}
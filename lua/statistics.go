@@ -0,0 +1,188 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"time"
+
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/stat"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const (
+	ewmaTypeName      = "panapi.ewma"
+	windowTypeName    = "panapi.window"
+	histogramTypeName = "panapi.histogram"
+)
+
+// registerStatistics adds EWMA(alpha), Window(seconds) and Histogram(buckets)
+// to mod, whose objects keep running statistics in Go. Windows follow c.
+// Histogram with a name instead of buckets still defines a metric, so this
+// has to come after registerMetrics.
+func (s *State) registerStatistics(mod map[string]lua.LGFunction, c clock.Clock) {
+	s.registerType(ewmaTypeName, map[string]lua.LGFunction{
+		"Update": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkEWMA(L).Update(float64(L.CheckNumber(2)))))
+			return 1
+		},
+		"Value": func(L *lua.LState) int {
+			return pushOptional(L)(checkEWMA(L).Value())
+		},
+		"Count": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkEWMA(L).Count()))
+			return 1
+		},
+	})
+	s.registerType(windowTypeName, map[string]lua.LGFunction{
+		"Add": func(L *lua.LState) int {
+			checkWindow(L).Add(float64(L.CheckNumber(2)))
+			return 0
+		},
+		"Count": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkWindow(L).Count()))
+			return 1
+		},
+		"Quantile": func(L *lua.LState) int {
+			return pushOptional(L)(checkWindow(L).Quantile(float64(L.CheckNumber(2))))
+		},
+		"P50": func(L *lua.LState) int {
+			return pushOptional(L)(checkWindow(L).Quantile(.5))
+		},
+		"P95": func(L *lua.LState) int {
+			return pushOptional(L)(checkWindow(L).Quantile(.95))
+		},
+		"Min": func(L *lua.LState) int {
+			return pushOptional(L)(checkWindow(L).Min())
+		},
+		"Max": func(L *lua.LState) int {
+			return pushOptional(L)(checkWindow(L).Max())
+		},
+		"Mean": func(L *lua.LState) int {
+			return pushOptional(L)(checkWindow(L).Mean())
+		},
+	})
+	s.registerType(histogramTypeName, map[string]lua.LGFunction{
+		"Observe": func(L *lua.LState) int {
+			checkHistogram(L).Observe(float64(L.CheckNumber(2)))
+			return 0
+		},
+		"Count": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkHistogram(L).Count()))
+			return 1
+		},
+		"Sum": func(L *lua.LState) int {
+			L.Push(lua.LNumber(checkHistogram(L).Sum()))
+			return 1
+		},
+		"Counts": func(L *lua.LState) int {
+			t := L.NewTable()
+			for _, n := range checkHistogram(L).Counts() {
+				t.Append(lua.LNumber(n))
+			}
+			L.Push(t)
+			return 1
+		},
+		"Quantile": func(L *lua.LState) int {
+			return pushOptional(L)(checkHistogram(L).Quantile(float64(L.CheckNumber(2))))
+		},
+		"Reset": func(L *lua.LState) int {
+			checkHistogram(L).Reset()
+			return 0
+		},
+	})
+
+	mod["EWMA"] = func(L *lua.LState) int {
+		e, err := stat.NewEWMA(float64(L.CheckNumber(1)))
+		if err != nil {
+			L.ArgError(1, err.Error())
+		}
+		return pushObject(L, e, ewmaTypeName)
+	}
+	mod["Window"] = func(L *lua.LState) int {
+		w, err := stat.NewWindow(time.Duration(float64(L.CheckNumber(1))*float64(time.Second)), c)
+		if err != nil {
+			L.ArgError(1, err.Error())
+		}
+		return pushObject(L, w, windowTypeName)
+	}
+	metric := mod["Histogram"]
+	mod["Histogram"] = func(L *lua.LState) int {
+		t, ok := L.Get(1).(*lua.LTable)
+		if !ok {
+			return metric(L)
+		}
+		var bounds []float64
+		t.ForEach(func(_, v lua.LValue) {
+			if n, ok := v.(lua.LNumber); ok {
+				bounds = append(bounds, float64(n))
+			}
+		})
+		h, err := stat.NewHistogram(bounds)
+		if err != nil {
+			L.ArgError(1, err.Error())
+		}
+		return pushObject(L, h, histogramTypeName)
+	}
+}
+
+// registerType defines the metatable called name, with methods
+func (s *State) registerType(name string, methods map[string]lua.LGFunction) {
+	mt := s.NewTypeMetatable(name)
+	s.SetField(mt, "__index", s.SetFuncs(s.NewTable(), methods))
+}
+
+func pushObject(L *lua.LState, v interface{}, typeName string) int {
+	ud := L.NewUserData()
+	ud.Value = v
+	L.SetMetatable(ud, L.GetTypeMetatable(typeName))
+	L.Push(ud)
+	return 1
+}
+
+// pushOptional returns a function pushing v, or nil unless ok
+func pushOptional(L *lua.LState) func(v float64, ok bool) int {
+	return func(v float64, ok bool) int {
+		if ok {
+			L.Push(lua.LNumber(v))
+		} else {
+			L.Push(lua.LNil)
+		}
+		return 1
+	}
+}
+
+func checkEWMA(L *lua.LState) *stat.EWMA {
+	e, ok := L.CheckUserData(1).Value.(*stat.EWMA)
+	if !ok {
+		L.ArgError(1, "EWMA expected")
+	}
+	return e
+}
+
+func checkWindow(L *lua.LState) *stat.Window {
+	w, ok := L.CheckUserData(1).Value.(*stat.Window)
+	if !ok {
+		L.ArgError(1, "window expected")
+	}
+	return w
+}
+
+func checkHistogram(L *lua.LState) *stat.Histogram {
+	h, ok := L.CheckUserData(1).Value.(*stat.Histogram)
+	if !ok {
+		L.ArgError(1, "histogram expected")
+	}
+	return h
+}
@@ -0,0 +1,74 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/clock"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const statisticsScript = `
+local e = panapi.EWMA(0.5)
+e:Update(4); e:Update(8)
+ewma = e:Value()
+
+window = panapi.Window(1)
+for i = 1, 100 do window:Add(i) end
+
+local h = panapi.Histogram({0.01, 0.1})
+h:Observe(0.005); h:Observe(0.05); h:Observe(1)
+counts = h:Counts()
+metric = panapi.Histogram("rtt", {}, {0.01})
+`
+
+func TestStatistics(t *testing.T) {
+	c := clock.NewManual(time.Unix(0, 0))
+	state := NewState()
+	NewSelector(state, c)
+	if err := state.DoString(statisticsScript); err != nil {
+		t.Fatal(err)
+	}
+	eval := func(expr string) lua.LValue {
+		t.Helper()
+		if err := state.DoString("result = " + expr); err != nil {
+			t.Fatal(err)
+		}
+		return state.GetGlobal("result")
+	}
+	for expr, want := range map[string]lua.LValue{
+		"ewma":                  lua.LNumber(6),
+		"window:P50()":          lua.LNumber(50),
+		"window:P95()":          lua.LNumber(95),
+		"window:Min()":          lua.LNumber(1),
+		"window:Max()":          lua.LNumber(100),
+		"#counts":               lua.LNumber(3),
+		"counts[3]":             lua.LNumber(1),
+		"type(metric)":          lua.LString("userdata"),
+		"metric.Observe ~= nil": lua.LTrue,
+	} {
+		if got := eval(expr); got != want {
+			t.Errorf("%s = %v, want %v", expr, got, want)
+		}
+	}
+	c.Advance(2 * time.Second)
+	if got := eval("window:P50()"); got != lua.LNil {
+		t.Errorf("window:P50() after the window passed = %v", got)
+	}
+	if err := state.DoString("panapi.EWMA(2)"); err == nil {
+		t.Error("EWMA(2) did not fail")
+	}
+}
@@ -19,6 +19,7 @@ import (
 
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
 	"github.com/netsys-lab/pan-lua/rpc"
 	lua "github.com/yuin/gopher-lua"
 )
@@ -80,9 +81,14 @@ type Stats struct {
 	mod *lua.LTable
 }
 
-func NewStats(state *State) rpc.ServerConnectionTracer {
+// NewStats registers the stats module in state, c drives stats.Now and
+// timers, nil means the wall clock
+func NewStats(state *State, c clock.Clock) rpc.ServerConnectionTracer {
 	state.Lock()
 	defer state.Unlock()
+	if c == nil {
+		c = clock.Real
+	}
 	mod := map[string]lua.LGFunction{}
 	for _, fn := range []string{
 		"TracerForConnection",
@@ -118,21 +124,30 @@ func NewStats(state *State) rpc.ServerConnectionTracer {
 			return 0
 		}
 	}
+	mod["Now"] = func(L *lua.LState) int {
+		L.Push(lua.LNumber(c.Now().UnixMicro()))
+		return 1
+	}
+	state.registerTimers(mod, c)
 
 	stats := state.RegisterModule("stats", mod).(*lua.LTable)
 	return &Stats{state, stats}
 }
 
+func (s *Stats) call(fn string, args ...lua.LValue) error {
+	// all callbacks but TracerForConnection start with the local and
+	// remote address of the connection
+	if fn != "TracerForConnection" && len(args) >= 2 {
+		s.forConnection(args[0], args[1])
+	}
+	return s.callModule(s.mod, "stats", fn, 0, args...)
+}
+
 func (s *Stats) TracerForConnection(tracer_id uint64, p logging.Perspective, odcid logging.ConnectionID) error {
 	//s.Printf("TracerForConnection")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("TracerForConnection"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("TracerForConnection",
 		lua.LNumber(tracer_id),
 		lua.LNumber(p),
 		strhlpr(odcid),
@@ -142,12 +157,7 @@ func (s *Stats) StartedConnection(local, remote *pan.UDPAddr, srcConnID, destCon
 	//s.Printf("StartedConnection")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("StartedConnection"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("StartedConnection",
 		strhlpr(local),
 		strhlpr(remote),
 		strhlpr(srcConnID),
@@ -170,12 +180,7 @@ func (s *Stats) NegotiatedVersion(local, remote *pan.UDPAddr, chosen logging.Ver
 		s_vs.Append(strhlpr(v))
 	}
 
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("NegotiatedVersion"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("NegotiatedVersion",
 		strhlpr(local), strhlpr(remote),
 		strhlpr(chosen),
 		&c_vs,
@@ -187,14 +192,13 @@ func (s *Stats) ClosedConnection(local, remote *pan.UDPAddr, err error) error {
 	//s.Printf("ClosedConnection")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("ClosedConnection"),
-			NRet:    0,
-			Protect: true,
-		},
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	return s.call("ClosedConnection",
 		strhlpr(local), strhlpr(remote),
-		lua.LString(err.Error()),
+		lua.LString(msg),
 	)
 
 }
@@ -202,12 +206,7 @@ func (s *Stats) SentTransportParameters(local, remote *pan.UDPAddr, parameters *
 	//s.Printf("SentTransportParameters")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("SentTransportParameters"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("SentTransportParameters",
 		strhlpr(local), strhlpr(remote),
 		new_lua_parameters(parameters),
 	)
@@ -217,12 +216,7 @@ func (s *Stats) ReceivedTransportParameters(local, remote *pan.UDPAddr, paramete
 	//s.Printf("ReceivedTransportParameters")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("ReceivedTransportParameters"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("ReceivedTransportParameters",
 		strhlpr(local), strhlpr(remote),
 		new_lua_parameters(parameters),
 	)
@@ -232,12 +226,7 @@ func (s *Stats) RestoredTransportParameters(local, remote *pan.UDPAddr, paramete
 	//s.Printf("RestoredTransportParameters")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("RestoredTransportParameters"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("RestoredTransportParameters",
 		strhlpr(local), strhlpr(remote),
 		new_lua_parameters(parameters),
 	)
@@ -247,12 +236,7 @@ func (s *Stats) SentPacket(local, remote *pan.UDPAddr, hdr *logging.ExtendedHead
 	//s.Printf("SentPacket: only stub implementation")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("SentPacket"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("SentPacket",
 		strhlpr(local), strhlpr(remote), lua.LNumber(size),
 	)
 
@@ -266,12 +250,7 @@ func (s *Stats) ReceivedVersionNegotiationPacket(local, remote *pan.UDPAddr, hdr
 		vs.Append(strhlpr(v))
 	}
 
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("ReceivedVersionNegotiationPacket"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("ReceivedVersionNegotiationPacket",
 		strhlpr(local), strhlpr(remote),
 		vs,
 	)
@@ -281,12 +260,7 @@ func (s *Stats) ReceivedRetry(local, remote *pan.UDPAddr, hdr *logging.Header) e
 	//s.Printf("ReceivedRetry: only stub implementation")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("ReceivedRetry"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("ReceivedRetry",
 		strhlpr(local), strhlpr(remote),
 	)
 
@@ -295,12 +269,7 @@ func (s *Stats) ReceivedPacket(local, remote *pan.UDPAddr, hdr *logging.Extended
 	//s.Printf("ReceivedPacket: only stub implementation")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("ReceivedPacket"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("ReceivedPacket",
 		strhlpr(local), strhlpr(remote),
 	)
 
@@ -309,12 +278,7 @@ func (s *Stats) BufferedPacket(local, remote *pan.UDPAddr, ptype logging.PacketT
 	//s.Printf("BufferedPacket")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("BufferedPacket"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("BufferedPacket",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(ptype),
 	)
@@ -324,12 +288,7 @@ func (s *Stats) DroppedPacket(local, remote *pan.UDPAddr, ptype logging.PacketTy
 	//s.Printf("DroppedPacket")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("DroppedPacket"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("DroppedPacket",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(ptype),
 		lua.LNumber(size),
@@ -341,12 +300,7 @@ func (s *Stats) UpdatedMetrics(local, remote *pan.UDPAddr, rttStats *rpc.RTTStat
 	//s.Printf("UpdatedMetrics")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("UpdatedMetrics"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("UpdatedMetrics",
 		strhlpr(local), strhlpr(remote),
 		new_lua_rtt_stats(rttStats),
 		lua.LNumber(cwnd),
@@ -359,12 +313,7 @@ func (s *Stats) AcknowledgedPacket(local, remote *pan.UDPAddr, level logging.Enc
 	//s.Printf("AcknowledgedPacket")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("AcknowledgedPacket"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("AcknowledgedPacket",
 		strhlpr(local), strhlpr(remote),
 		strhlpr(level),
 		lua.LNumber(num),
@@ -375,12 +324,7 @@ func (s *Stats) LostPacket(local, remote *pan.UDPAddr, level logging.EncryptionL
 	//s.Printf("LostPacket")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("LostPacket"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("LostPacket",
 		strhlpr(local), strhlpr(remote),
 		strhlpr(level),
 		lua.LNumber(num),
@@ -392,12 +336,7 @@ func (s *Stats) UpdatedCongestionState(local, remote *pan.UDPAddr, state logging
 	//s.Printf("UpdatedCongestionState")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("UpdatedCongestionState"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("UpdatedCongestionState",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(state),
 	)
@@ -407,12 +346,7 @@ func (s *Stats) UpdatedPTOCount(local, remote *pan.UDPAddr, value uint32) error
 	//s.Printf("UpdatedPTOCount")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("UpdatedPTOCount"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("UpdatedPTOCount",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(value),
 	)
@@ -422,12 +356,7 @@ func (s *Stats) UpdatedKeyFromTLS(local, remote *pan.UDPAddr, level logging.Encr
 	//s.Printf("UpdatedKeyFromTLS")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("UpdatedKeyFromTLS"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("UpdatedKeyFromTLS",
 		strhlpr(local), strhlpr(remote),
 		strhlpr(level),
 		lua.LNumber(p),
@@ -438,12 +367,7 @@ func (s *Stats) UpdatedKey(local, remote *pan.UDPAddr, generation logging.KeyPha
 	//s.Printf("UpdatedKey")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("UpdatedKey"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("UpdatedKey",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(generation),
 		lua.LBool(rmte),
@@ -454,12 +378,7 @@ func (s *Stats) DroppedEncryptionLevel(local, remote *pan.UDPAddr, level logging
 	//s.Printf("DroppedEncryptionLevel")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("DroppedEncryptionLevel"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("DroppedEncryptionLevel",
 		strhlpr(local), strhlpr(remote),
 		strhlpr(level),
 	)
@@ -469,12 +388,7 @@ func (s *Stats) DroppedKey(local, remote *pan.UDPAddr, generation logging.KeyPha
 	//s.Printf("DroppedKey")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("DroppedKey"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("DroppedKey",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(generation),
 	)
@@ -484,12 +398,7 @@ func (s *Stats) SetLossTimer(local, remote *pan.UDPAddr, ttype logging.TimerType
 	//s.Printf("SetLossTimer")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("SetLossTimer"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("SetLossTimer",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(ttype),
 		strhlpr(level),
@@ -501,12 +410,7 @@ func (s *Stats) LossTimerExpired(local, remote *pan.UDPAddr, ttype logging.Timer
 	//s.Printf("LossTimerExpired")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("LossTimerExpired"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("LossTimerExpired",
 		strhlpr(local), strhlpr(remote),
 		lua.LNumber(ttype),
 		strhlpr(level),
@@ -517,12 +421,7 @@ func (s *Stats) LossTimerCanceled(local, remote *pan.UDPAddr) error {
 	//s.Printf("LossTimerCanceled")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("LossTimerCanceled"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("LossTimerCanceled",
 		strhlpr(local), strhlpr(remote),
 	)
 
@@ -531,12 +430,7 @@ func (s *Stats) Close(local, remote *pan.UDPAddr) error {
 	//s.Printf("Close")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("Close"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("Close",
 		strhlpr(local), strhlpr(remote),
 	)
 
@@ -545,12 +439,7 @@ func (s *Stats) Debug(local, remote *pan.UDPAddr, name, msg string) error {
 	//s.Printf("Debug")
 	s.Lock()
 	defer s.Unlock()
-	return s.CallByParam(
-		lua.P{
-			Fn:      s.mod.RawGetString("Debug"),
-			NRet:    0,
-			Protect: true,
-		},
+	return s.call("Debug",
 		strhlpr(local), strhlpr(remote),
 		lua.LString(name),
 		lua.LString(msg),
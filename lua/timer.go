@@ -0,0 +1,56 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package lua
+
+import (
+	"time"
+
+	"github.com/netsys-lab/pan-lua/clock"
+	lua "github.com/yuin/gopher-lua"
+)
+
+const timerTypeName = "timer"
+
+// registerTimers adds After(seconds, fn) to mod, which calls fn once the
+// given number of seconds passed on c. It returns a timer with a Stop method.
+func (s *State) registerTimers(mod map[string]lua.LGFunction, c clock.Clock) {
+	mt := s.NewTypeMetatable(timerTypeName)
+	s.SetField(mt, "__index", s.SetFuncs(s.NewTable(), map[string]lua.LGFunction{
+		"Stop": func(L *lua.LState) int {
+			t, ok := L.CheckUserData(1).Value.(clock.Timer)
+			if !ok {
+				L.ArgError(1, "timer expected")
+			}
+			L.Push(lua.LBool(t.Stop()))
+			return 1
+		},
+	}))
+
+	mod["After"] = func(L *lua.LState) int {
+		d := time.Duration(float64(L.CheckNumber(1)) * float64(time.Second))
+		fn := L.CheckFunction(2)
+		ud := L.NewUserData()
+		ud.Value = c.AfterFunc(d, func() {
+			s.Lock()
+			defer s.Unlock()
+			err := s.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true})
+			if err != nil {
+				s.log.Errorw("timer failed", "error", err)
+			}
+		})
+		L.SetMetatable(ud, L.GetTypeMetatable(timerTypeName))
+		L.Push(ud)
+		return 1
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package metrics exports the daemon's internals as Prometheus metrics
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "panlua"
+
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	rpcCalls      *prometheus.CounterVec
+	rpcDuration   *prometheus.HistogramVec
+	luaDuration   *prometheus.HistogramVec
+	luaErrors     *prometheus.CounterVec
+	connections   prometheus.Gauge
+	pathSwitches  *prometheus.CounterVec
+	smoothedRTT   *prometheus.GaugeVec
+	cwnd          *prometheus.GaugeVec
+	bytesInFlight *prometheus.GaugeVec
+	lostPackets   *prometheus.CounterVec
+
+	script *scriptMetrics
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		rpcCalls: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rpc_calls_total",
+			Help:      "RPC calls handled by the daemon.",
+		}, []string{"service", "method", "result"}),
+		rpcDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "rpc_call_duration_seconds",
+			Help:      "Time spent handling RPC calls.",
+			Buckets:   prometheus.ExponentialBuckets(1e-6, 4, 10),
+		}, []string{"service", "method"}),
+		luaDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "lua_call_duration_seconds",
+			Help:      "Time spent in Lua callbacks.",
+			Buckets:   prometheus.ExponentialBuckets(1e-6, 4, 10),
+		}, []string{"function"}),
+		luaErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lua_call_errors_total",
+			Help:      "Lua callbacks that raised an error.",
+		}, []string{"function"}),
+		connections: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "connections",
+			Help:      "Connections currently known to the path selector.",
+		}),
+		pathSwitches: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "path_switches_total",
+			Help:      "Changes of the selected path, by destination ISD-AS.",
+		}, []string{"destination"}),
+		smoothedRTT: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "quic",
+			Name:      "smoothed_rtt_seconds",
+			Help:      "Smoothed RTT of a QUIC connection.",
+		}, []string{"local", "remote"}),
+		cwnd: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "quic",
+			Name:      "congestion_window_bytes",
+			Help:      "Congestion window of a QUIC connection.",
+		}, []string{"local", "remote"}),
+		bytesInFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "quic",
+			Name:      "bytes_in_flight",
+			Help:      "Bytes in flight on a QUIC connection.",
+		}, []string{"local", "remote"}),
+		lostPackets: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "quic",
+			Name:      "lost_packets_total",
+			Help:      "Packets declared lost on a QUIC connection.",
+		}, []string{"local", "remote"}),
+	}
+	m.Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.rpcCalls,
+		m.rpcDuration,
+		m.luaDuration,
+		m.luaErrors,
+		m.connections,
+		m.pathSwitches,
+		m.smoothedRTT,
+		m.cwnd,
+		m.bytesInFlight,
+		m.lostPackets,
+	)
+	m.script = &scriptMetrics{m: m, metrics: map[string]*scriptMetric{}}
+	return m
+}
+
+// Handler serves the metrics in the Prometheus exposition format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{})
+}
+
+// ListenAndServe serves the metrics under /metrics on addr
+func (m *Metrics) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", m.Handler())
+	return http.ListenAndServe(addr, mux)
+}
+
+// ObserveLuaCall has the signature of lua.CallObserver
+func (m *Metrics) ObserveLuaCall(fn string, d time.Duration, err error) {
+	m.luaDuration.WithLabelValues(fn).Observe(d.Seconds())
+	if err != nil {
+		m.luaErrors.WithLabelValues(fn).Inc()
+	}
+}
+
+func (m *Metrics) observeRPC(service, method string, start time.Time, err *error) {
+	m.rpcDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+	result := "ok"
+	if *err != nil {
+		result = "error"
+	}
+	m.rpcCalls.WithLabelValues(service, method, result).Inc()
+}
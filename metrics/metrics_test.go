@@ -0,0 +1,119 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"testing"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/lua"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// roundRobin hands out its paths in turn
+type roundRobin struct {
+	paths []*pan.Path
+	next  int
+}
+
+func (s *roundRobin) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.paths = paths
+	return nil
+}
+func (s *roundRobin) SetPreferences(map[string]string, pan.UDPAddr, pan.UDPAddr) error {
+	return nil
+}
+func (s *roundRobin) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	p := s.paths[s.next%len(s.paths)]
+	s.next++
+	return p, nil
+}
+func (s *roundRobin) PathDown(pan.UDPAddr, pan.UDPAddr, pan.PathFingerprint, pan.PathInterface) error {
+	return nil
+}
+func (s *roundRobin) Refresh(pan.UDPAddr, pan.UDPAddr, []*pan.Path) error {
+	return nil
+}
+func (s *roundRobin) Close(pan.UDPAddr, pan.UDPAddr) error {
+	return nil
+}
+
+func TestSelectorMetrics(t *testing.T) {
+	m := New()
+	s := m.Selector(&roundRobin{})
+	local := pan.UDPAddr{Port: 1}
+	remote := pan.UDPAddr{IA: pan.MustParseIA("1-ff00:0:110"), Port: 2}
+
+	s.Initialize(nil, local, remote, []*pan.Path{{Fingerprint: "a"}, {Fingerprint: "b"}})
+	if v := testutil.ToFloat64(m.connections); v != 1 {
+		t.Errorf("connections = %v, want 1", v)
+	}
+	for i := 0; i < 4; i++ {
+		s.Path(local, remote)
+	}
+	// a, b, a, b: the first selection is not a switch
+	if v := testutil.ToFloat64(m.pathSwitches.WithLabelValues("1-ff00:0:110")); v != 3 {
+		t.Errorf("path switches = %v, want 3", v)
+	}
+	if v := testutil.ToFloat64(m.rpcCalls.WithLabelValues(selectorService, "Path", "ok")); v != 4 {
+		t.Errorf("Path calls = %v, want 4", v)
+	}
+	s.Close(local, remote)
+	if v := testutil.ToFloat64(m.connections); v != 0 {
+		t.Errorf("connections after Close = %v, want 0", v)
+	}
+}
+
+func TestScriptMetrics(t *testing.T) {
+	m := New()
+	state := lua.NewState()
+	state.SetScriptMetrics(m.Script())
+	lua.NewSelector(state, nil)
+
+	err := state.DoString(`
+		local c = panapi.Counter("decisions_total", {"path"})
+		for i = 1, 200 do
+			c:Inc({path = tostring(i)})
+		end
+		local g = panapi.Gauge("score", {"path"})
+		g:Set(0.5, {path = "a"})
+		panapi.Histogram("rtt_seconds", nil, {0.01, 0.1, 1}):Observe(0.05)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := m.script.metrics["decisions_total"].counter
+	if n := testutil.CollectAndCount(c); n != MaxScriptSeries+1 {
+		t.Errorf("series = %d, want %d", n, MaxScriptSeries+1)
+	}
+	if v := testutil.ToFloat64(c.WithLabelValues(OverflowLabel)); v != 200-MaxScriptSeries {
+		t.Errorf("overflow = %v, want %d", v, 200-MaxScriptSeries)
+	}
+
+	// redefining is fine as long as kind and labels match
+	if err := state.DoString(`panapi.Gauge("score", {"path"})`); err != nil {
+		t.Error(err)
+	}
+	for _, script := range []string{
+		`panapi.Counter("score", {"path"})`,
+		`panapi.Gauge("score", {"path"}):Set(1, {other = "x"})`,
+		`panapi.Counter("decisions_total", {"path"}):Add(-1)`,
+		`panapi.Counter("decisions_total", {"path"}):Inc({path = "other"})`,
+	} {
+		if err := state.DoString(script); err == nil {
+			t.Errorf("%s: expected error", script)
+		}
+	}
+}
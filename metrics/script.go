@@ -0,0 +1,210 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/netsys-lab/pan-lua/lua"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// MaxScriptMetrics limits the number of metrics a script can define
+	MaxScriptMetrics = 64
+	// MaxScriptLabels limits the number of labels of a script metric
+	MaxScriptLabels = 8
+	// MaxScriptSeries limits the number of label value combinations per
+	// script metric, further combinations are counted under OverflowLabel
+	MaxScriptSeries = 128
+	// OverflowLabel is reserved, scripts can not use it as a label value
+	OverflowLabel = "other"
+)
+
+var (
+	ErrTooManyMetrics   = errors.New("too many script metrics")
+	ErrTooManyLabels    = errors.New("too many labels")
+	ErrMetricMismatch   = errors.New("metric already defined with a different kind or labels")
+	ErrUnknownLabel     = errors.New("unknown label")
+	ErrWrongMetricKind  = errors.New("operation not supported by metric kind")
+	ErrNegativeIncrease = errors.New("counters can not decrease")
+	ErrReservedLabel    = errors.New("label value is reserved for the overflow series")
+)
+
+type scriptMetrics struct {
+	m       *Metrics
+	mu      sync.Mutex
+	metrics map[string]*scriptMetric
+}
+
+type scriptMetric struct {
+	kind   lua.MetricKind
+	labels []string
+
+	counter   *prometheus.CounterVec
+	gauge     *prometheus.GaugeVec
+	histogram *prometheus.HistogramVec
+
+	mu       sync.Mutex
+	series   map[string]bool
+	overflow bool
+}
+
+// Script exports the metrics defined by Lua scripts, see
+// lua.State.SetScriptMetrics. They are prefixed with panlua_script_.
+func (m *Metrics) Script() lua.ScriptMetrics {
+	return m.script
+}
+
+func (s *scriptMetrics) Define(kind lua.MetricKind, name string, labels []string, buckets []float64) (lua.ScriptMetric, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if m, ok := s.metrics[name]; ok {
+		if m.kind != kind || strings.Join(m.labels, ",") != strings.Join(labels, ",") {
+			return nil, ErrMetricMismatch
+		}
+		return m, nil
+	}
+	if len(s.metrics) >= MaxScriptMetrics {
+		return nil, ErrTooManyMetrics
+	}
+	if len(labels) > MaxScriptLabels {
+		return nil, ErrTooManyLabels
+	}
+
+	m := &scriptMetric{kind: kind, labels: labels, series: map[string]bool{}}
+	var c prometheus.Collector
+	switch kind {
+	case lua.CounterMetric:
+		m.counter = prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "script",
+			Name:      name,
+			Help:      "Counter defined by the path-selection script.",
+		}, labels)
+		c = m.counter
+	case lua.GaugeMetric:
+		m.gauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Subsystem: "script",
+			Name:      name,
+			Help:      "Gauge defined by the path-selection script.",
+		}, labels)
+		c = m.gauge
+	case lua.HistogramMetric:
+		m.histogram = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "script",
+			Name:      name,
+			Help:      "Histogram defined by the path-selection script.",
+			Buckets:   buckets,
+		}, labels)
+		c = m.histogram
+	default:
+		return nil, fmt.Errorf("unknown metric kind %d", kind)
+	}
+	if err := s.m.Registry.Register(c); err != nil {
+		return nil, err
+	}
+	s.metrics[name] = m
+	return m, nil
+}
+
+// values orders the label values like the labels of the metric, folding
+// them into the overflow series once the series limit is reached
+func (m *scriptMetric) values(labels map[string]string) ([]string, error) {
+	values := make([]string, len(m.labels))
+	for k, v := range labels {
+		i := 0
+		for i < len(m.labels) && m.labels[i] != k {
+			i++
+		}
+		if i == len(m.labels) {
+			return nil, fmt.Errorf("%w %q", ErrUnknownLabel, k)
+		}
+		if v == OverflowLabel {
+			// would silently merge with the overflow series
+			return nil, fmt.Errorf("%w: %q", ErrReservedLabel, v)
+		}
+		values[i] = v
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := strings.Join(values, "\xff")
+	if m.series[key] {
+		return values, nil
+	}
+	if len(m.series) < MaxScriptSeries {
+		m.series[key] = true
+		return values, nil
+	}
+	if !m.overflow {
+		log.Printf("script metric with labels %v exceeds %d series, counting further ones as %q",
+			m.labels, MaxScriptSeries, OverflowLabel)
+		m.overflow = true
+	}
+	for i := range values {
+		values[i] = OverflowLabel
+	}
+	return values, nil
+}
+
+func (m *scriptMetric) Add(v float64, labels map[string]string) error {
+	if m.kind == lua.HistogramMetric {
+		return ErrWrongMetricKind
+	}
+	if m.kind == lua.CounterMetric && v < 0 {
+		return ErrNegativeIncrease
+	}
+	values, err := m.values(labels)
+	if err != nil {
+		return err
+	}
+	if m.counter != nil {
+		m.counter.WithLabelValues(values...).Add(v)
+	} else {
+		m.gauge.WithLabelValues(values...).Add(v)
+	}
+	return nil
+}
+
+func (m *scriptMetric) Set(v float64, labels map[string]string) error {
+	if m.kind != lua.GaugeMetric {
+		return ErrWrongMetricKind
+	}
+	values, err := m.values(labels)
+	if err != nil {
+		return err
+	}
+	m.gauge.WithLabelValues(values...).Set(v)
+	return nil
+}
+
+func (m *scriptMetric) Observe(v float64, labels map[string]string) error {
+	if m.kind != lua.HistogramMetric {
+		return ErrWrongMetricKind
+	}
+	values, err := m.values(labels)
+	if err != nil {
+		return err
+	}
+	m.histogram.WithLabelValues(values...).Observe(v)
+	return nil
+}
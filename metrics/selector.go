@@ -0,0 +1,92 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+const selectorService = "SelectorServer"
+
+type selector struct {
+	m        *Metrics
+	selector rpc.ServerSelector
+	mu       sync.Mutex
+	// currently selected path per connection
+	current map[string]pan.PathFingerprint
+}
+
+// Selector instruments s, counting calls, connections and path switches
+func (m *Metrics) Selector(s rpc.ServerSelector) rpc.ServerSelector {
+	return &selector{m: m, selector: s, current: map[string]pan.PathFingerprint{}}
+}
+
+func (s *selector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) (err error) {
+	defer s.m.observeRPC(selectorService, "Initialize", time.Now(), &err)
+	addr := local.String() + remote.String()
+	s.mu.Lock()
+	if _, ok := s.current[addr]; !ok {
+		s.current[addr] = ""
+		s.m.connections.Set(float64(len(s.current)))
+	}
+	s.mu.Unlock()
+	return s.selector.Initialize(prefs, local, remote, paths)
+}
+
+func (s *selector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) (err error) {
+	defer s.m.observeRPC(selectorService, "SetPreferences", time.Now(), &err)
+	return s.selector.SetPreferences(prefs, local, remote)
+}
+
+func (s *selector) Path(local, remote pan.UDPAddr) (p *pan.Path, err error) {
+	defer s.m.observeRPC(selectorService, "Path", time.Now(), &err)
+	p, err = s.selector.Path(local, remote)
+	if p == nil {
+		return
+	}
+	addr := local.String() + remote.String()
+	s.mu.Lock()
+	old, ok := s.current[addr]
+	if ok && old != p.Fingerprint {
+		s.current[addr] = p.Fingerprint
+		if old != "" {
+			s.m.pathSwitches.WithLabelValues(remote.IA.String()).Inc()
+		}
+	}
+	s.mu.Unlock()
+	return
+}
+
+func (s *selector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) (err error) {
+	defer s.m.observeRPC(selectorService, "PathDown", time.Now(), &err)
+	return s.selector.PathDown(local, remote, fp, pi)
+}
+
+func (s *selector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) (err error) {
+	defer s.m.observeRPC(selectorService, "Refresh", time.Now(), &err)
+	return s.selector.Refresh(local, remote, paths)
+}
+
+func (s *selector) Close(local, remote pan.UDPAddr) (err error) {
+	defer s.m.observeRPC(selectorService, "Close", time.Now(), &err)
+	s.mu.Lock()
+	delete(s.current, local.String()+remote.String())
+	s.m.connections.Set(float64(len(s.current)))
+	s.mu.Unlock()
+	return s.selector.Close(local, remote)
+}
@@ -0,0 +1,194 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package metrics
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+const tracerService = "ConnectionTracerServer"
+
+type connectionTracer struct {
+	m  *Metrics
+	ct rpc.ServerConnectionTracer
+}
+
+// ConnectionTracer instruments ct, counting calls and keeping per-connection
+// QUIC gauges up to date
+func (m *Metrics) ConnectionTracer(ct rpc.ServerConnectionTracer) rpc.ServerConnectionTracer {
+	return &connectionTracer{m, ct}
+}
+
+func connectionLabels(local, remote *pan.UDPAddr) (string, string) {
+	l, r := "", ""
+	if local != nil {
+		l = local.String()
+	}
+	if remote != nil {
+		r = remote.String()
+	}
+	return l, r
+}
+
+func (t *connectionTracer) TracerForConnection(id uint64, p logging.Perspective, odcid logging.ConnectionID) (err error) {
+	defer t.m.observeRPC(tracerService, "TracerForConnection", time.Now(), &err)
+	return t.ct.TracerForConnection(id, p, odcid)
+}
+
+func (t *connectionTracer) StartedConnection(local, remote *pan.UDPAddr, srcConnID, destConnID logging.ConnectionID) (err error) {
+	defer t.m.observeRPC(tracerService, "StartedConnection", time.Now(), &err)
+	return t.ct.StartedConnection(local, remote, srcConnID, destConnID)
+}
+
+func (t *connectionTracer) NegotiatedVersion(local, remote *pan.UDPAddr, chosen logging.VersionNumber, clientVersions, serverVersions []logging.VersionNumber) (err error) {
+	defer t.m.observeRPC(tracerService, "NegotiatedVersion", time.Now(), &err)
+	return t.ct.NegotiatedVersion(local, remote, chosen, clientVersions, serverVersions)
+}
+
+func (t *connectionTracer) ClosedConnection(local, remote *pan.UDPAddr, e error) (err error) {
+	defer t.m.observeRPC(tracerService, "ClosedConnection", time.Now(), &err)
+	return t.ct.ClosedConnection(local, remote, e)
+}
+
+func (t *connectionTracer) SentTransportParameters(local, remote *pan.UDPAddr, parameters *logging.TransportParameters) (err error) {
+	defer t.m.observeRPC(tracerService, "SentTransportParameters", time.Now(), &err)
+	return t.ct.SentTransportParameters(local, remote, parameters)
+}
+
+func (t *connectionTracer) ReceivedTransportParameters(local, remote *pan.UDPAddr, parameters *logging.TransportParameters) (err error) {
+	defer t.m.observeRPC(tracerService, "ReceivedTransportParameters", time.Now(), &err)
+	return t.ct.ReceivedTransportParameters(local, remote, parameters)
+}
+
+func (t *connectionTracer) RestoredTransportParameters(local, remote *pan.UDPAddr, parameters *logging.TransportParameters) (err error) {
+	defer t.m.observeRPC(tracerService, "RestoredTransportParameters", time.Now(), &err)
+	return t.ct.RestoredTransportParameters(local, remote, parameters)
+}
+
+func (t *connectionTracer) SentPacket(local, remote *pan.UDPAddr, hdr *logging.ExtendedHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) (err error) {
+	defer t.m.observeRPC(tracerService, "SentPacket", time.Now(), &err)
+	return t.ct.SentPacket(local, remote, hdr, size, ack, frames)
+}
+
+func (t *connectionTracer) ReceivedVersionNegotiationPacket(local, remote *pan.UDPAddr, hdr *logging.Header, versions []logging.VersionNumber) (err error) {
+	defer t.m.observeRPC(tracerService, "ReceivedVersionNegotiationPacket", time.Now(), &err)
+	return t.ct.ReceivedVersionNegotiationPacket(local, remote, hdr, versions)
+}
+
+func (t *connectionTracer) ReceivedRetry(local, remote *pan.UDPAddr, hdr *logging.Header) (err error) {
+	defer t.m.observeRPC(tracerService, "ReceivedRetry", time.Now(), &err)
+	return t.ct.ReceivedRetry(local, remote, hdr)
+}
+
+func (t *connectionTracer) ReceivedPacket(local, remote *pan.UDPAddr, hdr *logging.ExtendedHeader, size logging.ByteCount, frames []logging.Frame) (err error) {
+	defer t.m.observeRPC(tracerService, "ReceivedPacket", time.Now(), &err)
+	return t.ct.ReceivedPacket(local, remote, hdr, size, frames)
+}
+
+func (t *connectionTracer) BufferedPacket(local, remote *pan.UDPAddr, ptype logging.PacketType) (err error) {
+	defer t.m.observeRPC(tracerService, "BufferedPacket", time.Now(), &err)
+	return t.ct.BufferedPacket(local, remote, ptype)
+}
+
+func (t *connectionTracer) DroppedPacket(local, remote *pan.UDPAddr, ptype logging.PacketType, size logging.ByteCount, reason logging.PacketDropReason) (err error) {
+	defer t.m.observeRPC(tracerService, "DroppedPacket", time.Now(), &err)
+	return t.ct.DroppedPacket(local, remote, ptype, size, reason)
+}
+
+func (t *connectionTracer) UpdatedMetrics(local, remote *pan.UDPAddr, rttStats *rpc.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) (err error) {
+	defer t.m.observeRPC(tracerService, "UpdatedMetrics", time.Now(), &err)
+	l, r := connectionLabels(local, remote)
+	if rttStats != nil {
+		t.m.smoothedRTT.WithLabelValues(l, r).Set(rttStats.SmoothedRTT.Seconds())
+	}
+	t.m.cwnd.WithLabelValues(l, r).Set(float64(cwnd))
+	t.m.bytesInFlight.WithLabelValues(l, r).Set(float64(bytesInFlight))
+	return t.ct.UpdatedMetrics(local, remote, rttStats, cwnd, bytesInFlight, packetsInFlight)
+}
+
+func (t *connectionTracer) AcknowledgedPacket(local, remote *pan.UDPAddr, level logging.EncryptionLevel, num logging.PacketNumber) (err error) {
+	defer t.m.observeRPC(tracerService, "AcknowledgedPacket", time.Now(), &err)
+	return t.ct.AcknowledgedPacket(local, remote, level, num)
+}
+
+func (t *connectionTracer) LostPacket(local, remote *pan.UDPAddr, level logging.EncryptionLevel, num logging.PacketNumber, reason logging.PacketLossReason) (err error) {
+	defer t.m.observeRPC(tracerService, "LostPacket", time.Now(), &err)
+	t.m.lostPackets.WithLabelValues(connectionLabels(local, remote)).Inc()
+	return t.ct.LostPacket(local, remote, level, num, reason)
+}
+
+func (t *connectionTracer) UpdatedCongestionState(local, remote *pan.UDPAddr, state logging.CongestionState) (err error) {
+	defer t.m.observeRPC(tracerService, "UpdatedCongestionState", time.Now(), &err)
+	return t.ct.UpdatedCongestionState(local, remote, state)
+}
+
+func (t *connectionTracer) UpdatedPTOCount(local, remote *pan.UDPAddr, value uint32) (err error) {
+	defer t.m.observeRPC(tracerService, "UpdatedPTOCount", time.Now(), &err)
+	return t.ct.UpdatedPTOCount(local, remote, value)
+}
+
+func (t *connectionTracer) UpdatedKeyFromTLS(local, remote *pan.UDPAddr, level logging.EncryptionLevel, p logging.Perspective) (err error) {
+	defer t.m.observeRPC(tracerService, "UpdatedKeyFromTLS", time.Now(), &err)
+	return t.ct.UpdatedKeyFromTLS(local, remote, level, p)
+}
+
+func (t *connectionTracer) UpdatedKey(local, remote *pan.UDPAddr, generation logging.KeyPhase, rem bool) (err error) {
+	defer t.m.observeRPC(tracerService, "UpdatedKey", time.Now(), &err)
+	return t.ct.UpdatedKey(local, remote, generation, rem)
+}
+
+func (t *connectionTracer) DroppedEncryptionLevel(local, remote *pan.UDPAddr, level logging.EncryptionLevel) (err error) {
+	defer t.m.observeRPC(tracerService, "DroppedEncryptionLevel", time.Now(), &err)
+	return t.ct.DroppedEncryptionLevel(local, remote, level)
+}
+
+func (t *connectionTracer) DroppedKey(local, remote *pan.UDPAddr, generation logging.KeyPhase) (err error) {
+	defer t.m.observeRPC(tracerService, "DroppedKey", time.Now(), &err)
+	return t.ct.DroppedKey(local, remote, generation)
+}
+
+func (t *connectionTracer) SetLossTimer(local, remote *pan.UDPAddr, ttype logging.TimerType, level logging.EncryptionLevel, when time.Time) (err error) {
+	defer t.m.observeRPC(tracerService, "SetLossTimer", time.Now(), &err)
+	return t.ct.SetLossTimer(local, remote, ttype, level, when)
+}
+
+func (t *connectionTracer) LossTimerExpired(local, remote *pan.UDPAddr, ttype logging.TimerType, level logging.EncryptionLevel) (err error) {
+	defer t.m.observeRPC(tracerService, "LossTimerExpired", time.Now(), &err)
+	return t.ct.LossTimerExpired(local, remote, ttype, level)
+}
+
+func (t *connectionTracer) LossTimerCanceled(local, remote *pan.UDPAddr) (err error) {
+	defer t.m.observeRPC(tracerService, "LossTimerCanceled", time.Now(), &err)
+	return t.ct.LossTimerCanceled(local, remote)
+}
+
+// Close drops the per-connection series, so that they do not accumulate
+func (t *connectionTracer) Close(local, remote *pan.UDPAddr) (err error) {
+	defer t.m.observeRPC(tracerService, "Close", time.Now(), &err)
+	l, r := connectionLabels(local, remote)
+	t.m.smoothedRTT.DeleteLabelValues(l, r)
+	t.m.cwnd.DeleteLabelValues(l, r)
+	t.m.bytesInFlight.DeleteLabelValues(l, r)
+	t.m.lostPackets.DeleteLabelValues(l, r)
+	return t.ct.Close(local, remote)
+}
+
+func (t *connectionTracer) Debug(local, remote *pan.UDPAddr, name, msg string) (err error) {
+	defer t.m.observeRPC(tracerService, "Debug", time.Now(), &err)
+	return t.ct.Debug(local, remote, name, msg)
+}
@@ -0,0 +1,71 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pantest
+
+import (
+	"context"
+	"net"
+	netrpc "net/rpc"
+	"testing"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsys-lab/pan-lua/rpc"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+// Daemon serves a script over RPC in-process, like the daemon does. Clients
+// reach it through a net.Pipe each, and use the same client code as
+// applications. The embedded Harness gives access to the server side.
+type Daemon struct {
+	*Harness
+	Server *netrpc.Server
+}
+
+// NewDaemon starts serving the script source
+func NewDaemon(t testing.TB, script string) *Daemon {
+	t.Helper()
+	h := NewHarness(t, script)
+	server, err := rpc.NewServer(h.Selector, nil, h.Stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Daemon{h, server}
+}
+
+// Dial opens a new client connection to the daemon
+func (d *Daemon) Dial() *rpc.Client {
+	d.T.Helper()
+	client, server := net.Pipe()
+	go d.Server.ServeConn(server)
+	c, err := rpc.NewClient(client)
+	if err != nil {
+		d.T.Fatal(err)
+	}
+	d.T.Cleanup(func() { c.Close() })
+	return c
+}
+
+// NewSelector returns the selector an application would use for a
+// connection, it has a client connection of its own
+func (d *Daemon) NewSelector() selector.Selector {
+	return rpc.NewSelectorClient(d.Dial())
+}
+
+// NewConnectionTracer returns the tracer QUIC would use for the connection
+// with the given tracing id and original destination connection id
+func (d *Daemon) NewConnectionTracer(id uint64, p logging.Perspective, odcid logging.ConnectionID) logging.ConnectionTracer {
+	ctx := context.WithValue(context.Background(), quic.SessionTracingKey, id)
+	return rpc.NewTracerClient(d.Dial()).TracerForConnection(ctx, p, odcid)
+}
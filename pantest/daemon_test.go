@@ -0,0 +1,256 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pantest
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lucas-clemente/quic-go"
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsys-lab/pan-lua/rpc"
+	lua "github.com/yuin/gopher-lua"
+)
+
+// records every callback with its arguments
+const recordingScript = `
+calls = {}
+local function record(...)
+	local args = {...}
+	for i = 1, select("#", ...) do args[i] = tostring(args[i]) end
+	calls[#calls+1] = table.concat(args, " ")
+end
+
+local paths
+function panapi.Initialize(prefs, laddr, raddr, ps)
+	paths = ps
+	record("Initialize", laddr, raddr, #ps, ps[1].Fingerprint, prefs.profile)
+end
+function panapi.SetPreferences(prefs, laddr, raddr) record("SetPreferences", laddr, raddr, prefs.profile) end
+function panapi.Path(laddr, raddr) record("Path", laddr, raddr); return paths[#paths] end
+function panapi.PathDown(laddr, raddr, fp, pi) record("PathDown", laddr, raddr, fp, pi.IA, pi.IfID) end
+function panapi.Refresh(laddr, raddr, ps) paths = ps; record("Refresh", laddr, raddr, #ps) end
+function panapi.Close(laddr, raddr) record("panapi.Close", laddr, raddr) end
+function panapi.Periodic(seconds) end
+
+function stats.TracerForConnection(id, p, odcid) record("TracerForConnection", id, p, odcid) end
+function stats.StartedConnection(...) record("StartedConnection", ...) end
+function stats.NegotiatedVersion(laddr, raddr, chosen, cvs, svs)
+	record("NegotiatedVersion", laddr, raddr, chosen, table.concat(cvs, ","), table.concat(svs, ","))
+end
+function stats.ClosedConnection(...) record("ClosedConnection", ...) end
+function stats.SentTransportParameters(laddr, raddr, p) record("SentTransportParameters", laddr, raddr, p.InitialMaxData) end
+function stats.ReceivedTransportParameters(laddr, raddr, p) record("ReceivedTransportParameters", laddr, raddr, p.MaxIdleTimeout) end
+function stats.RestoredTransportParameters(laddr, raddr, p) record("RestoredTransportParameters", laddr, raddr, p.ActiveConnectionIDLimit) end
+function stats.SentPacket(...) record("SentPacket", ...) end
+function stats.ReceivedVersionNegotiationPacket(laddr, raddr, vs)
+	record("ReceivedVersionNegotiationPacket", laddr, raddr, table.concat(vs, ","))
+end
+function stats.ReceivedRetry(...) record("ReceivedRetry", ...) end
+function stats.ReceivedPacket(...) record("ReceivedPacket", ...) end
+function stats.BufferedPacket(...) record("BufferedPacket", ...) end
+function stats.DroppedPacket(...) record("DroppedPacket", ...) end
+function stats.UpdatedMetrics(laddr, raddr, rtt, cwnd, inflight, packets)
+	record("UpdatedMetrics", laddr, raddr, rtt.SmoothedRTT, rtt.MinRTT, cwnd, inflight, packets)
+end
+function stats.AcknowledgedPacket(...) record("AcknowledgedPacket", ...) end
+function stats.LostPacket(...) record("LostPacket", ...) end
+function stats.UpdatedCongestionState(...) record("UpdatedCongestionState", ...) end
+function stats.UpdatedPTOCount(...) record("UpdatedPTOCount", ...) end
+function stats.UpdatedKeyFromTLS(...) record("UpdatedKeyFromTLS", ...) end
+function stats.UpdatedKey(...) record("UpdatedKey", ...) end
+function stats.DroppedEncryptionLevel(...) record("DroppedEncryptionLevel", ...) end
+function stats.DroppedKey(...) record("DroppedKey", ...) end
+function stats.SetLossTimer(...) record("SetLossTimer", ...) end
+function stats.LossTimerExpired(...) record("LossTimerExpired", ...) end
+function stats.LossTimerCanceled(...) record("LossTimerCanceled", ...) end
+function stats.Close(...) record("stats.Close", ...) end
+function stats.Debug(...) record("Debug", ...) end
+`
+
+// TestDaemon drives a connection through the client side of the RPC
+// interface, as an application and QUIC would, and checks what reaches the
+// script
+func TestDaemon(t *testing.T) {
+	d := NewDaemon(t, recordingScript)
+	local, remote := d.Local, d.Remote
+	paths := Paths(
+		NewPath("1-ff00:0:110", "1-ff00:0:111").Fingerprint("direct"),
+		NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("via"),
+	)
+	odcid := logging.ConnectionID{1, 2, 3, 4}
+	src, dst := logging.ConnectionID{5, 6}, logging.ConnectionID{7, 8}
+	params := &logging.TransportParameters{
+		InitialMaxData:          1 << 20,
+		MaxIdleTimeout:          30 * time.Second,
+		ActiveConnectionIDLimit: 4,
+	}
+	hdr := &logging.ExtendedHeader{Header: logging.Header{DestConnectionID: dst}, PacketNumber: 1}
+	rtt := &logging.RTTStats{}
+	rtt.UpdateRTT(20*time.Millisecond, 0, time.Now())
+	lossTime := time.Date(2022, 1, 1, 0, 0, 1, 0, time.UTC)
+
+	sel := d.NewSelector()
+	if err := sel.SetPreferences(map[string]string{"profile": "latency"}); err != nil {
+		t.Fatal(err)
+	}
+	ct := d.NewConnectionTracer(7, logging.PerspectiveClient, odcid)
+	sel.Initialize(local, remote, paths)
+	ct.StartedConnection(local, remote, src, dst)
+	ct.NegotiatedVersion(quic.Version1, []logging.VersionNumber{quic.Version1, quic.VersionDraft29}, []logging.VersionNumber{quic.Version1})
+	ct.SentTransportParameters(params)
+	ct.ReceivedTransportParameters(params)
+	ct.RestoredTransportParameters(params)
+	ct.UpdatedKeyFromTLS(logging.Encryption1RTT, logging.PerspectiveClient)
+	if p := sel.Path(); p != paths[1] {
+		t.Errorf("Path() = %v, want the last path", p)
+	}
+	ct.SentPacket(hdr, 1200, nil, nil)
+	ct.ReceivedPacket(hdr, 1100, nil)
+	ct.UpdatedMetrics(rtt, 12000, 2400, 2)
+	ct.AcknowledgedPacket(logging.Encryption1RTT, 1)
+	ct.LostPacket(logging.Encryption1RTT, 2, logging.PacketLossTimeThreshold)
+	ct.UpdatedCongestionState(logging.CongestionStateRecovery)
+	ct.UpdatedPTOCount(1)
+	ct.SetLossTimer(logging.TimerTypeACK, logging.Encryption1RTT, lossTime)
+	ct.LossTimerExpired(logging.TimerTypeACK, logging.Encryption1RTT)
+	ct.LossTimerCanceled()
+	ct.BufferedPacket(logging.PacketTypeHandshake)
+	ct.DroppedPacket(logging.PacketType1RTT, 100, logging.PacketDropDuplicate)
+	ct.UpdatedKey(1, true)
+	ct.DroppedEncryptionLevel(logging.EncryptionHandshake)
+	ct.DroppedKey(0)
+	ct.ReceivedVersionNegotiationPacket(&hdr.Header, []logging.VersionNumber{quic.VersionDraft29})
+	ct.ReceivedRetry(&hdr.Header)
+	ct.Debug("key", "value")
+	sel.PathDown("via", paths[1].Metadata.Interfaces[1])
+	sel.Refresh(paths[:1])
+	if err := sel.SetPreferences(map[string]string{"profile": "throughput"}); err != nil {
+		t.Fatal(err)
+	}
+	ct.ClosedConnection(errors.New("idle timeout"))
+	ct.Close()
+	if err := sel.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l, r := local.String(), remote.String()
+	want := []string{
+		fmt.Sprintf("TracerForConnection 7 %d %s", logging.PerspectiveClient, odcid),
+		fmt.Sprintf("Initialize %s %s 2 direct latency", l, r),
+		fmt.Sprintf("StartedConnection %s %s %s %s", l, r, src, dst),
+		fmt.Sprintf("NegotiatedVersion %s %s %s %s,%s %s", l, r, quic.Version1, quic.Version1, quic.VersionDraft29, quic.Version1),
+		fmt.Sprintf("SentTransportParameters %s %s 1048576", l, r),
+		fmt.Sprintf("ReceivedTransportParameters %s %s %d", l, r, 30*time.Second),
+		fmt.Sprintf("RestoredTransportParameters %s %s 4", l, r),
+		fmt.Sprintf("UpdatedKeyFromTLS %s %s %s %d", l, r, logging.Encryption1RTT, logging.PerspectiveClient),
+		fmt.Sprintf("Path %s %s", l, r),
+		fmt.Sprintf("SentPacket %s %s 1200", l, r),
+		fmt.Sprintf("ReceivedPacket %s %s", l, r),
+		fmt.Sprintf("UpdatedMetrics %s %s 0.02 0.02 12000 2400 2", l, r),
+		fmt.Sprintf("AcknowledgedPacket %s %s %s 1", l, r, logging.Encryption1RTT),
+		fmt.Sprintf("LostPacket %s %s %s 2 %d", l, r, logging.Encryption1RTT, logging.PacketLossTimeThreshold),
+		fmt.Sprintf("UpdatedCongestionState %s %s %d", l, r, logging.CongestionStateRecovery),
+		fmt.Sprintf("UpdatedPTOCount %s %s 1", l, r),
+		fmt.Sprintf("SetLossTimer %s %s %d %s %s", l, r, logging.TimerTypeACK, logging.Encryption1RTT, lossTime),
+		fmt.Sprintf("LossTimerExpired %s %s %d %s", l, r, logging.TimerTypeACK, logging.Encryption1RTT),
+		fmt.Sprintf("LossTimerCanceled %s %s", l, r),
+		fmt.Sprintf("BufferedPacket %s %s %d", l, r, logging.PacketTypeHandshake),
+		fmt.Sprintf("DroppedPacket %s %s %d 100 %d", l, r, logging.PacketType1RTT, logging.PacketDropDuplicate),
+		fmt.Sprintf("UpdatedKey %s %s 1 true", l, r),
+		fmt.Sprintf("DroppedEncryptionLevel %s %s %s", l, r, logging.EncryptionHandshake),
+		fmt.Sprintf("DroppedKey %s %s 0", l, r),
+		fmt.Sprintf("ReceivedVersionNegotiationPacket %s %s %s", l, r, quic.VersionDraft29),
+		fmt.Sprintf("ReceivedRetry %s %s", l, r),
+		fmt.Sprintf("Debug %s %s key value", l, r),
+		fmt.Sprintf("PathDown %s %s via 1-ff00:0:112 %d", l, r, paths[1].Metadata.Interfaces[1].IfID),
+		fmt.Sprintf("Refresh %s %s 1", l, r),
+		fmt.Sprintf("SetPreferences %s %s throughput", l, r),
+		fmt.Sprintf("ClosedConnection %s %s idle timeout", l, r),
+		fmt.Sprintf("stats.Close %s %s", l, r),
+		fmt.Sprintf("panapi.Close %s %s", l, r),
+	}
+
+	d.State.Lock()
+	var got []string
+	d.State.GetGlobal("calls").(*lua.LTable).ForEach(func(_, v lua.LValue) {
+		got = append(got, v.String())
+	})
+	d.State.Unlock()
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		for i := 0; i < len(got) || i < len(want); i++ {
+			var g, w string
+			if i < len(got) {
+				g = got[i]
+			}
+			if i < len(want) {
+				w = want[i]
+			}
+			if g != w {
+				t.Errorf("callback %d:\n got %q\nwant %q", i, g, w)
+			}
+		}
+	}
+}
+
+const failingScript = `
+local paths, mode
+function panapi.Initialize(prefs, laddr, raddr, ps) paths = ps end
+function panapi.SetPreferences(prefs, laddr, raddr) mode = prefs.mode end
+function panapi.Path(laddr, raddr)
+	if mode == "fail" then error("boom") end
+	if mode == "loop" then while true do end end
+	if mode == "none" then return nil end
+	return paths[1]
+end
+function panapi.Close(laddr, raddr) end
+`
+
+// TestDaemonErrors checks that failures of the script reach the client with
+// their code
+func TestDaemonErrors(t *testing.T) {
+	d := NewDaemon(t, failingScript)
+	d.State.SetTimeout(50 * time.Millisecond)
+	paths := Paths(NewPath("1-ff00:0:110", "1-ff00:0:111"))
+	sel := d.NewSelector().(*rpc.SelectorClient)
+	sel.Initialize(d.Local, d.Remote, paths)
+
+	for _, c := range []struct {
+		mode string
+		want error
+	}{
+		{"", nil},
+		{"none", rpc.ErrNoPath},
+		{"fail", rpc.ErrScript},
+		{"loop", rpc.ErrScriptTimeout},
+	} {
+		if err := sel.SetPreferences(map[string]string{"mode": c.mode}); err != nil {
+			t.Fatal(err)
+		}
+		p := sel.Path()
+		err := sel.Err()
+		if !errors.Is(err, c.want) || (c.want == nil && err != nil) {
+			t.Errorf("mode %q: Err() = %v, want %v", c.mode, err, c.want)
+		}
+		if (p == nil) != (c.want != nil) {
+			t.Errorf("mode %q: Path() = %v", c.mode, p)
+		}
+	}
+	if err := sel.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
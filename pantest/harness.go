@@ -0,0 +1,145 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pantest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/lua"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// Epoch is the time the clock of a harness starts at
+var Epoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Harness runs a path-selection script for a single connection from Local to
+// Remote, under a manual clock. All methods fail the test on errors.
+type Harness struct {
+	T             testing.TB
+	State         *lua.State
+	Selector      rpc.ServerSelector
+	Stats         rpc.ServerConnectionTracer
+	Clock         *clock.Manual
+	Local, Remote pan.UDPAddr
+}
+
+// NewHarness loads the script source into a fresh Lua state
+func NewHarness(t testing.TB, script string) *Harness {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "script.lua")
+	if err := os.WriteFile(name, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return LoadHarness(t, name)
+}
+
+// LoadHarness loads the script file into a fresh Lua state
+func LoadHarness(t testing.TB, file string) *Harness {
+	t.Helper()
+	h := &Harness{
+		T:      t,
+		State:  lua.NewState(),
+		Clock:  clock.NewManual(Epoch),
+		Local:  Addr("1-ff00:0:110,127.0.0.1:1000"),
+		Remote: Addr("1-ff00:0:111,127.0.0.2:2000"),
+	}
+	h.Selector = lua.NewSelector(h.State, h.Clock)
+	h.Stats = lua.NewStats(h.State, h.Clock)
+	if err := h.State.LoadScript(file); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.State.Close)
+	return h
+}
+
+// Use wraps the selector in middleware, such as rpc.PathPolicies, to run the
+// script as the daemon does. Call it before Initialize.
+func (h *Harness) Use(mws ...rpc.Middleware) {
+	h.Selector = rpc.Chain(h.Selector, mws...)
+}
+
+func (h *Harness) Initialize(prefs map[string]string, paths ...*pan.Path) {
+	h.T.Helper()
+	if err := h.Selector.Initialize(prefs, h.Local, h.Remote, paths); err != nil {
+		h.T.Fatalf("Initialize: %v", err)
+	}
+}
+
+func (h *Harness) SetPreferences(prefs map[string]string) {
+	h.T.Helper()
+	if err := h.Selector.SetPreferences(prefs, h.Local, h.Remote); err != nil {
+		h.T.Fatalf("SetPreferences: %v", err)
+	}
+}
+
+func (h *Harness) Refresh(paths ...*pan.Path) {
+	h.T.Helper()
+	if err := h.Selector.Refresh(h.Local, h.Remote, paths); err != nil {
+		h.T.Fatalf("Refresh: %v", err)
+	}
+}
+
+func (h *Harness) PathDown(fp pan.PathFingerprint, intf pan.PathInterface) {
+	h.T.Helper()
+	if err := h.Selector.PathDown(h.Local, h.Remote, fp, intf); err != nil {
+		h.T.Fatalf("PathDown: %v", err)
+	}
+}
+
+func (h *Harness) Close() {
+	h.T.Helper()
+	if err := h.Selector.Close(h.Local, h.Remote); err != nil {
+		h.T.Fatalf("Close: %v", err)
+	}
+}
+
+// Advance moves the clock forward, running Periodic and timers that are due
+func (h *Harness) Advance(d time.Duration) {
+	h.Clock.Advance(d)
+}
+
+// Path returns the path the script selects
+func (h *Harness) Path() *pan.Path {
+	h.T.Helper()
+	p, err := h.Selector.Path(h.Local, h.Remote)
+	if err != nil {
+		h.T.Fatalf("Path: %v", err)
+	}
+	return p
+}
+
+// ExpectPath fails the test unless the script selects the path with
+// fingerprint fp
+func (h *Harness) ExpectPath(fp pan.PathFingerprint) {
+	h.T.Helper()
+	p := h.Path()
+	if p == nil {
+		h.T.Errorf("Path() = none, want %s", fp)
+	} else if p.Fingerprint != fp {
+		h.T.Errorf("Path() = %s, want %s", p.Fingerprint, fp)
+	}
+}
+
+// ExpectNoPath fails the test if the script selects a path
+func (h *Harness) ExpectNoPath() {
+	h.T.Helper()
+	if p := h.Path(); p != nil {
+		h.T.Errorf("Path() = %s, want none", p.Fingerprint)
+	}
+}
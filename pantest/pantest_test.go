@@ -0,0 +1,114 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package pantest
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/rpc"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+func TestPathBuilder(t *testing.T) {
+	expiry := time.Unix(1000, 0)
+	p := NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").
+		Latency(10*time.Millisecond, 0, 20*time.Millisecond).
+		Bandwidth(1000).
+		Geo(At(52.1, 11.6)).
+		Notes("a", "b").
+		Expiry(expiry).
+		Build()
+
+	if p.Source != pan.MustParseIA("1-ff00:0:110") || p.Destination != pan.MustParseIA("1-ff00:0:111") {
+		t.Errorf("path from %s to %s", p.Source, p.Destination)
+	}
+	if fp := "274 272 273 274"; string(p.Fingerprint) != fp {
+		t.Errorf("fingerprint %q, want %q", p.Fingerprint, fp)
+	}
+	md := p.Metadata
+	if len(md.Interfaces) != 4 || len(md.Latency) != 3 || len(md.Bandwidth) != 3 || len(md.Geo) != 4 {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+	if md.Bandwidth[0] != 1000 || md.Bandwidth[2] != 0 || md.Geo[0].Latitude != 52.1 || !p.Expiry.Equal(expiry) {
+		t.Errorf("unexpected metadata %+v", md)
+	}
+
+	q := NewPath().Interfaces("1-ff00:0:110#5", "1-ff00:0:111#6").Fingerprint("q").Build()
+	if q.Fingerprint != "q" || q.Metadata.Interfaces[1] != Interface("1-ff00:0:111#6") || q.Source != p.Source {
+		t.Errorf("unexpected path %+v", q)
+	}
+
+	// interfaces depend on the neighbours, not on the position on the path
+	r := NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:112", "1-ff00:0:111").Build()
+	if r.Metadata.Interfaces[0] == p.Metadata.Interfaces[0] {
+		t.Errorf("paths via different neighbours share %v", r.Metadata.Interfaces[0])
+	}
+	if r.Metadata.Interfaces[4] != p.Metadata.Interfaces[2] || r.Metadata.Interfaces[5] != p.Metadata.Interfaces[3] {
+		t.Errorf("link 1-ff00:0:112-1-ff00:0:111 has interfaces %v and %v", r.Metadata.Interfaces[4:], p.Metadata.Interfaces[2:])
+	}
+}
+
+const lowestLatency = `
+local paths, down = {}, {}
+local function latency(p)
+	local sum = 0
+	for _, l in ipairs(p.Metadata.Latency) do sum = sum + l end
+	return sum
+end
+function panapi.Initialize(prefs, laddr, raddr, ps) paths = ps; down = {} end
+function panapi.Refresh(laddr, raddr, ps) paths = ps; down = {} end
+function panapi.PathDown(laddr, raddr, fp, pi) down[fp] = true end
+function panapi.Path(laddr, raddr)
+	local best
+	for _, p in ipairs(paths) do
+		if not down[p.Fingerprint] and (best == nil or latency(p) < latency(best)) then
+			best = p
+		end
+	end
+	return best
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+`
+
+func TestHarness(t *testing.T) {
+	h := NewHarness(t, lowestLatency)
+	paths := Paths(
+		NewPath("1-ff00:0:110", "1-ff00:0:111").Latency(30*time.Millisecond).Fingerprint("direct"),
+		NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Latency(5*time.Millisecond, 0, 5*time.Millisecond).Fingerprint("via"),
+	)
+	h.Initialize(nil, paths...)
+	h.ExpectPath("via")
+	h.PathDown("via", paths[1].Metadata.Interfaces[1])
+	h.ExpectPath("direct")
+	h.PathDown("direct", paths[0].Metadata.Interfaces[0])
+	h.ExpectNoPath()
+	h.Advance(time.Second)
+	h.Refresh(paths...)
+	h.ExpectPath("via")
+	h.Close()
+}
+
+func TestHarnessUse(t *testing.T) {
+	h := NewHarness(t, lowestLatency)
+	h.Use(rpc.PathPolicies)
+	paths := Paths(
+		NewPath("1-ff00:0:110", "1-ff00:0:111").Latency(30*time.Millisecond).Fingerprint("direct"),
+		NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Latency(5*time.Millisecond, 0, 5*time.Millisecond).Fingerprint("via"),
+	)
+	h.Initialize(map[string]string{selector.PathPolicyKey: `{"acl": ["- 1-ff00:0:112", "+"]}`}, paths...)
+	h.ExpectPath("direct")
+}
@@ -0,0 +1,182 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package pantest helps testing path selection: it builds pan.Path fixtures
+// and runs scripts against them. Like pan.MustParseIA, its builders panic on
+// malformed input.
+package pantest
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// PathBuilder assembles a pan.Path, its methods can be chained
+type PathBuilder struct {
+	path pan.Path
+	md   pan.PathMetadata
+}
+
+// NewPath starts a path through the given ASes, in order. An AS reaches its
+// neighbour through the interface numbered by the lower 16 bits of the
+// neighbour's AS number, so 1-ff00:0:110 connects to 1-ff00:0:111 through
+// 1-ff00:0:110#273 and 1-ff00:0:111#272, whichever path the link is on.
+func NewPath(ias ...string) *PathBuilder {
+	b := &PathBuilder{}
+	b.md.MTU = 1472
+	for i := 0; i+1 < len(ias); i++ {
+		a, z := pan.MustParseIA(ias[i]), pan.MustParseIA(ias[i+1])
+		b.md.Interfaces = append(b.md.Interfaces,
+			pan.PathInterface{IA: a, IfID: pan.IfID(z.A & 0xffff)},
+			pan.PathInterface{IA: z, IfID: pan.IfID(a.A & 0xffff)},
+		)
+	}
+	if len(ias) > 0 {
+		b.path.Source = pan.MustParseIA(ias[0])
+		b.path.Destination = pan.MustParseIA(ias[len(ias)-1])
+	}
+	return b
+}
+
+// Interfaces replaces the interfaces of the path, each given as IA#IfID
+func (b *PathBuilder) Interfaces(ifs ...string) *PathBuilder {
+	b.md.Interfaces = nil
+	for _, s := range ifs {
+		b.md.Interfaces = append(b.md.Interfaces, Interface(s))
+	}
+	if len(b.md.Interfaces) > 0 {
+		b.path.Source = b.md.Interfaces[0].IA
+		b.path.Destination = b.md.Interfaces[len(b.md.Interfaces)-1].IA
+	}
+	return b
+}
+
+// Latency sets the latencies between consecutive interfaces
+func (b *PathBuilder) Latency(ds ...time.Duration) *PathBuilder {
+	b.md.Latency = ds
+	return b
+}
+
+// Bandwidth sets the bandwidths between consecutive interfaces, in Kbit/s
+func (b *PathBuilder) Bandwidth(kbits ...uint64) *PathBuilder {
+	b.md.Bandwidth = kbits
+	return b
+}
+
+// Geo sets the positions of the interfaces, see At
+func (b *PathBuilder) Geo(coords ...pan.GeoCoordinates) *PathBuilder {
+	b.md.Geo = coords
+	return b
+}
+
+func (b *PathBuilder) LinkType(types ...pan.LinkType) *PathBuilder {
+	b.md.LinkType = types
+	return b
+}
+
+func (b *PathBuilder) InternalHops(hops ...uint32) *PathBuilder {
+	b.md.InternalHops = hops
+	return b
+}
+
+func (b *PathBuilder) Notes(notes ...string) *PathBuilder {
+	b.md.Notes = notes
+	return b
+}
+
+func (b *PathBuilder) MTU(mtu uint16) *PathBuilder {
+	b.md.MTU = mtu
+	return b
+}
+
+func (b *PathBuilder) Expiry(t time.Time) *PathBuilder {
+	b.path.Expiry = t
+	return b
+}
+
+// Fingerprint overrides the fingerprint, which defaults to the one pan
+// computes, see the function Fingerprint
+func (b *PathBuilder) Fingerprint(fp string) *PathBuilder {
+	b.path.Fingerprint = pan.PathFingerprint(fp)
+	return b
+}
+
+// Build returns a new path. Latency and bandwidth are padded with zeros, the
+// unknown value, to one entry per link, and geo positions to one entry per
+// interface.
+func (b *PathBuilder) Build() *pan.Path {
+	p := b.path
+	md := b.md.Copy()
+	n := len(md.Interfaces)
+	for n > 0 && len(md.Latency) < n-1 {
+		md.Latency = append(md.Latency, 0)
+	}
+	for n > 0 && len(md.Bandwidth) < n-1 {
+		md.Bandwidth = append(md.Bandwidth, 0)
+	}
+	for len(md.Geo) < n {
+		md.Geo = append(md.Geo, pan.GeoCoordinates{})
+	}
+	p.Metadata = md
+	if p.Fingerprint == "" {
+		p.Fingerprint = Fingerprint(md.Interfaces...)
+	}
+	return &p
+}
+
+// Paths builds all paths of bs
+func Paths(bs ...*PathBuilder) []*pan.Path {
+	paths := make([]*pan.Path, len(bs))
+	for i, b := range bs {
+		paths[i] = b.Build()
+	}
+	return paths
+}
+
+// Fingerprint returns the fingerprint pan gives a path with the given
+// interfaces, the sequence of their IfIDs separated by spaces
+func Fingerprint(ifs ...pan.PathInterface) pan.PathFingerprint {
+	s := make([]string, len(ifs))
+	for i, intf := range ifs {
+		s[i] = strconv.FormatUint(uint64(intf.IfID), 10)
+	}
+	return pan.PathFingerprint(strings.Join(s, " "))
+}
+
+// Interface parses an interface given as IA#IfID
+func Interface(s string) pan.PathInterface {
+	i := strings.LastIndex(s, "#")
+	if i < 0 {
+		panic(fmt.Sprintf("interface %q is not of the form IA#IfID", s))
+	}
+	id, err := strconv.ParseUint(s[i+1:], 10, 64)
+	if err != nil {
+		panic(err)
+	}
+	return pan.PathInterface{IA: pan.MustParseIA(s[:i]), IfID: pan.IfID(id)}
+}
+
+// At returns the coordinates of a position
+func At(lat, lon float32) pan.GeoCoordinates {
+	return pan.GeoCoordinates{Latitude: lat, Longitude: lon}
+}
+
+// Addr parses a SCION UDP address such as 1-ff00:0:110,127.0.0.1:1234
+func Addr(s string) pan.UDPAddr {
+	return pan.MustParseUDPAddr(s)
+}
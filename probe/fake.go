@@ -0,0 +1,74 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package probe
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+// Model returns the RTT of a path and the probability of losing a probe on
+// it
+type Model func(p *pan.Path) (rtt time.Duration, loss float64)
+
+// MetadataModel takes twice the latency in the metadata of a path as its RTT,
+// and loses nothing
+func MetadataModel(p *pan.Path) (time.Duration, float64) {
+	var rtt time.Duration
+	if p.Metadata != nil {
+		for _, l := range p.Metadata.Latency {
+			if l > 0 {
+				rtt += 2 * l
+			}
+		}
+	}
+	return rtt, 0
+}
+
+// Fake answers probes as the model says, under the clock. Lost probes are
+// reported after the timeout.
+type Fake struct {
+	model   Model
+	timeout time.Duration
+	clock   clock.Clock
+	mu      sync.Mutex
+	rand    *rand.Rand
+}
+
+// NewFake returns a prober following model, whose losses are drawn from a
+// random source seeded with seed
+func NewFake(model Model, timeout time.Duration, c clock.Clock, seed int64) *Fake {
+	if c == nil {
+		c = clock.Real
+	}
+	return &Fake{model: model, timeout: timeout, clock: c, rand: rand.New(rand.NewSource(seed))}
+}
+
+func (f *Fake) Probe(local, remote pan.UDPAddr, p *pan.Path, done func(Result)) error {
+	rtt, loss := f.model(p)
+	f.mu.Lock()
+	lost := f.rand.Float64() < loss
+	f.mu.Unlock()
+	r := Result{Fingerprint: p.Fingerprint, RTT: rtt}
+	if lost || rtt > f.timeout {
+		r = Result{Fingerprint: p.Fingerprint, Lost: true}
+		rtt = f.timeout
+	}
+	f.clock.AfterFunc(rtt, func() { done(r) })
+	return nil
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package probe measures paths other than the ones connections currently
+// send on, so that selectors learn about their alternatives
+package probe
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+var ErrRateLimited = errors.New("probe rate limit exceeded")
+
+// Result is the outcome of probing a path
+type Result struct {
+	Fingerprint pan.PathFingerprint
+	// RTT is the round-trip time of the probe, if it was not lost
+	RTT  time.Duration
+	Lost bool
+	// Err is set if the probe could not be sent
+	Err error
+}
+
+// Prober probes paths from local to remote. Probe returns once the probe is
+// on its way and calls done with the result later on, never before Probe
+// returned.
+type Prober interface {
+	Probe(local, remote pan.UDPAddr, p *pan.Path, done func(Result)) error
+}
+
+// Limit allows p at most rate probes per second, with bursts of up to burst
+// probes. Probes beyond that fail with ErrRateLimited.
+func Limit(p Prober, rate float64, burst int, c clock.Clock) Prober {
+	if c == nil {
+		c = clock.Real
+	}
+	return &limited{Prober: p, rate: rate, burst: float64(burst), tokens: float64(burst), clock: c, last: c.Now()}
+}
+
+type limited struct {
+	Prober
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	clock  clock.Clock
+	last   time.Time
+}
+
+func (l *limited) Probe(local, remote pan.UDPAddr, p *pan.Path, done func(Result)) error {
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens < 1 {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+	l.tokens--
+	l.mu.Unlock()
+	return l.Prober.Probe(local, remote, p, done)
+}
@@ -0,0 +1,61 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package probe
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+func TestFake(t *testing.T) {
+	c := clock.NewManual(time.Unix(0, 0))
+	model := func(p *pan.Path) (time.Duration, float64) {
+		if p.Fingerprint == "lossy" {
+			return 10 * time.Millisecond, 1
+		}
+		return MetadataModel(p)
+	}
+	p := Limit(NewFake(model, time.Second, c, 1), 1, 2, c)
+	fast := &pan.Path{Fingerprint: "fast", Metadata: &pan.PathMetadata{Latency: []time.Duration{5 * time.Millisecond}}}
+	lossy := &pan.Path{Fingerprint: "lossy"}
+
+	var results []Result
+	done := func(r Result) { results = append(results, r) }
+	for _, path := range []*pan.Path{fast, lossy} {
+		if err := p.Probe(pan.UDPAddr{}, pan.UDPAddr{}, path, done); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Probe(pan.UDPAddr{}, pan.UDPAddr{}, fast, done); err != ErrRateLimited {
+		t.Errorf("third probe = %v, want %v", err, ErrRateLimited)
+	}
+	if len(results) != 0 {
+		t.Fatalf("results before any time passed: %v", results)
+	}
+
+	c.Advance(10 * time.Millisecond)
+	if len(results) != 1 || results[0] != (Result{Fingerprint: "fast", RTT: 10 * time.Millisecond}) {
+		t.Errorf("results after 10ms = %v", results)
+	}
+	c.Advance(time.Second)
+	if len(results) != 2 || results[1] != (Result{Fingerprint: "lossy", Lost: true}) {
+		t.Errorf("results after the timeout = %v", results)
+	}
+	if err := p.Probe(pan.UDPAddr{}, pan.UDPAddr{}, fast, done); err != nil {
+		t.Errorf("probe a second later = %v", err)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package probe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/scionproto/scion/go/lib/addr"
+	"github.com/scionproto/scion/go/lib/daemon"
+	"github.com/scionproto/scion/go/lib/snet"
+	"github.com/scionproto/scion/go/lib/sock/reliable"
+	"github.com/scionproto/scion/go/pkg/ping"
+)
+
+// ErrNoForwardingPath is the result for paths the SCION daemon does not know
+// (anymore)
+var ErrNoForwardingPath = errors.New("no forwarding path for fingerprint")
+
+// SCMP probes paths with SCMP echo requests to the remote host. As paths
+// passed to selectors come without their forwarding paths, it looks them up
+// at the SCION daemon by their interfaces.
+type SCMP struct {
+	sciond     daemon.Connector
+	dispatcher reliable.Dispatcher
+	timeout    time.Duration
+}
+
+// NewSCMP connects to the SCION daemon and dispatcher of the host, found like
+// pan does, i.e. with SCION_DAEMON_ADDRESS and SCION_DISPATCHER_SOCKET
+func NewSCMP(timeout time.Duration) (*SCMP, error) {
+	address, ok := os.LookupEnv("SCION_DAEMON_ADDRESS")
+	if !ok {
+		address = daemon.DefaultAPIAddress
+	}
+	socket, ok := os.LookupEnv("SCION_DISPATCHER_SOCKET")
+	if !ok {
+		socket = reliable.DefaultDispPath
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	sciond, err := daemon.NewService(address).Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &SCMP{sciond: sciond, dispatcher: reliable.NewDispatcher(socket), timeout: timeout}, nil
+}
+
+func (s *SCMP) Probe(local, remote pan.UDPAddr, p *pan.Path, done func(Result)) error {
+	go func() {
+		r := Result{Fingerprint: p.Fingerprint}
+		r.RTT, r.Lost, r.Err = s.ping(local, remote, p)
+		done(r)
+	}()
+	return nil
+}
+
+func (s *SCMP) ping(local, remote pan.UDPAddr, p *pan.Path) (rtt time.Duration, lost bool, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*s.timeout)
+	defer cancel()
+	sp, err := s.lookup(ctx, p)
+	if err != nil {
+		return 0, false, err
+	}
+	lost = true
+	_, err = ping.Run(ctx, ping.Config{
+		Dispatcher: s.dispatcher,
+		Local:      &snet.UDPAddr{IA: addr.IA(local.IA), Host: &net.UDPAddr{IP: local.IP.IPAddr().IP}},
+		Remote: &snet.UDPAddr{
+			IA:      addr.IA(remote.IA),
+			Path:    sp.Path(),
+			NextHop: sp.UnderlayNextHop(),
+			Host:    &net.UDPAddr{IP: remote.IP.IPAddr().IP, Port: int(remote.Port)},
+		},
+		Attempts: 1,
+		Interval: time.Second,
+		Timeout:  s.timeout,
+		UpdateHandler: func(u ping.Update) {
+			if u.State == ping.Success {
+				rtt, lost = u.RTT, false
+			}
+		},
+	})
+	return rtt, lost, err
+}
+
+// lookup returns the path of the SCION daemon with the interfaces of p
+func (s *SCMP) lookup(ctx context.Context, p *pan.Path) (snet.Path, error) {
+	if p.Metadata == nil {
+		return nil, ErrNoForwardingPath
+	}
+	paths, err := s.sciond.Paths(ctx, addr.IA(p.Destination), addr.IA(p.Source), daemon.PathReqFlags{})
+	if err != nil {
+		return nil, err
+	}
+	for _, sp := range paths {
+		if md := sp.Metadata(); md != nil && same(md.Interfaces, p.Metadata.Interfaces) {
+			return sp, nil
+		}
+	}
+	return nil, ErrNoForwardingPath
+}
+
+func same(a []snet.PathInterface, b []pan.PathInterface) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if pan.IA(a[i].IA) != b[i].IA || pan.IfID(a[i].ID) != b[i].IfID {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,533 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownPath     = &Error{Code: CodeInvalidArgument, Msg: "unknown path fingerprint for connection"}
+	ErrUnknownOverride = &Error{Code: CodeInvalidArgument, Msg: "unknown override"}
+	ErrNoReload        = &Error{Code: CodeInvalidArgument, Msg: "selector does not support reloading"}
+)
+
+// ConnectionInfo is a snapshot of what the daemon knows about a single
+// connection
+type ConnectionInfo struct {
+	ID            int
+	Local, Remote pan.UDPAddr
+	Preferences   map[string]string
+	Paths         []*Path
+	Current       *pan.PathFingerprint
+	Pinned        *pan.PathFingerprint
+	Created       time.Time
+}
+
+type connection struct {
+	id            int
+	local, remote pan.UDPAddr
+	prefs         map[string]string
+	paths         []*pan.Path
+	current       *pan.Path
+	pinned        *pan.Path
+	created       time.Time
+	// fingerprints reported down since the last Initialize or Refresh
+	down map[pan.PathFingerprint]bool
+	// the last override reported to the selector, to avoid repeating it
+	// for every packet
+	reported string
+}
+
+func (c *connection) info() ConnectionInfo {
+	info := ConnectionInfo{
+		ID:          c.id,
+		Local:       c.local,
+		Remote:      c.remote,
+		Preferences: map[string]string{},
+		Paths:       make([]*Path, len(c.paths)),
+		Created:     c.created,
+	}
+	for k, v := range c.prefs {
+		info.Preferences[k] = v
+	}
+	for i, p := range c.paths {
+		info.Paths[i] = NewPathFrom(p)
+	}
+	if c.current != nil {
+		fp := c.current.Fingerprint
+		info.Current = &fp
+	}
+	if c.pinned != nil {
+		fp := c.pinned.Fingerprint
+		info.Pinned = &fp
+	}
+	return info
+}
+
+func (c *connection) path(fp pan.PathFingerprint) *pan.Path {
+	for _, p := range c.paths {
+		if p.Fingerprint == fp {
+			return p
+		}
+	}
+	return nil
+}
+
+func (c *connection) setPaths(paths []*pan.Path) {
+	c.paths = paths
+	c.down = map[pan.PathFingerprint]bool{}
+}
+
+// ServerAdmin is the operator-facing view of the daemon
+type ServerAdmin interface {
+	Connections() []ConnectionInfo
+	SetConnectionPreferences(id int, prefs map[string]string) error
+	Overrides() []Override
+	AddOverride(o Override) (int, error)
+	RemoveOverride(id int) error
+	Reload() error
+}
+
+// AdminSelector wraps a ServerSelector and keeps track of all the
+// connections passing through it, so that operators can inspect and
+// manipulate them at runtime. Overrides added by operators are applied
+// around the wrapped selector: pins are honored without consulting it,
+// exclusions are checked against the path it returns.
+type AdminSelector struct {
+	mu             sync.Mutex
+	selector       ServerSelector
+	observer       OverrideObserver
+	reload         func() error
+	conns          map[string]*connection
+	nextID         int
+	overrides      []*Override
+	nextOverrideID int
+	l              *zap.SugaredLogger
+}
+
+// NewAdminSelector wraps selector. The reload function is invoked by Reload
+// before all known connections are initialized anew, it may be nil if the
+// wrapped selector can not be reloaded. The observer is told about overridden
+// choices, it may be nil. It is passed explicitly, as the selector making the
+// choices is usually wrapped in middleware by the time it gets here.
+func NewAdminSelector(selector ServerSelector, reload func() error, observer OverrideObserver) *AdminSelector {
+	return &AdminSelector{
+		selector:       selector,
+		observer:       observer,
+		reload:         reload,
+		conns:          map[string]*connection{},
+		nextID:         1,
+		nextOverrideID: 1,
+		l:              logger.Default().Named("admin").Sugar(),
+	}
+}
+
+func (s *AdminSelector) getConnection(local, remote pan.UDPAddr) *connection {
+	addr := local.String() + remote.String()
+	c, ok := s.conns[addr]
+	if !ok {
+		c = &connection{
+			id:      s.nextID,
+			local:   local,
+			remote:  remote,
+			prefs:   map[string]string{},
+			created: time.Now(),
+			down:    map[pan.PathFingerprint]bool{},
+		}
+		s.nextID += 1
+		s.conns[addr] = c
+	}
+	return c
+}
+
+func (s *AdminSelector) byID(id int) *connection {
+	for _, c := range s.conns {
+		if c.id == id {
+			return c
+		}
+	}
+	return nil
+}
+
+// activeOverrides drops expired overrides and returns the ones applying to c
+func (s *AdminSelector) activeOverrides(c *connection) []*Override {
+	now := time.Now()
+	var active []*Override
+	kept := s.overrides[:0]
+	for _, o := range s.overrides {
+		if o.expired(now) {
+			s.l.Infow("override expired", "override", o.String())
+			continue
+		}
+		kept = append(kept, o)
+		if c != nil && o.appliesTo(c) {
+			active = append(active, o)
+		}
+	}
+	for i := len(kept); i < len(s.overrides); i++ {
+		s.overrides[i] = nil
+	}
+	s.overrides = kept
+	return active
+}
+
+// pinnedPath returns the path c is pinned to, if any. Pins to paths that are
+// unknown to or down for the connection are ignored.
+func (c *connection) pinnedPath(overrides []*Override) *pan.Path {
+	for _, o := range overrides {
+		if o.Kind != OverridePin || c.down[o.Fingerprint] {
+			continue
+		}
+		if p := c.path(o.Fingerprint); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+func excluded(p *pan.Path, overrides []*Override) *Override {
+	for _, o := range overrides {
+		if o.excludes(p) {
+			return o
+		}
+	}
+	return nil
+}
+
+// report tells the observer, if any, that the choice of the wrapped selector
+// was overridden. Repeated reports of the same override are suppressed.
+func (s *AdminSelector) report(c *connection, chosen, actual pan.PathFingerprint, reason string) {
+	if s.observer == nil {
+		return
+	}
+	s.mu.Lock()
+	key := string(actual) + "|" + reason
+	if c.reported == key {
+		s.mu.Unlock()
+		return
+	}
+	c.reported = key
+	s.mu.Unlock()
+	if err := s.observer.Overridden(c.local, c.remote, chosen, actual, reason); err != nil {
+		s.l.Warnw("reporting override to selector failed", "connection", c.id, "error", err)
+	}
+}
+
+func (s *AdminSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.mu.Lock()
+	c := s.getConnection(local, remote)
+	if prefs != nil {
+		c.prefs = prefs
+	}
+	c.setPaths(paths)
+	s.mu.Unlock()
+	return s.selector.Initialize(prefs, local, remote, paths)
+}
+
+func (s *AdminSelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	s.mu.Lock()
+	s.getConnection(local, remote).prefs = prefs
+	s.mu.Unlock()
+	return s.selector.SetPreferences(prefs, local, remote)
+}
+
+func (s *AdminSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	s.mu.Lock()
+	c := s.getConnection(local, remote)
+	overrides := s.activeOverrides(c)
+	c.pinned = c.pinnedPath(overrides)
+	if pinned := c.pinned; pinned != nil {
+		c.current = pinned
+		s.mu.Unlock()
+		s.report(c, "", pinned.Fingerprint, "pinned")
+		return pinned, nil
+	}
+	s.mu.Unlock()
+
+	p, err := s.selector.Path(local, remote)
+	if err != nil || len(overrides) == 0 {
+		s.mu.Lock()
+		c.current = p
+		c.reported = ""
+		s.mu.Unlock()
+		return p, err
+	}
+
+	s.mu.Lock()
+	actual := p
+	o := excluded(p, overrides)
+	if o != nil {
+		actual = nil
+		for _, alt := range c.paths {
+			if !c.down[alt.Fingerprint] && excluded(alt, overrides) == nil {
+				actual = alt
+				break
+			}
+		}
+		if actual == nil {
+			s.l.Warnw("no path complies with override, keeping the selected one",
+				"connection", c.id, "override", o.String(), "path", p.Fingerprint)
+			actual = p
+		}
+	}
+	c.current = actual
+	if actual == p {
+		c.reported = ""
+	}
+	s.mu.Unlock()
+	if actual != p {
+		s.report(c, p.Fingerprint, actual.Fingerprint, o.String())
+	}
+	return actual, nil
+}
+
+func (s *AdminSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.mu.Lock()
+	s.getConnection(local, remote).down[fp] = true
+	s.mu.Unlock()
+	return s.selector.PathDown(local, remote, fp, pi)
+}
+
+func (s *AdminSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.mu.Lock()
+	s.getConnection(local, remote).setPaths(paths)
+	s.mu.Unlock()
+	return s.selector.Refresh(local, remote, paths)
+}
+
+func (s *AdminSelector) Close(local, remote pan.UDPAddr) error {
+	s.mu.Lock()
+	delete(s.conns, local.String()+remote.String())
+	s.mu.Unlock()
+	return s.selector.Close(local, remote)
+}
+
+// Connections returns a snapshot of all known connections, ordered by ID
+func (s *AdminSelector) Connections() []ConnectionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]ConnectionInfo, 0, len(s.conns))
+	for _, c := range s.conns {
+		infos = append(infos, c.info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
+
+func (s *AdminSelector) SetConnectionPreferences(id int, prefs map[string]string) error {
+	s.mu.Lock()
+	c := s.byID(id)
+	if c == nil {
+		s.mu.Unlock()
+		return ErrUnknownConnection
+	}
+	c.prefs = prefs
+	local, remote := c.local, c.remote
+	s.mu.Unlock()
+	return s.selector.SetPreferences(prefs, local, remote)
+}
+
+// Overrides returns all overrides that have not expired yet
+func (s *AdminSelector) Overrides() []Override {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activeOverrides(nil)
+	overrides := make([]Override, len(s.overrides))
+	for i, o := range s.overrides {
+		overrides[i] = *o
+	}
+	return overrides
+}
+
+// AddOverride adds o to the override table and returns the ID assigned to
+// it. Pins scoped to a single connection are checked against the paths known
+// for that connection.
+func (s *AdminSelector) AddOverride(o Override) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o.Connection != 0 {
+		c := s.byID(o.Connection)
+		if c == nil {
+			return 0, ErrUnknownConnection
+		}
+		if o.Kind == OverridePin && c.path(o.Fingerprint) == nil {
+			return 0, ErrUnknownPath
+		}
+	}
+	o.ID = s.nextOverrideID
+	s.nextOverrideID += 1
+	s.overrides = append(s.overrides, &o)
+	s.l.Infow("override added", "override", o.String())
+	return o.ID, nil
+}
+
+func (s *AdminSelector) RemoveOverride(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, o := range s.overrides {
+		if o.ID == id {
+			s.overrides = append(s.overrides[:i], s.overrides[i+1:]...)
+			s.l.Infow("override removed", "override", o.String())
+			return nil
+		}
+	}
+	return ErrUnknownOverride
+}
+
+// Reload reloads the wrapped selector and hands it all currently known
+// connections again, as if they had just been initialized
+func (s *AdminSelector) Reload() error {
+	if s.reload == nil {
+		return ErrNoReload
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.reload(); err != nil {
+		return err
+	}
+	for _, c := range s.conns {
+		err := s.selector.Initialize(c.prefs, c.local, c.remote, c.paths)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type AdminMsg struct {
+	ID          int
+	Preferences map[string]string
+	Override    *Override
+	Overrides   []Override
+	Connections []ConnectionInfo
+}
+
+// AdminServer is the RPC-facing part of ServerAdmin
+type AdminServer struct {
+	admin ServerAdmin
+}
+
+func NewAdminServer(admin ServerAdmin) *AdminServer {
+	return &AdminServer{admin}
+}
+
+func (s *AdminServer) Connections(args, resp *AdminMsg) error {
+	resp.Connections = s.admin.Connections()
+	return nil
+}
+
+func (s *AdminServer) SetPreferences(args, resp *AdminMsg) error {
+	if args.Preferences == nil {
+		return ErrDeref
+	}
+	return s.admin.SetConnectionPreferences(args.ID, args.Preferences)
+}
+
+func (s *AdminServer) Overrides(args, resp *AdminMsg) error {
+	resp.Overrides = s.admin.Overrides()
+	return nil
+}
+
+func (s *AdminServer) AddOverride(args, resp *AdminMsg) error {
+	if args.Override == nil {
+		return ErrDeref
+	}
+	id, err := s.admin.AddOverride(*args.Override)
+	resp.ID = id
+	return err
+}
+
+func (s *AdminServer) RemoveOverride(args, resp *AdminMsg) error {
+	return s.admin.RemoveOverride(args.ID)
+}
+
+func (s *AdminServer) Reload(args, resp *AdminMsg) error {
+	return s.admin.Reload()
+}
+
+// AdminClient talks to the AdminServer of a running daemon
+type AdminClient struct {
+	client *Client
+}
+
+func NewAdminClient(client *Client) *AdminClient {
+	return &AdminClient{client}
+}
+
+func (c *AdminClient) Connections() ([]ConnectionInfo, error) {
+	msg := AdminMsg{}
+	err := c.client.Call("AdminServer.Connections", &AdminMsg{}, &msg)
+	return msg.Connections, err
+}
+
+func (c *AdminClient) SetConnectionPreferences(id int, prefs map[string]string) error {
+	return c.client.Call("AdminServer.SetPreferences", &AdminMsg{ID: id, Preferences: prefs}, &AdminMsg{})
+}
+
+func (c *AdminClient) Overrides() ([]Override, error) {
+	msg := AdminMsg{}
+	err := c.client.Call("AdminServer.Overrides", &AdminMsg{}, &msg)
+	return msg.Overrides, err
+}
+
+func (c *AdminClient) AddOverride(o Override) (int, error) {
+	msg := AdminMsg{}
+	err := c.client.Call("AdminServer.AddOverride", &AdminMsg{Override: &o}, &msg)
+	return msg.ID, err
+}
+
+func (c *AdminClient) RemoveOverride(id int) error {
+	return c.client.Call("AdminServer.RemoveOverride", &AdminMsg{ID: id}, &AdminMsg{})
+}
+
+// Pin forces connection id onto the path with fingerprint fp, for the
+// duration of ttl or indefinitely if ttl is 0
+func (c *AdminClient) Pin(id int, fp pan.PathFingerprint, ttl time.Duration) (int, error) {
+	o := Override{Kind: OverridePin, Connection: id, Fingerprint: fp}
+	if ttl > 0 {
+		o.Expires = time.Now().Add(ttl)
+	}
+	return c.AddOverride(o)
+}
+
+// Unpin removes all pins scoped to connection id
+func (c *AdminClient) Unpin(id int) error {
+	overrides, err := c.Overrides()
+	if err != nil {
+		return err
+	}
+	for _, o := range overrides {
+		if o.Kind == OverridePin && o.Connection == id {
+			if err := c.RemoveOverride(o.ID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *AdminClient) Reload() error {
+	return c.client.Call("AdminServer.Reload", &AdminMsg{}, &AdminMsg{})
+}
+
+func (c *AdminClient) Close() error {
+	return c.client.Close()
+}
@@ -0,0 +1,118 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+type firstPathSelector struct {
+	paths []*pan.Path
+}
+
+func (s *firstPathSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.paths = paths
+	return nil
+}
+func (s *firstPathSelector) SetPreferences(map[string]string, pan.UDPAddr, pan.UDPAddr) error {
+	return nil
+}
+func (s *firstPathSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	return s.paths[0], nil
+}
+func (s *firstPathSelector) PathDown(pan.UDPAddr, pan.UDPAddr, pan.PathFingerprint, pan.PathInterface) error {
+	return nil
+}
+func (s *firstPathSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.paths = paths
+	return nil
+}
+func (s *firstPathSelector) Close(pan.UDPAddr, pan.UDPAddr) error {
+	return nil
+}
+
+func TestAdminMsgEncoding(t *testing.T) {
+	b := bytes.Buffer{}
+	enc := gob.NewEncoder(&b)
+	msg := AdminMsg{
+		ID:          1,
+		Preferences: map[string]string{"ConnCapacityProfile": "Scavenger"},
+		Override:    &Override{Kind: OverrideExcludeInterface, IfID: 2},
+		Overrides:   []Override{},
+		Connections: []ConnectionInfo{{ID: 1, Paths: []*Path{}}},
+	}
+	err := enc.Encode(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAdminSelectorOverrides(t *testing.T) {
+	ia := pan.MustParseIA("1-ff00:0:110")
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	paths := []*pan.Path{
+		{Fingerprint: "a", Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{{IA: ia, IfID: 1}}}},
+		{Fingerprint: "b", Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{{IA: ia, IfID: 2}}}},
+	}
+	s := NewAdminSelector(&firstPathSelector{}, nil, nil)
+	s.Initialize(nil, local, remote, paths)
+
+	conns := s.Connections()
+	if len(conns) != 1 {
+		t.Fatalf("Connections() = %d connections, want 1", len(conns))
+	}
+	id := conns[0].ID
+	if _, err := s.AddOverride(Override{Kind: OverridePin, Connection: id, Fingerprint: "c"}); err != ErrUnknownPath {
+		t.Errorf("pin unknown fingerprint: err = %v, want %v", err, ErrUnknownPath)
+	}
+	pin, err := s.AddOverride(Override{Kind: OverridePin, Connection: id, Fingerprint: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := s.Path(local, remote); p.Fingerprint != "b" {
+		t.Errorf("Path() = %s, want pinned path b", p.Fingerprint)
+	}
+	s.PathDown(local, remote, "b", pan.PathInterface{})
+	if p, _ := s.Path(local, remote); p.Fingerprint != "a" {
+		t.Errorf("Path() after PathDown = %s, want a", p.Fingerprint)
+	}
+	s.Refresh(local, remote, paths)
+	if err := s.RemoveOverride(pin); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.AddOverride(Override{Kind: OverrideExcludeInterface, IA: ia, IfID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := s.Path(local, remote); p.Fingerprint != "b" {
+		t.Errorf("Path() with a excluded = %s, want b", p.Fingerprint)
+	}
+
+	_, err = s.AddOverride(Override{Kind: OverrideExcludeIA, IA: ia, Expires: time.Now().Add(-time.Second)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(s.Overrides()); n != 1 {
+		t.Errorf("Overrides() = %d overrides, want 1 after expiry", n)
+	}
+	if err := s.RemoveOverride(pin); err != ErrUnknownOverride {
+		t.Errorf("RemoveOverride twice: err = %v, want %v", err, ErrUnknownOverride)
+	}
+}
@@ -16,12 +16,13 @@ package rpc
 import (
 	"errors"
 	"fmt"
-	"log"
 	"net"
 	"time"
 
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/logger"
+	"go.uber.org/zap"
 )
 
 type ServerConnectionTracer interface {
@@ -135,7 +136,7 @@ func (m *ConnectionTracerMsg) String() string {
 
 type ConnectionTracerClient struct {
 	rpc           *Client
-	l             *log.Logger
+	l             *zap.SugaredLogger
 	p             logging.Perspective
 	odcid         logging.ConnectionID
 	tracing_id    uint64
@@ -164,9 +165,7 @@ func NewConnectionTracerClient(client *Client, id uint64, p logging.Perspective,
 		},
 		&NilMsg{},
 	)
-	if err != nil {
-		client.l.Fatalln(err)
-	}
+	client.check("ConnectionTracerServer.NewTracerForConnection", err)
 
 	return &ConnectionTracerClient{client, client.l, p, odcid, id, nil, nil}
 }
@@ -188,9 +187,7 @@ func (c *ConnectionTracerClient) StartedConnection(local, remote net.Addr, srcCo
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.StartedConnection", err)
 }
 func (c *ConnectionTracerClient) NegotiatedVersion(chosen logging.VersionNumber, clientVersions, serverVersions []logging.VersionNumber) {
 	//c.l.Printf("NegotiatedVersion")
@@ -203,9 +200,7 @@ func (c *ConnectionTracerClient) NegotiatedVersion(chosen logging.VersionNumber,
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.NegotiatedVersion", err)
 }
 func (c *ConnectionTracerClient) ClosedConnection(e error) {
 	//c.l.Printf("ClosedConnection")
@@ -216,9 +211,7 @@ func (c *ConnectionTracerClient) ClosedConnection(e error) {
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.ClosedConnection", err)
 }
 func (c *ConnectionTracerClient) SentTransportParameters(parameters *logging.TransportParameters) {
 	//c.l.Printf("SentTransportParameters")
@@ -228,9 +221,7 @@ func (c *ConnectionTracerClient) SentTransportParameters(parameters *logging.Tra
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.SentTransportParameters", err)
 }
 func (c *ConnectionTracerClient) ReceivedTransportParameters(parameters *logging.TransportParameters) {
 	//c.l.Printf("ReceivedTransportParameters")
@@ -240,9 +231,7 @@ func (c *ConnectionTracerClient) ReceivedTransportParameters(parameters *logging
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.ReceivedTransportParameters", err)
 }
 func (c *ConnectionTracerClient) RestoredTransportParameters(parameters *logging.TransportParameters) {
 	//c.l.Printf("RestoredTransportParameters")
@@ -252,9 +241,7 @@ func (c *ConnectionTracerClient) RestoredTransportParameters(parameters *logging
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.RestoredTransportParameters", err)
 }
 func (c *ConnectionTracerClient) SentPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) {
 	//c.l.Printf("SentPacket")
@@ -267,9 +254,7 @@ func (c *ConnectionTracerClient) SentPacket(hdr *logging.ExtendedHeader, size lo
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.SentPacket", err)
 }
 func (c *ConnectionTracerClient) ReceivedVersionNegotiationPacket(hdr *logging.Header, versions []logging.VersionNumber) {
 	//c.l.Printf("ReceivedVersionNegotiationPacket")
@@ -281,9 +266,7 @@ func (c *ConnectionTracerClient) ReceivedVersionNegotiationPacket(hdr *logging.H
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.ReceivedVersionNegotiationPacket", err)
 }
 func (c *ConnectionTracerClient) ReceivedRetry(hdr *logging.Header) {
 	//c.l.Printf("ReceivedRetry")
@@ -293,9 +276,7 @@ func (c *ConnectionTracerClient) ReceivedRetry(hdr *logging.Header) {
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.ReceivedRetry", err)
 }
 func (c *ConnectionTracerClient) ReceivedPacket(hdr *logging.ExtendedHeader, size logging.ByteCount, frames []logging.Frame) {
 	//c.l.Printf("ReceivedPacket")
@@ -307,9 +288,7 @@ func (c *ConnectionTracerClient) ReceivedPacket(hdr *logging.ExtendedHeader, siz
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.ReceivedPacket", err)
 }
 func (c *ConnectionTracerClient) BufferedPacket(ptype logging.PacketType) {
 	//c.l.Printf("BufferedPacket")
@@ -319,9 +298,7 @@ func (c *ConnectionTracerClient) BufferedPacket(ptype logging.PacketType) {
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.BufferedPacket", err)
 }
 func (c *ConnectionTracerClient) DroppedPacket(ptype logging.PacketType, size logging.ByteCount, reason logging.PacketDropReason) {
 	//c.l.Printf("DroppedPacket")
@@ -333,9 +310,7 @@ func (c *ConnectionTracerClient) DroppedPacket(ptype logging.PacketType, size lo
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.DroppedPacket", err)
 }
 func (c *ConnectionTracerClient) UpdatedMetrics(rttStats *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
 	//c.l.Printf("UpdatedMetrics")
@@ -348,9 +323,7 @@ func (c *ConnectionTracerClient) UpdatedMetrics(rttStats *logging.RTTStats, cwnd
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.UpdatedMetrics", err)
 }
 func (c *ConnectionTracerClient) AcknowledgedPacket(level logging.EncryptionLevel, pnum logging.PacketNumber) {
 	//c.l.Printf("AcknowledgedPacket")
@@ -361,9 +334,7 @@ func (c *ConnectionTracerClient) AcknowledgedPacket(level logging.EncryptionLeve
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.AcknowledgedPacket", err)
 }
 func (c *ConnectionTracerClient) LostPacket(level logging.EncryptionLevel, pnum logging.PacketNumber, reason logging.PacketLossReason) {
 	//c.l.Printf("LostPacket")
@@ -375,9 +346,7 @@ func (c *ConnectionTracerClient) LostPacket(level logging.EncryptionLevel, pnum
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.LostPacket", err)
 }
 func (c *ConnectionTracerClient) UpdatedCongestionState(state logging.CongestionState) {
 	msg := c.new_msg()
@@ -387,9 +356,7 @@ func (c *ConnectionTracerClient) UpdatedCongestionState(state logging.Congestion
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.UpdatedCongestionState", err)
 }
 func (c *ConnectionTracerClient) UpdatedPTOCount(value uint32) {
 	//c.l.Printf("UpdatedPTOCount")
@@ -399,9 +366,7 @@ func (c *ConnectionTracerClient) UpdatedPTOCount(value uint32) {
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.UpdatedPTOCount", err)
 }
 func (c *ConnectionTracerClient) UpdatedKeyFromTLS(level logging.EncryptionLevel, p logging.Perspective) {
 	//c.l.Printf("UpdatedKeyFromTLS")
@@ -412,9 +377,7 @@ func (c *ConnectionTracerClient) UpdatedKeyFromTLS(level logging.EncryptionLevel
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.UpdatedKeyFromTLS", err)
 }
 func (c *ConnectionTracerClient) UpdatedKey(generation logging.KeyPhase, remote bool) {
 	//c.l.Printf("UpdatedKey")
@@ -425,9 +388,7 @@ func (c *ConnectionTracerClient) UpdatedKey(generation logging.KeyPhase, remote
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.UpdatedKey", err)
 }
 func (c *ConnectionTracerClient) DroppedEncryptionLevel(level logging.EncryptionLevel) {
 	//c.l.Printf("DroppedEncryptionLevel")
@@ -437,9 +398,7 @@ func (c *ConnectionTracerClient) DroppedEncryptionLevel(level logging.Encryption
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.DroppedEncryptionLevel", err)
 }
 func (c *ConnectionTracerClient) DroppedKey(generation logging.KeyPhase) {
 	//c.l.Printf("DroppedKey")
@@ -449,9 +408,7 @@ func (c *ConnectionTracerClient) DroppedKey(generation logging.KeyPhase) {
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.DroppedKey", err)
 }
 func (c *ConnectionTracerClient) SetLossTimer(ttype logging.TimerType, level logging.EncryptionLevel, t time.Time) {
 	//c.l.Printf("SetLossTimer")
@@ -463,9 +420,7 @@ func (c *ConnectionTracerClient) SetLossTimer(ttype logging.TimerType, level log
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.SetLossTimer", err)
 }
 func (c *ConnectionTracerClient) LossTimerExpired(ttype logging.TimerType, level logging.EncryptionLevel) {
 	//c.l.Printf("LossTimerExpired")
@@ -476,9 +431,7 @@ func (c *ConnectionTracerClient) LossTimerExpired(ttype logging.TimerType, level
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.LossTimerExpired", err)
 }
 func (c *ConnectionTracerClient) LossTimerCanceled() {
 	//c.l.Printf("LossTimerCanceled")
@@ -487,9 +440,7 @@ func (c *ConnectionTracerClient) LossTimerCanceled() {
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.LossTimerCanceled", err)
 }
 func (c *ConnectionTracerClient) Close() {
 	//c.l.Printf("Close")
@@ -498,9 +449,7 @@ func (c *ConnectionTracerClient) Close() {
 		msg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.Close", err)
 }
 func (c *ConnectionTracerClient) Debug(name, msg string) {
 	//c.l.Printf("Debug")
@@ -511,23 +460,24 @@ func (c *ConnectionTracerClient) Debug(name, msg string) {
 		mesg,
 		&NilMsg{},
 	)
-	if err != nil {
-		c.l.Fatalln(err)
-	}
+	c.rpc.check("ConnectionTracerServer.Debug", err)
 }
 
 type NilMsg struct{}
 
 type ConnectionTracerServer struct {
-	l  *log.Logger
+	l  *zap.SugaredLogger
 	ct ServerConnectionTracer
 }
 
 func NewConnectionTracerServer(ct ServerConnectionTracer) *ConnectionTracerServer {
-	return &ConnectionTracerServer{log.Default(), ct}
+	return &ConnectionTracerServer{logger.Default().Named("rpc").Sugar(), ct}
 }
 
 func (c *ConnectionTracerServer) NewTracerForConnection(args *ConnectionTracerMsg, resp *NilMsg) error {
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	if args.OdcID == nil {
 		return ErrDeref
 	}
@@ -538,6 +488,9 @@ func (c *ConnectionTracerServer) NewTracerForConnection(args *ConnectionTracerMs
 
 func (c *ConnectionTracerServer) StartedConnection(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Printf("StartedConnection called: %+v", args)
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	if args.Local == nil || args.Remote == nil || args.SrcConnID == nil || args.DestConnID == nil {
 		return ErrDeref
 	}
@@ -546,11 +499,17 @@ func (c *ConnectionTracerServer) StartedConnection(args *ConnectionTracerMsg, re
 
 func (c *ConnectionTracerServer) NegotiatedVersion(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("NegotiatedVersion called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.NegotiatedVersion(args.Local, args.Remote, args.Chosen, args.ClientVersions, args.ServerVersions)
 }
 
 func (c *ConnectionTracerServer) ClosedConnection(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("ClosedConnection called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	if args.ErrorMsg == nil {
 		return c.ct.ClosedConnection(args.Local, args.Remote, nil)
 	} else {
@@ -560,96 +519,153 @@ func (c *ConnectionTracerServer) ClosedConnection(args *ConnectionTracerMsg, res
 
 func (c *ConnectionTracerServer) SentTransportParameters(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("SentTransportParameters called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.SentTransportParameters(args.Local, args.Remote, args.Parameters)
 }
 
 func (c *ConnectionTracerServer) ReceivedTransportParameters(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("ReceivedTransportParameters called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.ReceivedTransportParameters(args.Local, args.Remote, args.Parameters)
 }
 
 func (c *ConnectionTracerServer) RestoredTransportParameters(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("RestoredTransportParameters called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.RestoredTransportParameters(args.Local, args.Remote, args.Parameters)
 }
 
 func (c *ConnectionTracerServer) SentPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("SentPacket called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.SentPacket(args.Local, args.Remote, args.ExtendedHeader, args.ByteCount, args.AckFrame, args.Frames)
 }
 
 func (c *ConnectionTracerServer) ReceivedVersionNegotiationPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("ReceivedVersionNegotiationPacket called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.ReceivedVersionNegotiationPacket(args.Local, args.Remote, args.Header, args.Versions)
 }
 
 func (c *ConnectionTracerServer) ReceivedRetry(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("ReceivedRetry called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.ReceivedRetry(args.Local, args.Remote, args.Header)
 }
 
 func (c *ConnectionTracerServer) ReceivedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("ReceivedPacket called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.ReceivedPacket(args.Local, args.Remote, args.ExtendedHeader, args.ByteCount, args.Frames)
 }
 
 func (c *ConnectionTracerServer) BufferedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("BufferedPacket called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.BufferedPacket(args.Local, args.Remote, args.PacketType)
 }
 
 func (c *ConnectionTracerServer) DroppedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("DroppedPacket called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.DroppedPacket(args.Local, args.Remote, args.PacketType, args.ByteCount, args.DropReason)
 }
 
 func (c *ConnectionTracerServer) UpdatedMetrics(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("UpdatedMetrics called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.UpdatedMetrics(args.Local, args.Remote, args.RTTStats, args.Cwnd, args.ByteCount, args.Packets)
 }
 
 func (c *ConnectionTracerServer) AcknowledgedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("AcknowledgedPacket called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.AcknowledgedPacket(args.Local, args.Remote, args.EncryptionLevel, args.PacketNumber)
 }
 
 func (c *ConnectionTracerServer) LostPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("LostPacket called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.LostPacket(args.Local, args.Remote, args.EncryptionLevel, args.PacketNumber, args.LossReason)
 }
 
 func (c *ConnectionTracerServer) UpdatedCongestionState(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Printf("UpdatedCongestionState called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.UpdatedCongestionState(args.Local, args.Remote, args.CongestionState)
 }
 
 func (c *ConnectionTracerServer) UpdatedPTOCount(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("UpdatedPTOCount called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.UpdatedPTOCount(args.Local, args.Remote, args.PTOCount)
 }
 
 func (c *ConnectionTracerServer) UpdatedKeyFromTLS(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("UpdatedKeyFromTLS called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.UpdatedKeyFromTLS(args.Local, args.Remote, args.EncryptionLevel, args.Perspective)
 }
 
 func (c *ConnectionTracerServer) UpdatedKey(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("UpdatedKey called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.UpdatedKey(args.Local, args.Remote, args.Generation, args.Bool)
 }
 
 func (c *ConnectionTracerServer) DroppedEncryptionLevel(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("DroppedEncryptionLevel called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.DroppedEncryptionLevel(args.Local, args.Remote, args.EncryptionLevel)
 }
 
 func (c *ConnectionTracerServer) DroppedKey(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("DroppedKey called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.DroppedKey(args.Local, args.Remote, args.Generation)
 }
 
 func (c *ConnectionTracerServer) SetLossTimer(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("SetLossTimer called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	if args.Time == nil {
 		return ErrDeref
 	}
@@ -658,21 +674,33 @@ func (c *ConnectionTracerServer) SetLossTimer(args *ConnectionTracerMsg, resp *N
 
 func (c *ConnectionTracerServer) LossTimerExpired(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("LossTimerExpired called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.LossTimerExpired(args.Local, args.Remote, args.TimerType, args.EncryptionLevel)
 }
 
 func (c *ConnectionTracerServer) LossTimerCanceled(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("LossTimerCanceled called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.LossTimerCanceled(args.Local, args.Remote)
 }
 
 func (c *ConnectionTracerServer) Close(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("Close called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	return c.ct.Close(args.Local, args.Remote)
 }
 
 func (c *ConnectionTracerServer) Debug(args *ConnectionTracerMsg, resp *NilMsg) error {
 	//c.l.Println("Debug called")
+	if c.ct == nil {
+		return ErrNoTracer
+	}
 	if args.Key == nil || args.Value == nil {
 		return ErrDeref
 	}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/lucas-clemente/quic-go/logging"
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"go.uber.org/zap"
 )
 
 func TestConnectionTracerMsgEncoding(t *testing.T) {
@@ -58,3 +59,22 @@ func TestConnectionTracerMsgEncoding(t *testing.T) {
 	}
 	t.Logf("%+s", msg.String())
 }
+
+func TestConnectionTracerServerErrors(t *testing.T) {
+	s := NewConnectionTracerServer(nil)
+	if err := s.UpdatedMetrics(&ConnectionTracerMsg{}, &NilMsg{}); err != ErrNoTracer {
+		t.Errorf("UpdatedMetrics without tracer = %v, want %v", err, ErrNoTracer)
+	}
+
+	d := NewDebugConnectionTracerServer(nil, zap.NewNop())
+	odcid := logging.ConnectionID{1, 2, 3, 4}
+	if err := d.NewTracerForConnection(&ConnectionTracerMsg{OdcID: &odcid}, &NilMsg{}); err != ErrNoTracer {
+		t.Errorf("NewTracerForConnection without tracer = %v, want %v", err, ErrNoTracer)
+	}
+	if err := d.LossTimerCanceled(&ConnectionTracerMsg{TracingID: 7}, &NilMsg{}); err != ErrUnknownTracer {
+		t.Errorf("LossTimerCanceled for unknown id = %v, want %v", err, ErrUnknownTracer)
+	}
+	if err := d.ClosedConnection(&ConnectionTracerMsg{TracingID: 7}, &NilMsg{}); err != ErrUnknownTracer {
+		t.Errorf("ClosedConnection for unknown id = %v, want %v", err, ErrUnknownTracer)
+	}
+}
@@ -16,199 +16,299 @@ package rpc
 import (
 	"context"
 	"errors"
-	"log"
+	"sync"
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/logging"
+	"go.uber.org/zap"
 )
 
 type DebugConnectionTracerServer struct {
-	l        *log.Logger
+	l        *zap.SugaredLogger
 	tracer   logging.Tracer
+	mu       sync.Mutex
 	ctracers map[uint64]logging.ConnectionTracer
 }
 
-func NewDebugConnectionTracerServer(tracer logging.Tracer, l *log.Logger) *DebugConnectionTracerServer {
-	return &DebugConnectionTracerServer{l, tracer, map[uint64]logging.ConnectionTracer{}}
+func NewDebugConnectionTracerServer(tracer logging.Tracer, l *zap.Logger) *DebugConnectionTracerServer {
+	return &DebugConnectionTracerServer{l: l.Sugar(), tracer: tracer, ctracers: map[uint64]logging.ConnectionTracer{}}
+}
+
+// lookup returns the tracer created for the connection by
+// NewTracerForConnection
+func (c *DebugConnectionTracerServer) lookup(id uint64) (logging.ConnectionTracer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := c.ctracers[id]
+	if t == nil {
+		return nil, ErrUnknownTracer
+	}
+	return t, nil
 }
 
 func (c *DebugConnectionTracerServer) NewTracerForConnection(args *ConnectionTracerMsg, resp *NilMsg) error {
 	if args.OdcID == nil {
 		return ErrDeref
 	}
+	if c.tracer == nil {
+		return ErrNoTracer
+	}
 	tracing_id := args.TracingID
-	c.ctracers[tracing_id] = c.tracer.TracerForConnection(context.WithValue(context.Background(), quic.SessionTracingKey, tracing_id), args.Perspective, *args.OdcID)
+	t := c.tracer.TracerForConnection(context.WithValue(context.Background(), quic.SessionTracingKey, tracing_id), args.Perspective, *args.OdcID)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ctracers[tracing_id] = t
 
 	return nil
 }
 
 func (c *DebugConnectionTracerServer) StartedConnection(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("StartedConnection called")
+	c.l.Debug("StartedConnection called")
 	if args.Local == nil || args.Remote == nil || args.SrcConnID == nil || args.DestConnID == nil {
 		return ErrDeref
 	}
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].StartedConnection(args.Local, args.Remote, *args.SrcConnID, *args.DestConnID)
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.StartedConnection(args.Local, args.Remote, *args.SrcConnID, *args.DestConnID)
 	return nil
 }
 func (c *DebugConnectionTracerServer) NegotiatedVersion(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("NegotiatedVersion called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].NegotiatedVersion(args.Chosen, args.ClientVersions, args.ServerVersions)
+	c.l.Debug("NegotiatedVersion called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.NegotiatedVersion(args.Chosen, args.ClientVersions, args.ServerVersions)
 	return nil
 }
 func (c *DebugConnectionTracerServer) ClosedConnection(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("ClosedConnection called")
-	tracing_id := args.TracingID
-
+	c.l.Debug("ClosedConnection called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
 	if args.ErrorMsg == nil {
-		c.ctracers[tracing_id].ClosedConnection(nil)
+		t.ClosedConnection(nil)
 	} else {
-		c.ctracers[tracing_id].ClosedConnection(errors.New(*args.ErrorMsg))
+		t.ClosedConnection(errors.New(*args.ErrorMsg))
 	}
 	return nil
 }
 func (c *DebugConnectionTracerServer) SentTransportParameters(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("SentTransportParameters called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].SentTransportParameters(args.Parameters)
+	c.l.Debug("SentTransportParameters called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.SentTransportParameters(args.Parameters)
 	return nil
 }
 func (c *DebugConnectionTracerServer) ReceivedTransportParameters(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("ReceivedTransportParameters called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].ReceivedTransportParameters(args.Parameters)
+	c.l.Debug("ReceivedTransportParameters called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.ReceivedTransportParameters(args.Parameters)
 	return nil
 }
 func (c *DebugConnectionTracerServer) RestoredTransportParameters(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("RestoredTransportParameters called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].RestoredTransportParameters(args.Parameters)
+	c.l.Debug("RestoredTransportParameters called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.RestoredTransportParameters(args.Parameters)
 	return nil
 }
 func (c *DebugConnectionTracerServer) SentPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("SentPacket called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].SentPacket(args.ExtendedHeader, args.ByteCount, args.AckFrame, args.Frames)
+	c.l.Debug("SentPacket called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.SentPacket(args.ExtendedHeader, args.ByteCount, args.AckFrame, args.Frames)
 	return nil
 }
 func (c *DebugConnectionTracerServer) ReceivedVersionNegotiationPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("ReceivedVersionNegotiationPacket called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].ReceivedVersionNegotiationPacket(args.Header, args.Versions)
+	c.l.Debug("ReceivedVersionNegotiationPacket called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.ReceivedVersionNegotiationPacket(args.Header, args.Versions)
 	return nil
 }
 func (c *DebugConnectionTracerServer) ReceivedRetry(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("ReceivedRetry called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].ReceivedRetry(args.Header)
+	c.l.Debug("ReceivedRetry called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.ReceivedRetry(args.Header)
 	return nil
 }
 func (c *DebugConnectionTracerServer) ReceivedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("ReceivedPacket called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].ReceivedPacket(args.ExtendedHeader, args.ByteCount, args.Frames)
+	c.l.Debug("ReceivedPacket called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.ReceivedPacket(args.ExtendedHeader, args.ByteCount, args.Frames)
 	return nil
 }
 func (c *DebugConnectionTracerServer) BufferedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("BufferedPacket called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].BufferedPacket(args.PacketType)
+	c.l.Debug("BufferedPacket called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.BufferedPacket(args.PacketType)
 	return nil
 }
 func (c *DebugConnectionTracerServer) DroppedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("DroppedPacket called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].DroppedPacket(args.PacketType, args.ByteCount, args.DropReason)
+	c.l.Debug("DroppedPacket called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.DroppedPacket(args.PacketType, args.ByteCount, args.DropReason)
 	return nil
 }
 func (c *DebugConnectionTracerServer) UpdatedMetrics(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("UpdatedMetrics called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].UpdatedMetrics(&logging.RTTStats{}, args.Cwnd, args.ByteCount, args.Packets)
+	c.l.Debug("UpdatedMetrics called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.UpdatedMetrics(&logging.RTTStats{}, args.Cwnd, args.ByteCount, args.Packets)
 	return nil
 }
 func (c *DebugConnectionTracerServer) AcknowledgedPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("AcknowledgedPacket called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].AcknowledgedPacket(args.EncryptionLevel, args.PacketNumber)
+	c.l.Debug("AcknowledgedPacket called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.AcknowledgedPacket(args.EncryptionLevel, args.PacketNumber)
 	return nil
 }
 func (c *DebugConnectionTracerServer) LostPacket(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("LostPacket called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].LostPacket(args.EncryptionLevel, args.PacketNumber, args.LossReason)
+	c.l.Debug("LostPacket called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.LostPacket(args.EncryptionLevel, args.PacketNumber, args.LossReason)
 	return nil
 }
 func (c *DebugConnectionTracerServer) UpdatedCongestionState(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Printf("UpdatedCongestionState called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].UpdatedCongestionState(args.CongestionState)
+	c.l.Debug("UpdatedCongestionState called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.UpdatedCongestionState(args.CongestionState)
 	return nil
 }
 func (c *DebugConnectionTracerServer) UpdatedPTOCount(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("UpdatedPTOCount called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].UpdatedPTOCount(args.PTOCount)
+	c.l.Debug("UpdatedPTOCount called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.UpdatedPTOCount(args.PTOCount)
 	return nil
 }
 func (c *DebugConnectionTracerServer) UpdatedKeyFromTLS(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("UpdatedKeyFromTLS called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].UpdatedKeyFromTLS(args.EncryptionLevel, args.Perspective)
+	c.l.Debug("UpdatedKeyFromTLS called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.UpdatedKeyFromTLS(args.EncryptionLevel, args.Perspective)
 	return nil
 }
 func (c *DebugConnectionTracerServer) UpdatedKey(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("UpdatedKey called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].UpdatedKey(args.Generation, args.Bool)
+	c.l.Debug("UpdatedKey called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.UpdatedKey(args.Generation, args.Bool)
 	return nil
 }
 func (c *DebugConnectionTracerServer) DroppedEncryptionLevel(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("DroppedEncryptionLevel called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].DroppedEncryptionLevel(args.EncryptionLevel)
+	c.l.Debug("DroppedEncryptionLevel called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.DroppedEncryptionLevel(args.EncryptionLevel)
 	return nil
 }
 func (c *DebugConnectionTracerServer) DroppedKey(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("DroppedKey called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].DroppedKey(args.Generation)
+	c.l.Debug("DroppedKey called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.DroppedKey(args.Generation)
 	return nil
 }
 func (c *DebugConnectionTracerServer) SetLossTimer(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("SetLossTimer called")
+	c.l.Debug("SetLossTimer called")
 	if args.Time == nil {
 		return ErrDeref
 	}
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].SetLossTimer(args.TimerType, args.EncryptionLevel, *args.Time)
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.SetLossTimer(args.TimerType, args.EncryptionLevel, *args.Time)
 	return nil
 }
 func (c *DebugConnectionTracerServer) LossTimerExpired(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("LossTimerExpired called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].LossTimerExpired(args.TimerType, args.EncryptionLevel)
+	c.l.Debug("LossTimerExpired called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.LossTimerExpired(args.TimerType, args.EncryptionLevel)
 	return nil
 }
 func (c *DebugConnectionTracerServer) LossTimerCanceled(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("LossTimerCanceled called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].LossTimerCanceled()
+	c.l.Debug("LossTimerCanceled called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.LossTimerCanceled()
 	return nil
 }
 func (c *DebugConnectionTracerServer) Close(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("Close called")
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].Close()
+	c.l.Debug("Close called")
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.Close()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.ctracers, args.TracingID)
 	return nil
 }
 func (c *DebugConnectionTracerServer) Debug(args *ConnectionTracerMsg, resp *NilMsg) error {
-	c.l.Println("Debug called")
+	c.l.Debug("Debug called")
 	if args.Key == nil || args.Value == nil {
 		return ErrDeref
 	}
-	tracing_id := args.TracingID
-	c.ctracers[tracing_id].Debug(*args.Key, *args.Value)
+	t, err := c.lookup(args.TracingID)
+	if err != nil {
+		return err
+	}
+	t.Debug(*args.Key, *args.Value)
 	return nil
 }
@@ -0,0 +1,138 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+	"strings"
+)
+
+// Code classifies errors, so that clients can tell what to do about them
+// without parsing messages
+type Code int
+
+const (
+	// CodeUnknown is any error that is not classified, such as a broken
+	// connection to the daemon
+	CodeUnknown Code = iota
+	// CodeInvalidArgument is a malformed or incomplete request
+	CodeInvalidArgument
+	// CodeUnknownConnection concerns a connection the daemon does not know
+	CodeUnknownConnection
+	// CodeScriptError is a failure of the path-selection script
+	CodeScriptError
+	// CodeScriptTimeout is a script that did not return in time
+	CodeScriptTimeout
+	// CodeNoPath means that no path is available for the connection
+	CodeNoPath
+	// CodePolicyDenied means that a policy rules out the request
+	CodePolicyDenied
+	// CodeOverloaded means that the daemon is too busy to serve the request.
+	// The daemon does not shed load yet, so it never returns it, but clients
+	// should treat it as retryable.
+	CodeOverloaded
+)
+
+var codeNames = []string{
+	CodeUnknown:           "unknown error",
+	CodeInvalidArgument:   "invalid argument",
+	CodeUnknownConnection: "unknown connection",
+	CodeScriptError:       "script error",
+	CodeScriptTimeout:     "script timeout",
+	CodeNoPath:            "no path available",
+	CodePolicyDenied:      "policy denied",
+	CodeOverloaded:        "daemon overloaded",
+}
+
+func (c Code) String() string {
+	if c < 0 || int(c) >= len(codeNames) {
+		return fmt.Sprintf("error code %d", int(c))
+	}
+	return codeNames[c]
+}
+
+// Retryable tells whether the same request may succeed later on
+func (c Code) Retryable() bool {
+	return c == CodeScriptTimeout || c == CodeNoPath || c == CodeOverloaded
+}
+
+// Error is an error with a code. It crosses the RPC boundary as its message,
+// which starts with the name of the code, and is reconstructed by the client.
+type Error struct {
+	Code Code
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Msg == "" {
+		return e.Code.String()
+	}
+	return e.Code.String() + ": " + e.Msg
+}
+
+// Is matches errors with the same code and message, and the sentinel error
+// of the code, such that errors.Is(err, rpc.ErrNoPath) holds for every
+// error with CodeNoPath
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && (t.Msg == "" || t.Msg == e.Msg)
+}
+
+// The sentinel errors of the codes
+var (
+	ErrInvalidArgument   = &Error{Code: CodeInvalidArgument}
+	ErrUnknownConnection = &Error{Code: CodeUnknownConnection}
+	ErrScript            = &Error{Code: CodeScriptError}
+	ErrScriptTimeout     = &Error{Code: CodeScriptTimeout}
+	ErrNoPath            = &Error{Code: CodeNoPath}
+	ErrPolicyDenied      = &Error{Code: CodePolicyDenied}
+	ErrOverloaded        = &Error{Code: CodeOverloaded}
+)
+
+// NewError attaches code to err, keeping its message
+func NewError(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Msg: err.Error()}
+}
+
+// CodeOf returns the code of err, CodeUnknown for errors without one
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// decodeError restores the code of an error returned by the server
+func decodeError(err error) error {
+	s, ok := err.(rpc.ServerError)
+	if !ok {
+		return err
+	}
+	for c := CodeInvalidArgument; int(c) < len(codeNames); c++ {
+		name := c.String()
+		if string(s) == name {
+			return &Error{Code: c}
+		}
+		if strings.HasPrefix(string(s), name+": ") {
+			return &Error{Code: c, Msg: string(s[len(name)+2:])}
+		}
+	}
+	return err
+}
@@ -0,0 +1,90 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"errors"
+	"net"
+	"net/rpc"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestDecodeError(t *testing.T) {
+	for _, err := range []error{
+		ErrNoPath,
+		ErrDeref,
+		ErrUnknownTracer,
+		ErrNoTracer,
+		ErrNoReload,
+		ErrOverloaded,
+		NewError(CodeScriptError, errors.New("script.lua:3: boom")),
+	} {
+		got := decodeError(rpc.ServerError(err.Error()))
+		if !errors.Is(got, err) || CodeOf(got) != CodeOf(err) {
+			t.Errorf("decodeError(%q) = %#v, want %#v", err.Error(), got, err)
+		}
+	}
+	if !CodeOverloaded.Retryable() || CodeInvalidArgument.Retryable() {
+		t.Error("overload is not retryable, or an invalid argument is")
+	}
+	if !errors.Is(ErrDeref, ErrInvalidArgument) {
+		t.Errorf("ErrDeref is no %v", ErrInvalidArgument)
+	}
+	err := decodeError(rpc.ServerError("something else"))
+	if CodeOf(err) != CodeUnknown {
+		t.Errorf("CodeOf(%v) = %v, want %v", err, CodeOf(err), CodeUnknown)
+	}
+}
+
+func TestClientCheckWarns(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.Register(NewConnectionTracerServer(nil)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Register(NewAdminServer(NewAdminSelector(&firstPathSelector{}, nil, nil))); err != nil {
+		t.Fatal(err)
+	}
+	conn, srv := net.Pipe()
+	go server.ServeConn(srv)
+	c, err := NewClient(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	core, logs := observer.New(zapcore.DebugLevel)
+	c.l = zap.New(core, zap.OnFatal(zapcore.WriteThenPanic)).Sugar()
+
+	err = c.Call("ConnectionTracerServer.UpdatedMetrics", &ConnectionTracerMsg{}, &NilMsg{})
+	if !errors.Is(err, ErrNoTracer) {
+		t.Errorf("UpdatedMetrics without tracer = %v, want %v", err, ErrNoTracer)
+	}
+	c.check("ConnectionTracerServer.UpdatedMetrics", err)
+	if err := NewAdminClient(c).Reload(); !errors.Is(err, ErrNoReload) {
+		t.Errorf("Reload = %v, want %v", err, ErrNoReload)
+	} else {
+		c.check("AdminServer.Reload", err)
+	}
+	if n := logs.FilterMessage("RPC call failed").FilterField(zap.Any("method", "AdminServer.Reload")).Len(); n != 1 {
+		t.Errorf("%d warnings for Reload, want 1", n)
+	}
+	for _, e := range logs.All() {
+		if e.Level > zapcore.WarnLevel {
+			t.Errorf("%s logged at level %s", e.Message, e.Level)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build gofuzz
+// +build gofuzz
+
+package rpc
+
+// Targets for go-fuzz (github.com/dvyukov/go-fuzz). Each one decodes a
+// message the way net/rpc does and hands it to every handler of the
+// corresponding server, none of which may panic:
+//
+//	go-fuzz-build -func FuzzSelectorMsg ./rpc
+//	go-fuzz -bin rpc-fuzz.zip -workdir fuzz/selector
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func FuzzSelectorMsg(data []byte) int {
+	var msg SelectorMsg
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&msg); err != nil {
+		return 0
+	}
+	callAll(NewSelectorServer(&fuzzSelector{}), &msg)
+	return 1
+}
+
+func FuzzConnectionTracerMsg(data []byte) int {
+	var msg ConnectionTracerMsg
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&msg); err != nil {
+		return 0
+	}
+	callAll(NewConnectionTracerServer(NopConnectionTracer{}), &msg)
+	return 1
+}
+
+func FuzzAdminMsg(data []byte) int {
+	var msg AdminMsg
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&msg); err != nil {
+		return 0
+	}
+	callAll(NewAdminServer(NewAdminSelector(&fuzzSelector{}, nil, nil)), &msg)
+	return 1
+}
+
+// callAll invokes every exported method of server that takes args along
+// with a response, like net/rpc does
+func callAll(server interface{}, args interface{}) {
+	v := reflect.ValueOf(server)
+	for i := 0; i < v.NumMethod(); i++ {
+		m := v.Method(i)
+		t := m.Type()
+		if t.NumIn() != 2 || t.In(0) != reflect.TypeOf(args) || t.In(1).Kind() != reflect.Ptr {
+			continue
+		}
+		m.Call([]reflect.Value{reflect.ValueOf(args), reflect.New(t.In(1).Elem())})
+	}
+}
+
+// fuzzSelector selects the first path of a connection
+type fuzzSelector struct {
+	paths map[string][]*pan.Path
+}
+
+func (s *fuzzSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	return s.Refresh(local, remote, paths)
+}
+
+func (s *fuzzSelector) SetPreferences(map[string]string, pan.UDPAddr, pan.UDPAddr) error {
+	return nil
+}
+
+func (s *fuzzSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	if paths := s.paths[local.String()+remote.String()]; len(paths) > 0 {
+		return paths[0], nil
+	}
+	return nil, nil
+}
+
+func (s *fuzzSelector) PathDown(pan.UDPAddr, pan.UDPAddr, pan.PathFingerprint, pan.PathInterface) error {
+	return nil
+}
+
+func (s *fuzzSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	if s.paths == nil {
+		s.paths = map[string][]*pan.Path{}
+	}
+	s.paths[local.String()+remote.String()] = paths
+	return nil
+}
+
+func (s *fuzzSelector) Close(local, remote pan.UDPAddr) error {
+	delete(s.paths, local.String()+remote.String())
+	return nil
+}
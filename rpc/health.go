@@ -0,0 +1,264 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/logger"
+	"go.uber.org/zap"
+)
+
+// InterfaceState is what is known about the health of an interface
+type InterfaceState struct {
+	Interface pan.PathInterface
+	Down      bool
+	// Since is when the interface last went down or came back up
+	Since time.Time
+	// Reported is when the interface was last reported down
+	Reported time.Time
+	// Reports is the number of times it was reported down since it last
+	// went down
+	Reports int
+}
+
+// InterfaceHealth is a table of interface health shared by all connections
+// of the host. Interfaces are down once a connection reported them so, and
+// decay back to up when no further reports arrive for a while. Interfaces
+// that have been up for that long again are forgotten.
+//
+// Its middleware spreads the news: an interface reported down on one
+// connection is reported down to the selector of every other connection, for
+// each of its paths through it, and to connections that get such paths later
+// on.
+type InterfaceHealth struct {
+	decay time.Duration
+	clock clock.Clock
+	l     *zap.SugaredLogger
+	mu    sync.Mutex
+	ifs   map[pan.PathInterface]*InterfaceState
+	conns map[string]*healthConn
+}
+
+type healthConn struct {
+	local, remote pan.UDPAddr
+	paths         []*pan.Path
+}
+
+// NewInterfaceHealth returns an empty table, in which interfaces come back
+// up after decay
+func NewInterfaceHealth(decay time.Duration, c clock.Clock) *InterfaceHealth {
+	return &InterfaceHealth{
+		decay: decay,
+		clock: c,
+		l:     logger.Default().Named("health").Sugar(),
+		ifs:   map[pan.PathInterface]*InterfaceState{},
+		conns: map[string]*healthConn{},
+	}
+}
+
+// update lets interfaces decay by now. The caller must hold the lock.
+func (h *InterfaceHealth) update(now time.Time) {
+	for pi, st := range h.ifs {
+		up := st.Reported.Add(h.decay)
+		if st.Down && !now.Before(up) {
+			st.Down, st.Since, st.Reports = false, up, 0
+		}
+		if !st.Down && !now.Before(st.Since.Add(h.decay)) {
+			delete(h.ifs, pi)
+		}
+	}
+}
+
+// Down reports the interface pi down, it tells whether it was up before
+func (h *InterfaceHealth) Down(pi pan.PathInterface) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := h.clock.Now()
+	h.update(now)
+	st, ok := h.ifs[pi]
+	if !ok {
+		st = &InterfaceState{Interface: pi}
+		h.ifs[pi] = st
+	}
+	wasUp := !st.Down
+	if wasUp {
+		st.Down, st.Since = true, now
+	}
+	st.Reported = now
+	st.Reports++
+	return wasUp
+}
+
+// IsDown tells whether the interface pi is down
+func (h *InterfaceHealth) IsDown(pi pan.PathInterface) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.update(h.clock.Now())
+	st, ok := h.ifs[pi]
+	return ok && st.Down
+}
+
+// Table returns the interfaces known, ordered by IA and interface ID
+func (h *InterfaceHealth) Table() []InterfaceState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.update(h.clock.Now())
+	table := make([]InterfaceState, 0, len(h.ifs))
+	for _, st := range h.ifs {
+		table = append(table, *st)
+	}
+	sort.Slice(table, func(i, j int) bool {
+		a, b := table[i].Interface, table[j].Interface
+		if a.IA != b.IA {
+			return a.IA.String() < b.IA.String()
+		}
+		return a.IfID < b.IfID
+	})
+	return table
+}
+
+// pathDown is a path of a connection and an interface on it that is down
+type pathDown struct {
+	fp pan.PathFingerprint
+	pi pan.PathInterface
+}
+
+// down returns the paths among paths that cross an interface that is down,
+// each with the first such interface. The caller must hold the lock.
+func (h *InterfaceHealth) down(paths []*pan.Path) []pathDown {
+	h.update(h.clock.Now())
+	var down []pathDown
+	for _, p := range paths {
+		if p.Metadata == nil {
+			continue
+		}
+		for _, pi := range p.Metadata.Interfaces {
+			if st, ok := h.ifs[pi]; ok && st.Down {
+				down = append(down, pathDown{p.Fingerprint, pi})
+				break
+			}
+		}
+	}
+	return down
+}
+
+// Middleware shares the health of interfaces between the connections of
+// next. A health table can only be used with a single selector. It belongs
+// outside of middleware keeping state per connection, such as Cache and
+// Hysteresis, so that the reports it spreads reach them.
+func (h *InterfaceHealth) Middleware(next ServerSelector) ServerSelector {
+	return &healthSelector{h: h, next: next}
+}
+
+type healthSelector struct {
+	h    *InterfaceHealth
+	next ServerSelector
+}
+
+// tell reports the interfaces that are down on paths to the selector of a
+// connection
+func (s *healthSelector) tell(local, remote pan.UDPAddr, paths []*pan.Path) {
+	s.h.mu.Lock()
+	down := s.h.down(paths)
+	s.h.mu.Unlock()
+	for _, d := range down {
+		if err := s.next.PathDown(local, remote, d.fp, d.pi); err != nil {
+			s.h.l.Debugw("reporting interface down failed", "local", local, "remote", remote, "fingerprint", d.fp, "interface", d.pi, "error", err)
+		}
+	}
+}
+
+func (s *healthSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.h.mu.Lock()
+	s.h.conns[local.String()+remote.String()] = &healthConn{local, remote, paths}
+	s.h.mu.Unlock()
+	if err := s.next.Initialize(prefs, local, remote, paths); err != nil {
+		return err
+	}
+	s.tell(local, remote, paths)
+	return nil
+}
+
+func (s *healthSelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	return s.next.SetPreferences(prefs, local, remote)
+}
+
+func (s *healthSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	return s.next.Path(local, remote)
+}
+
+// PathDown records interfaces going down and reports them to the other
+// connections, once for each of their paths through them
+func (s *healthSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	err := s.next.PathDown(local, remote, fp, pi)
+	if pi == (pan.PathInterface{}) || !s.h.Down(pi) {
+		return err
+	}
+	key := local.String() + remote.String()
+	type affected struct {
+		c   *healthConn
+		fps []pan.PathFingerprint
+	}
+	var others []affected
+	s.h.mu.Lock()
+	for k, c := range s.h.conns {
+		if k == key {
+			continue
+		}
+		a := affected{c: c}
+		for _, p := range c.paths {
+			if onPath(p, pi) {
+				a.fps = append(a.fps, p.Fingerprint)
+			}
+		}
+		if len(a.fps) > 0 {
+			others = append(others, a)
+		}
+	}
+	s.h.mu.Unlock()
+	s.h.l.Infow("interface down", "interface", pi, "local", local, "remote", remote, "connections", len(others))
+	for _, a := range others {
+		for _, fp := range a.fps {
+			if err := s.next.PathDown(a.c.local, a.c.remote, fp, pi); err != nil {
+				s.h.l.Debugw("reporting interface down failed", "local", a.c.local, "remote", a.c.remote, "fingerprint", fp, "interface", pi, "error", err)
+			}
+		}
+	}
+	return err
+}
+
+func (s *healthSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.h.mu.Lock()
+	if c, ok := s.h.conns[local.String()+remote.String()]; ok {
+		c.paths = paths
+	}
+	s.h.mu.Unlock()
+	if err := s.next.Refresh(local, remote, paths); err != nil {
+		return err
+	}
+	s.tell(local, remote, paths)
+	return nil
+}
+
+func (s *healthSelector) Close(local, remote pan.UDPAddr) error {
+	s.h.mu.Lock()
+	delete(s.h.conns, local.String()+remote.String())
+	s.h.mu.Unlock()
+	return s.next.Close(local, remote)
+}
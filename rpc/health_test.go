@@ -0,0 +1,127 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+// downSelector records the PathDown calls per remote port
+type downSelector struct {
+	firstPathSelector
+	down map[uint16][]pan.PathInterface
+	fps  map[uint16][]pan.PathFingerprint
+}
+
+func (s *downSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.down[remote.Port] = append(s.down[remote.Port], pi)
+	s.fps[remote.Port] = append(s.fps[remote.Port], fp)
+	return nil
+}
+
+func TestInterfaceHealth(t *testing.T) {
+	ia := pan.MustParseIA("1-ff00:0:110")
+	x, y := pan.PathInterface{IA: ia, IfID: 1}, pan.PathInterface{IA: ia, IfID: 2}
+	through := func(fp pan.PathFingerprint, pi pan.PathInterface) *pan.Path {
+		return &pan.Path{Fingerprint: fp, Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{pi}}}
+	}
+	local := pan.UDPAddr{Port: 1}
+	conn := func(port uint16) pan.UDPAddr { return pan.UDPAddr{Port: port} }
+
+	c := clock.NewManual(time.Unix(0, 0))
+	h := NewInterfaceHealth(time.Minute, c)
+	next := &downSelector{down: map[uint16][]pan.PathInterface{}, fps: map[uint16][]pan.PathFingerprint{}}
+	s := h.Middleware(next)
+	s.Initialize(nil, local, conn(2), []*pan.Path{through("a", x)})
+	s.Initialize(nil, local, conn(3), []*pan.Path{through("b", x), through("c", y), through("f", x)})
+	s.Initialize(nil, local, conn(4), []*pan.Path{through("d", y)})
+
+	s.PathDown(local, conn(2), "a", x)
+	if len(next.down[2]) != 1 || len(next.down[3]) != 2 || next.down[3][0] != x || len(next.down[4]) != 0 {
+		t.Errorf("PathDown calls %v, want x for 2 and 3 only", next.down)
+	}
+	// one call for each path through the interface
+	if fps := next.fps[3]; len(fps) != 2 || fps[0] != "b" || fps[1] != "f" {
+		t.Errorf("PathDown calls for 3 with fingerprints %v, want b and f", fps)
+	}
+	// reports of an interface already down are not spread
+	s.PathDown(local, conn(2), "a", x)
+	if len(next.down[3]) != 2 {
+		t.Errorf("%d PathDown calls for 3, want 2", len(next.down[3]))
+	}
+	// new connections learn about it
+	s.Initialize(nil, local, conn(5), []*pan.Path{through("e", x)})
+	if len(next.down[5]) != 1 || next.fps[5][0] != "e" {
+		t.Errorf("PathDown calls after Initialize %v %v, want x on e", next.down[5], next.fps[5])
+	}
+
+	table := h.Table()
+	if len(table) != 1 || !table[0].Down || table[0].Reports != 2 || !table[0].Since.Equal(time.Unix(0, 0)) {
+		t.Errorf("Table() = %+v", table)
+	}
+	c.Advance(time.Minute)
+	if h.IsDown(x) {
+		t.Error("interface still down after the decay")
+	}
+	if table = h.Table(); len(table) != 1 || table[0].Down {
+		t.Errorf("Table() after the decay = %+v", table)
+	}
+	c.Advance(time.Minute)
+	if table = h.Table(); len(table) != 0 {
+		t.Errorf("Table() once forgotten = %+v", table)
+	}
+	// and down again
+	s.PathDown(local, conn(4), "d", y)
+	if len(next.down[3]) != 3 || next.down[3][2] != y || next.fps[3][2] != "c" {
+		t.Errorf("PathDown calls for 3 = %v %v, want x twice and y on c", next.down[3], next.fps[3])
+	}
+}
+
+func TestInterfaceHealthWithHysteresis(t *testing.T) {
+	ia := pan.MustParseIA("1-ff00:0:110")
+	x, y := pan.PathInterface{IA: ia, IfID: 1}, pan.PathInterface{IA: ia, IfID: 2}
+	paths := []*pan.Path{
+		{Fingerprint: "a", Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{x}}},
+		{Fingerprint: "b", Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{y}}},
+	}
+	local, a, b := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}, pan.UDPAddr{Port: 3}
+
+	c := clock.NewManual(time.Unix(0, 0))
+	hyst, err := NewHysteresis(10*time.Second, 0, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &choiceSelector{choice: "a"}
+	// as in the daemon, the health table is outside of the middleware
+	s := NewInterfaceHealth(time.Minute, c).Middleware(Chain(next, hyst.Middleware))
+	for _, remote := range []pan.UDPAddr{a, b} {
+		s.Initialize(nil, local, remote, paths)
+		if p, _ := s.Path(local, remote); p == nil || p.Fingerprint != "a" {
+			t.Fatalf("Path() = %v, want a", p)
+		}
+	}
+
+	next.choice = "b"
+	s.PathDown(local, a, "a", x)
+	// both connections switch at once, within the dwell time
+	for _, remote := range []pan.UDPAddr{a, b} {
+		if p, _ := s.Path(local, remote); p == nil || p.Fingerprint != "b" {
+			t.Errorf("Path() for %d after x went down = %v, want b", remote.Port, p)
+		}
+	}
+}
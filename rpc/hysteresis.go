@@ -0,0 +1,278 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+// The preferences that tune the hysteresis of a connection
+const (
+	// HysteresisDwellKey is the minimum time to stay on a path, as a
+	// duration such as "2s"
+	HysteresisDwellKey = "HysteresisDwell"
+	// HysteresisMarginKey is the fraction by which the RTT of another path
+	// must be lower to switch to it, such as "0.1"
+	HysteresisMarginKey = "HysteresisMargin"
+)
+
+var ErrInvalidMargin = errors.New("margin must be at least 0 and below 1")
+
+// Hysteresis keeps connections on their path when the selector changes its
+// mind too quickly. A new path is only taken once the current one was used
+// for the dwell time and if its RTT is lower by the margin. The current
+// path is given up at once when it goes down, expires or disappears.
+//
+// RTTs are measured by the connection tracer returned by ConnectionTracer.
+// Paths without measurements are estimated from their metadata, and if that
+// is missing too, only the dwell time applies.
+type Hysteresis struct {
+	dwell  time.Duration
+	margin float64
+	clock  clock.Clock
+	mu     sync.Mutex
+	conns  map[string]*sticky
+}
+
+// sticky is the state of a connection
+type sticky struct {
+	dwell   time.Duration
+	margin  float64
+	paths   []*pan.Path
+	current *pan.Path
+	since   time.Time
+	// whether the current path has to be given up
+	released bool
+	rtt      map[pan.PathFingerprint]time.Duration
+}
+
+// NewHysteresis returns hysteresis with the defaults for connections that do
+// not set the preferences
+func NewHysteresis(dwell time.Duration, margin float64, c clock.Clock) (*Hysteresis, error) {
+	if margin < 0 || margin >= 1 {
+		return nil, ErrInvalidMargin
+	}
+	return &Hysteresis{dwell: dwell, margin: margin, clock: c, conns: map[string]*sticky{}}, nil
+}
+
+// Middleware applies the hysteresis to next
+func (h *Hysteresis) Middleware(next ServerSelector) ServerSelector {
+	return &hysteresisSelector{h: h, next: next}
+}
+
+// ConnectionTracer measures the RTTs of the paths in use, passing all calls
+// on to next
+func (h *Hysteresis) ConnectionTracer(next ServerConnectionTracer) ServerConnectionTracer {
+	return hysteresisTracer{next, h}
+}
+
+// setPreferences applies the hysteresis preferences in prefs to c. The
+// caller must hold the lock.
+func (c *sticky) setPreferences(prefs map[string]string) error {
+	if v, ok := prefs[HysteresisDwellKey]; ok {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return NewError(CodeInvalidArgument, err)
+		}
+		c.dwell = d
+	}
+	if v, ok := prefs[HysteresisMarginKey]; ok {
+		m, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return NewError(CodeInvalidArgument, err)
+		}
+		if m < 0 || m >= 1 {
+			return NewError(CodeInvalidArgument, ErrInvalidMargin)
+		}
+		c.margin = m
+	}
+	return nil
+}
+
+// refresh replaces the paths, letting go of the current one if it is gone.
+// The caller must hold the lock.
+func (c *sticky) refresh(paths []*pan.Path) {
+	c.paths = paths
+	rtt := map[pan.PathFingerprint]time.Duration{}
+	found := false
+	for _, p := range paths {
+		if d, ok := c.rtt[p.Fingerprint]; ok {
+			rtt[p.Fingerprint] = d
+		}
+		found = found || c.current != nil && p.Fingerprint == c.current.Fingerprint
+	}
+	c.rtt = rtt
+	if !found {
+		c.released = true
+	}
+}
+
+// choose returns the path to use when the selector proposes p. The caller
+// must hold the lock.
+func (c *sticky) choose(p *pan.Path, now time.Time) *pan.Path {
+	cur := c.current
+	switch {
+	case cur == nil || c.released || !cur.Expiry.IsZero() && !cur.Expiry.After(now):
+	case p.Fingerprint == cur.Fingerprint:
+		c.current = p
+		return p
+	case now.Sub(c.since) < c.dwell:
+		return cur
+	case !c.improves(p, cur):
+		return cur
+	}
+	c.current, c.since, c.released = p, now, false
+	return p
+}
+
+// improves tells whether the RTT of p is lower than that of cur by the
+// margin. Paths that can not be compared are taken to improve.
+func (c *sticky) improves(p, cur *pan.Path) bool {
+	if c.margin == 0 {
+		return true
+	}
+	rp, rc := c.estimate(p), c.estimate(cur)
+	if rp == 0 || rc == 0 {
+		return true
+	}
+	return float64(rp) <= float64(rc)*(1-c.margin)
+}
+
+// estimate returns the measured RTT of p, twice the latency announced in its
+// metadata or zero if neither is known
+func (c *sticky) estimate(p *pan.Path) time.Duration {
+	if d, ok := c.rtt[p.Fingerprint]; ok {
+		return d
+	}
+	if p.Metadata == nil || len(p.Metadata.Latency) == 0 {
+		return 0
+	}
+	var sum time.Duration
+	for _, l := range p.Metadata.Latency {
+		if l <= 0 {
+			return 0
+		}
+		sum += l
+	}
+	return 2 * sum
+}
+
+type hysteresisSelector struct {
+	h    *Hysteresis
+	next ServerSelector
+}
+
+func (s *hysteresisSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	c := &sticky{dwell: s.h.dwell, margin: s.h.margin, rtt: map[pan.PathFingerprint]time.Duration{}}
+	err := c.setPreferences(prefs)
+	c.refresh(paths)
+	s.h.mu.Lock()
+	s.h.conns[local.String()+remote.String()] = c
+	s.h.mu.Unlock()
+	if nerr := s.next.Initialize(prefs, local, remote, paths); nerr != nil {
+		return nerr
+	}
+	return err
+}
+
+func (s *hysteresisSelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	var err error
+	s.h.mu.Lock()
+	if c, ok := s.h.conns[local.String()+remote.String()]; ok {
+		err = c.setPreferences(prefs)
+	}
+	s.h.mu.Unlock()
+	if nerr := s.next.SetPreferences(prefs, local, remote); nerr != nil {
+		return nerr
+	}
+	return err
+}
+
+func (s *hysteresisSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	p, err := s.next.Path(local, remote)
+	if p == nil || err != nil {
+		return p, err
+	}
+	s.h.mu.Lock()
+	defer s.h.mu.Unlock()
+	c, ok := s.h.conns[local.String()+remote.String()]
+	if !ok {
+		return p, nil
+	}
+	return c.choose(p, s.h.clock.Now()), nil
+}
+
+func (s *hysteresisSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.h.mu.Lock()
+	if c, ok := s.h.conns[local.String()+remote.String()]; ok && c.current != nil {
+		if c.current.Fingerprint == fp || onPath(c.current, pi) {
+			c.released = true
+		}
+	}
+	s.h.mu.Unlock()
+	return s.next.PathDown(local, remote, fp, pi)
+}
+
+func (s *hysteresisSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.h.mu.Lock()
+	if c, ok := s.h.conns[local.String()+remote.String()]; ok {
+		c.refresh(paths)
+	}
+	s.h.mu.Unlock()
+	return s.next.Refresh(local, remote, paths)
+}
+
+func (s *hysteresisSelector) Close(local, remote pan.UDPAddr) error {
+	s.h.mu.Lock()
+	delete(s.h.conns, local.String()+remote.String())
+	s.h.mu.Unlock()
+	return s.next.Close(local, remote)
+}
+
+// onPath tells whether p goes through the interface pi, which must not be
+// empty
+func onPath(p *pan.Path, pi pan.PathInterface) bool {
+	if p.Metadata == nil || pi == (pan.PathInterface{}) {
+		return false
+	}
+	for _, i := range p.Metadata.Interfaces {
+		if i == pi {
+			return true
+		}
+	}
+	return false
+}
+
+type hysteresisTracer struct {
+	ServerConnectionTracer
+	h *Hysteresis
+}
+
+func (t hysteresisTracer) UpdatedMetrics(local, remote *pan.UDPAddr, rttStats *RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) error {
+	if local != nil && remote != nil && rttStats != nil && rttStats.SmoothedRTT > 0 {
+		t.h.mu.Lock()
+		if c, ok := t.h.conns[local.String()+remote.String()]; ok && c.current != nil {
+			c.rtt[c.current.Fingerprint] = rttStats.SmoothedRTT
+		}
+		t.h.mu.Unlock()
+	}
+	return t.ServerConnectionTracer.UpdatedMetrics(local, remote, rttStats, cwnd, bytesInFlight, packetsInFlight)
+}
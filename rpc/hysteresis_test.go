@@ -0,0 +1,121 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+// choiceSelector selects the path with the fingerprint in choice
+type choiceSelector struct {
+	firstPathSelector
+	choice pan.PathFingerprint
+}
+
+func (s *choiceSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	for _, p := range s.paths {
+		if p.Fingerprint == s.choice {
+			return p, nil
+		}
+	}
+	return nil, nil
+}
+
+func TestHysteresis(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	ia := pan.MustParseIA("1-ff00:0:110")
+	path := func(fp pan.PathFingerprint, latency time.Duration, ifid pan.IfID) *pan.Path {
+		return &pan.Path{Fingerprint: fp, Metadata: &pan.PathMetadata{
+			Interfaces: []pan.PathInterface{{IA: ia, IfID: ifid}},
+			Latency:    []time.Duration{latency},
+		}}
+	}
+	paths := []*pan.Path{
+		path("a", 10*time.Millisecond, 1),
+		path("b", 9*time.Millisecond, 2),
+		path("c", 5*time.Millisecond, 3),
+	}
+	c := clock.NewManual(time.Unix(0, 0))
+	h, err := NewHysteresis(time.Second, 0.2, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &choiceSelector{choice: "a"}
+	s := Chain(next, h.Middleware)
+	ct := h.ConnectionTracer(NopConnectionTracer{})
+	if err := s.Initialize(nil, local, remote, paths); err != nil {
+		t.Fatal(err)
+	}
+	expect := func(choice, want pan.PathFingerprint) {
+		t.Helper()
+		next.choice = choice
+		if p, err := s.Path(local, remote); err != nil || p == nil || p.Fingerprint != want {
+			t.Errorf("Path() with %s chosen = %v, %v, want %s", choice, p, err, want)
+		}
+	}
+
+	expect("a", "a")
+	// within the dwell time
+	expect("c", "a")
+	c.Advance(time.Second)
+	// not better by the margin
+	expect("b", "a")
+	expect("c", "c")
+	// the measured RTT of c makes b look better
+	ct.UpdatedMetrics(&local, &remote, &RTTStats{SmoothedRTT: 100 * time.Millisecond}, 0, 0, 0)
+	c.Advance(time.Second)
+	expect("b", "b")
+
+	// switch at once when the path goes down
+	s.PathDown(local, remote, "", pan.PathInterface{IA: ia, IfID: 2})
+	expect("a", "a")
+	// or disappears
+	s.Refresh(local, remote, paths[1:])
+	expect("c", "c")
+
+	if err := s.SetPreferences(map[string]string{HysteresisDwellKey: "0s", HysteresisMarginKey: "0"}, local, remote); err != nil {
+		t.Fatal(err)
+	}
+	expect("b", "b")
+	err = s.SetPreferences(map[string]string{HysteresisMarginKey: "1.5"}, local, remote)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("SetPreferences(margin 1.5) = %v, want %v", err, ErrInvalidArgument)
+	}
+}
+
+func TestHysteresisExpiry(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	c := clock.NewManual(time.Unix(0, 0))
+	h, _ := NewHysteresis(time.Hour, 0, c)
+	next := &choiceSelector{choice: "a"}
+	s := Chain(next, h.Middleware)
+	s.Initialize(nil, local, remote, []*pan.Path{
+		{Fingerprint: "a", Expiry: time.Unix(10, 0)},
+		{Fingerprint: "b"},
+	})
+	s.Path(local, remote)
+	next.choice = "b"
+	if p, _ := s.Path(local, remote); p.Fingerprint != "a" {
+		t.Errorf("Path() = %s, want a", p.Fingerprint)
+	}
+	c.Advance(10 * time.Second)
+	if p, _ := s.Path(local, remote); p.Fingerprint != "b" {
+		t.Errorf("Path() after expiry = %s, want b", p.Fingerprint)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/logger"
+	"github.com/netsys-lab/pan-lua/selector"
+	"go.uber.org/zap"
+)
+
+// MandatoryPolicy is a path policy set by the administrator of a host, which
+// applies to all connections whatever their preferences. It is read from a
+// file in the format of the selector.PathPolicyKey preference.
+//
+// Its middleware belongs outside of everything that may pick paths, the
+// AdminSelector included. It hands on the complying paths only and rejects
+// any other path with CodePolicyDenied.
+type MandatoryPolicy struct {
+	file  string
+	clock clock.Clock
+	l     *zap.SugaredLogger
+	mu    sync.Mutex
+	// the policy in force, the last one read successfully
+	policy pan.Policy
+	// modification time and size of the file when last read
+	modTime time.Time
+	size    int64
+	next    ServerSelector
+	conns   map[string]*mandatoryConn
+	timer   clock.Timer
+}
+
+type mandatoryConn struct {
+	local, remote pan.UDPAddr
+	// all paths, regardless of the policy
+	paths   []*pan.Path
+	allowed map[pan.PathFingerprint]bool
+}
+
+// NewMandatoryPolicy reads the policy in file
+func NewMandatoryPolicy(file string, c clock.Clock) (*MandatoryPolicy, error) {
+	m := &MandatoryPolicy{
+		file:  file,
+		clock: c,
+		l:     logger.Default().Named("policy").Sugar(),
+		conns: map[string]*mandatoryConn{},
+	}
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// load reads the file, it keeps the policy in force on errors
+func (m *MandatoryPolicy) load() error {
+	fi, err := os.Stat(m.file)
+	if err != nil {
+		return err
+	}
+	b, err := os.ReadFile(m.file)
+	if err != nil {
+		return err
+	}
+	policy, err := selector.ParsePathPolicy(string(b))
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.policy, m.modTime, m.size = policy, fi.ModTime(), fi.Size()
+	m.mu.Unlock()
+	return nil
+}
+
+// Reload reads the file again and applies the policy to all connections,
+// whose selectors are refreshed with the paths that comply now. If the file
+// can not be read or is invalid, the previous policy stays in force.
+func (m *MandatoryPolicy) Reload() error {
+	if err := m.load(); err != nil {
+		return err
+	}
+	type refresh struct {
+		local, remote pan.UDPAddr
+		paths         []*pan.Path
+	}
+	var refreshes []refresh
+	m.mu.Lock()
+	next := m.next
+	for _, c := range m.conns {
+		refreshes = append(refreshes, refresh{c.local, c.remote, m.filter(c)})
+	}
+	m.mu.Unlock()
+	m.l.Infow("mandatory path policy loaded", "file", m.file, "connections", len(refreshes))
+	if next == nil {
+		return nil
+	}
+	for _, r := range refreshes {
+		if err := next.Refresh(r.local, r.remote, r.paths); err != nil {
+			m.l.Warnw("refresh after policy reload failed", "local", r.local, "remote", r.remote, "error", err)
+		}
+	}
+	return nil
+}
+
+// Watch checks the file for changes every interval and reloads it
+func (m *MandatoryPolicy) Watch(interval time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var check func()
+	check = func() {
+		if m.changed() {
+			if err := m.Reload(); err != nil {
+				m.l.Errorw("could not reload mandatory path policy, keeping the previous one", "file", m.file, "error", err)
+			}
+		}
+		m.mu.Lock()
+		if m.timer != nil {
+			m.timer = m.clock.AfterFunc(interval, check)
+		}
+		m.mu.Unlock()
+	}
+	m.timer = m.clock.AfterFunc(interval, check)
+}
+
+// Stop stops watching the file
+func (m *MandatoryPolicy) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.timer != nil {
+		m.timer.Stop()
+		m.timer = nil
+	}
+}
+
+// changed tells whether the file differs from when it was last read.
+// Failing to read it counts as a change, so that it is reported.
+func (m *MandatoryPolicy) changed() bool {
+	fi, err := os.Stat(m.file)
+	if err != nil {
+		return true
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return !fi.ModTime().Equal(m.modTime) || fi.Size() != m.size
+}
+
+// filter returns the paths of c complying with the policy, and remembers
+// them. The caller must hold the lock.
+func (m *MandatoryPolicy) filter(c *mandatoryConn) []*pan.Path {
+	paths := m.policy.Filter(c.paths)
+	c.allowed = make(map[pan.PathFingerprint]bool, len(paths))
+	for _, p := range paths {
+		c.allowed[p.Fingerprint] = true
+	}
+	return paths
+}
+
+// Middleware enforces the policy on next. A policy can only be enforced on
+// a single selector.
+func (m *MandatoryPolicy) Middleware(next ServerSelector) ServerSelector {
+	m.mu.Lock()
+	m.next = next
+	m.mu.Unlock()
+	return &mandatorySelector{m: m, next: next}
+}
+
+type mandatorySelector struct {
+	m    *MandatoryPolicy
+	next ServerSelector
+}
+
+func (s *mandatorySelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	c := &mandatoryConn{local: local, remote: remote, paths: paths}
+	s.m.mu.Lock()
+	s.m.conns[local.String()+remote.String()] = c
+	paths = s.m.filter(c)
+	s.m.mu.Unlock()
+	return s.next.Initialize(prefs, local, remote, paths)
+}
+
+func (s *mandatorySelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	return s.next.SetPreferences(prefs, local, remote)
+}
+
+func (s *mandatorySelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	p, err := s.next.Path(local, remote)
+	if p == nil || err != nil {
+		return p, err
+	}
+	s.m.mu.Lock()
+	c, ok := s.m.conns[local.String()+remote.String()]
+	allowed := ok && c.allowed[p.Fingerprint]
+	s.m.mu.Unlock()
+	if !allowed {
+		s.m.l.Warnw("path violates the mandatory path policy", "local", local, "remote", remote, "path", p.Fingerprint)
+		return nil, &Error{Code: CodePolicyDenied, Msg: "path " + string(p.Fingerprint) + " violates the mandatory path policy"}
+	}
+	return p, nil
+}
+
+func (s *mandatorySelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	return s.next.PathDown(local, remote, fp, pi)
+}
+
+func (s *mandatorySelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.m.mu.Lock()
+	c, ok := s.m.conns[local.String()+remote.String()]
+	if !ok {
+		c = &mandatoryConn{local: local, remote: remote}
+		s.m.conns[local.String()+remote.String()] = c
+	}
+	c.paths = paths
+	paths = s.m.filter(c)
+	s.m.mu.Unlock()
+	return s.next.Refresh(local, remote, paths)
+}
+
+func (s *mandatorySelector) Close(local, remote pan.UDPAddr) error {
+	s.m.mu.Lock()
+	delete(s.m.conns, local.String()+remote.String())
+	s.m.mu.Unlock()
+	return s.next.Close(local, remote)
+}
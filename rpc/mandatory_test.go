@@ -0,0 +1,79 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+func TestMandatoryPolicy(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	ia := func(s string) pan.PathInterface { return pan.PathInterface{IA: pan.MustParseIA(s), IfID: 1} }
+	paths := []*pan.Path{
+		{Fingerprint: "a", Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{ia("1-ff00:0:110"), ia("2-ff00:0:210")}}},
+		{Fingerprint: "b", Metadata: &pan.PathMetadata{Interfaces: []pan.PathInterface{ia("1-ff00:0:110"), ia("1-ff00:0:111")}}},
+	}
+	file := filepath.Join(t.TempDir(), "policy.json")
+	write := func(policy string) {
+		if err := os.WriteFile(file, []byte(policy), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"acl": ["- 1-ff00:0:111", "+"]}`)
+	c := clock.NewManual(time.Unix(0, 0))
+	m, err := NewMandatoryPolicy(file, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := &stubbornSelector{}
+	s := m.Middleware(next)
+	// the preferences of the application can not widen the policy
+	prefs := map[string]string{selector.PathPolicyKey: `{"acl": ["+"]}`}
+	if err := s.Initialize(prefs, local, remote, paths); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.paths) != 1 || next.paths[0].Fingerprint != "a" {
+		t.Fatalf("selector initialized with %v, want a only", next.paths)
+	}
+
+	m.Watch(time.Second)
+	defer m.Stop()
+	write(`{"acl": ["- 2", "+"]}`)
+	c.Advance(time.Second)
+	if len(next.refreshed) != 1 || next.refreshed[0].Fingerprint != "b" {
+		t.Errorf("selector refreshed with %v, want b only", next.refreshed)
+	}
+	// the selector still returns a
+	if p, err := s.Path(local, remote); p != nil || !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Path() = %v, %v, want %v", p, err, ErrPolicyDenied)
+	}
+
+	// invalid policies are not applied
+	write(`{"acl": ["+ 1"]}`)
+	c.Advance(time.Second)
+	if err := m.Reload(); err == nil {
+		t.Error("Reload() of an invalid policy succeeded")
+	}
+	if len(next.refreshed) != 1 || next.refreshed[0].Fingerprint != "b" {
+		t.Errorf("selector refreshed with %v after an invalid policy, want b only", next.refreshed)
+	}
+}
@@ -0,0 +1,320 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/selector"
+	"go.uber.org/zap"
+)
+
+// Middleware wraps a server selector with behaviour that does not depend on
+// the backend, be it a script, the default selector or a Go selector
+type Middleware func(ServerSelector) ServerSelector
+
+// Chain wraps s in mws. The first middleware is the outermost one, it sees
+// every call first.
+func Chain(s ServerSelector, mws ...Middleware) ServerSelector {
+	for i := len(mws) - 1; i >= 0; i-- {
+		s = mws[i](s)
+	}
+	return s
+}
+
+// Logging logs every call at debug level, with its duration and error
+func Logging(l *zap.SugaredLogger) Middleware {
+	return func(next ServerSelector) ServerSelector {
+		return &loggingSelector{next: next, l: l}
+	}
+}
+
+type loggingSelector struct {
+	next ServerSelector
+	l    *zap.SugaredLogger
+}
+
+func (s *loggingSelector) log(method string, local, remote pan.UDPAddr, start time.Time, err error, kv ...interface{}) {
+	kv = append(kv, "local", local, "remote", remote, "duration", time.Since(start))
+	if err != nil {
+		kv = append(kv, "error", err)
+	}
+	s.l.Debugw(method, kv...)
+}
+
+func (s *loggingSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	start := time.Now()
+	err := s.next.Initialize(prefs, local, remote, paths)
+	s.log("Initialize", local, remote, start, err, "preferences", prefs, "paths", len(paths))
+	return err
+}
+
+func (s *loggingSelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	start := time.Now()
+	err := s.next.SetPreferences(prefs, local, remote)
+	s.log("SetPreferences", local, remote, start, err, "preferences", prefs)
+	return err
+}
+
+func (s *loggingSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	start := time.Now()
+	p, err := s.next.Path(local, remote)
+	var fp pan.PathFingerprint
+	if p != nil {
+		fp = p.Fingerprint
+	}
+	s.log("Path", local, remote, start, err, "path", fp)
+	return p, err
+}
+
+func (s *loggingSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	start := time.Now()
+	err := s.next.PathDown(local, remote, fp, pi)
+	s.log("PathDown", local, remote, start, err, "path", fp, "interface", pi)
+	return err
+}
+
+func (s *loggingSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	start := time.Now()
+	err := s.next.Refresh(local, remote, paths)
+	s.log("Refresh", local, remote, start, err, "paths", len(paths))
+	return err
+}
+
+func (s *loggingSelector) Close(local, remote pan.UDPAddr) error {
+	start := time.Now()
+	err := s.next.Close(local, remote)
+	s.log("Close", local, remote, start, err)
+	return err
+}
+
+// Cache answers Path from the last path returned for the connection, until
+// ttl has passed or anything that may change the choice happens. Errors and
+// nil paths are not cached.
+func Cache(ttl time.Duration, c clock.Clock) Middleware {
+	return func(next ServerSelector) ServerSelector {
+		return &cache{next: next, ttl: ttl, clock: c, paths: map[string]cached{}}
+	}
+}
+
+type cached struct {
+	path    *pan.Path
+	expires time.Time
+}
+
+type cache struct {
+	next  ServerSelector
+	ttl   time.Duration
+	clock clock.Clock
+	mu    sync.Mutex
+	paths map[string]cached
+}
+
+func (s *cache) invalidate(local, remote pan.UDPAddr) {
+	s.mu.Lock()
+	delete(s.paths, local.String()+remote.String())
+	s.mu.Unlock()
+}
+
+func (s *cache) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.invalidate(local, remote)
+	return s.next.Initialize(prefs, local, remote, paths)
+}
+
+func (s *cache) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	s.invalidate(local, remote)
+	return s.next.SetPreferences(prefs, local, remote)
+}
+
+func (s *cache) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	key := local.String() + remote.String()
+	s.mu.Lock()
+	c, ok := s.paths[key]
+	s.mu.Unlock()
+	if ok && s.clock.Now().Before(c.expires) {
+		return c.path, nil
+	}
+	p, err := s.next.Path(local, remote)
+	if p != nil && err == nil {
+		s.mu.Lock()
+		s.paths[key] = cached{p, s.clock.Now().Add(s.ttl)}
+		s.mu.Unlock()
+	}
+	return p, err
+}
+
+func (s *cache) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.invalidate(local, remote)
+	return s.next.PathDown(local, remote, fp, pi)
+}
+
+func (s *cache) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.invalidate(local, remote)
+	return s.next.Refresh(local, remote, paths)
+}
+
+func (s *cache) Close(local, remote pan.UDPAddr) error {
+	s.invalidate(local, remote)
+	return s.next.Close(local, remote)
+}
+
+// Fallback asks fallback for a path whenever the wrapped selector returns
+// none, or fails with an error that is not the caller's fault, such as a
+// script error. Both selectors are kept informed about every connection,
+// errors of fallback other than in Path are ignored.
+func Fallback(fallback ServerSelector) Middleware {
+	return func(next ServerSelector) ServerSelector {
+		return &fallbackSelector{next: next, fallback: fallback}
+	}
+}
+
+type fallbackSelector struct {
+	next, fallback ServerSelector
+}
+
+// fallsBack tells whether a missing path with err is worth asking the
+// fallback for
+func fallsBack(err error) bool {
+	switch CodeOf(err) {
+	case CodeInvalidArgument, CodeUnknownConnection, CodePolicyDenied:
+		return false
+	}
+	return true
+}
+
+func (s *fallbackSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.fallback.Initialize(prefs, local, remote, paths)
+	return s.next.Initialize(prefs, local, remote, paths)
+}
+
+func (s *fallbackSelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	s.fallback.SetPreferences(prefs, local, remote)
+	return s.next.SetPreferences(prefs, local, remote)
+}
+
+func (s *fallbackSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	p, err := s.next.Path(local, remote)
+	if p != nil || !fallsBack(err) {
+		return p, err
+	}
+	return s.fallback.Path(local, remote)
+}
+
+func (s *fallbackSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.fallback.PathDown(local, remote, fp, pi)
+	return s.next.PathDown(local, remote, fp, pi)
+}
+
+func (s *fallbackSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.fallback.Refresh(local, remote, paths)
+	return s.next.Refresh(local, remote, paths)
+}
+
+func (s *fallbackSelector) Close(local, remote pan.UDPAddr) error {
+	s.fallback.Close(local, remote)
+	return s.next.Close(local, remote)
+}
+
+// InProcess turns mw into a middleware for a single selector used in-process,
+// such as one passed to pan.DialQUIC
+func InProcess(mw Middleware) selector.Middleware {
+	return func(s selector.Selector) selector.Selector {
+		return &inProcess{next: mw(single{s})}
+	}
+}
+
+// single serves the one connection of an in-process selector
+type single struct {
+	s selector.Selector
+}
+
+func (s single) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.s.Initialize(local, remote, paths)
+	if prefs == nil {
+		return nil
+	}
+	return s.s.SetPreferences(prefs)
+}
+
+func (s single) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	return s.s.SetPreferences(prefs)
+}
+
+func (s single) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	return s.s.Path(), nil
+}
+
+func (s single) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.s.PathDown(fp, pi)
+	return nil
+}
+
+func (s single) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.s.Refresh(paths)
+	return nil
+}
+
+func (s single) Close(local, remote pan.UDPAddr) error {
+	return s.s.Close()
+}
+
+// inProcess is a selector.Selector in front of the middleware, it remembers
+// the addresses of its connection
+type inProcess struct {
+	next          ServerSelector
+	mu            sync.Mutex
+	local, remote pan.UDPAddr
+}
+
+func (s *inProcess) addrs() (pan.UDPAddr, pan.UDPAddr) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.local, s.remote
+}
+
+func (s *inProcess) Initialize(local, remote pan.UDPAddr, paths []*pan.Path) {
+	s.mu.Lock()
+	s.local, s.remote = local, remote
+	s.mu.Unlock()
+	s.next.Initialize(nil, local, remote, paths)
+}
+
+func (s *inProcess) SetPreferences(prefs map[string]string) error {
+	local, remote := s.addrs()
+	return s.next.SetPreferences(prefs, local, remote)
+}
+
+func (s *inProcess) Path() *pan.Path {
+	local, remote := s.addrs()
+	p, _ := s.next.Path(local, remote)
+	return p
+}
+
+func (s *inProcess) PathDown(fp pan.PathFingerprint, pi pan.PathInterface) {
+	local, remote := s.addrs()
+	s.next.PathDown(local, remote, fp, pi)
+}
+
+func (s *inProcess) Refresh(paths []*pan.Path) {
+	local, remote := s.addrs()
+	s.next.Refresh(local, remote, paths)
+}
+
+func (s *inProcess) Close() error {
+	local, remote := s.addrs()
+	return s.next.Close(local, remote)
+}
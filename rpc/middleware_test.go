@@ -0,0 +1,140 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+// countingSelector selects the last path. It counts the calls to Path and
+// fails them with err.
+type countingSelector struct {
+	firstPathSelector
+	calls int
+	err   error
+}
+
+func (s *countingSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	s.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	return s.paths[len(s.paths)-1], nil
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) Middleware {
+		return func(next ServerSelector) ServerSelector {
+			order = append(order, name)
+			return next
+		}
+	}
+	Chain(&firstPathSelector{}, mw("outer"), mw("inner"))
+	if len(order) != 2 || order[0] != "inner" || order[1] != "outer" {
+		t.Errorf("wrapped in order %v, want [inner outer]", order)
+	}
+}
+
+func TestCache(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	paths := []*pan.Path{{Fingerprint: "a"}, {Fingerprint: "b"}}
+	c := clock.NewManual(time.Unix(0, 0))
+	next := &countingSelector{}
+	s := Chain(next, Cache(time.Second, c))
+	s.Initialize(nil, local, remote, paths)
+
+	for i := 0; i < 3; i++ {
+		if p, err := s.Path(local, remote); err != nil || p.Fingerprint != "b" {
+			t.Fatalf("Path() = %v, %v", p, err)
+		}
+	}
+	if next.calls != 1 {
+		t.Errorf("%d calls within the TTL, want 1", next.calls)
+	}
+	c.Advance(time.Second)
+	s.Path(local, remote)
+	if next.calls != 2 {
+		t.Errorf("%d calls after the TTL, want 2", next.calls)
+	}
+	s.Refresh(local, remote, paths[:1])
+	if p, _ := s.Path(local, remote); p.Fingerprint != "a" {
+		t.Errorf("Path() after Refresh = %s, want a", p.Fingerprint)
+	}
+}
+
+// metadataPaths returns paths with empty metadata, which the default selector
+// relies on
+func metadataPaths(fps ...pan.PathFingerprint) []*pan.Path {
+	paths := make([]*pan.Path, len(fps))
+	for i, fp := range fps {
+		paths[i] = &pan.Path{Fingerprint: fp, Metadata: &pan.PathMetadata{}}
+	}
+	return paths
+}
+
+func TestFallback(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	paths := metadataPaths("a", "b")
+	next := &countingSelector{}
+	s := Chain(next, Fallback(NewServerSelectorFunc(func(pan.UDPAddr, pan.UDPAddr) selector.Selector {
+		return &selector.DefaultSelector{}
+	})))
+	s.Initialize(nil, local, remote, paths)
+
+	for _, c := range []struct {
+		err  error
+		want pan.PathFingerprint
+	}{
+		{nil, "b"},
+		{ErrScriptTimeout, "a"},
+		{&Error{Code: CodeScriptError, Msg: "attempt to index a nil value"}, "a"},
+		{ErrUnknownConnection, ""},
+	} {
+		next.err = c.err
+		p, err := s.Path(local, remote)
+		if c.want == "" {
+			if p != nil || err != c.err {
+				t.Errorf("Path() failing with %v = %v, %v, want the error", c.err, p, err)
+			}
+			continue
+		}
+		if err != nil || p == nil || p.Fingerprint != c.want {
+			t.Errorf("Path() failing with %v = %v, %v, want %s", c.err, p, err, c.want)
+		}
+	}
+}
+
+func TestInProcess(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	c := clock.NewManual(time.Unix(0, 0))
+	s := selector.Chain(selector.NewProfileSelector(nil), InProcess(Cache(time.Second, c)))
+	s.Initialize(local, remote, metadataPaths("a", "b"))
+	if p := s.Path(); p == nil || p.Fingerprint != "a" {
+		t.Fatalf("Path() = %v, want a", p)
+	}
+	// the cache must not hide a path going down
+	s.PathDown("a", pan.PathInterface{})
+	if p := s.Path(); p == nil || p.Fingerprint != "b" {
+		t.Errorf("Path() after PathDown = %v, want b", p)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+}
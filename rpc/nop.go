@@ -0,0 +1,91 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// NopConnectionTracer implements ServerConnectionTracer doing nothing. Embed
+// it in tracers that are only interested in a few of the calls.
+type NopConnectionTracer struct{}
+
+func (NopConnectionTracer) TracerForConnection(uint64, logging.Perspective, logging.ConnectionID) error {
+	return nil
+}
+func (NopConnectionTracer) StartedConnection(_, _ *pan.UDPAddr, _, _ logging.ConnectionID) error {
+	return nil
+}
+func (NopConnectionTracer) NegotiatedVersion(_, _ *pan.UDPAddr, _ logging.VersionNumber, _, _ []logging.VersionNumber) error {
+	return nil
+}
+func (NopConnectionTracer) ClosedConnection(_, _ *pan.UDPAddr, _ error) error { return nil }
+func (NopConnectionTracer) SentTransportParameters(_, _ *pan.UDPAddr, _ *logging.TransportParameters) error {
+	return nil
+}
+func (NopConnectionTracer) ReceivedTransportParameters(_, _ *pan.UDPAddr, _ *logging.TransportParameters) error {
+	return nil
+}
+func (NopConnectionTracer) RestoredTransportParameters(_, _ *pan.UDPAddr, _ *logging.TransportParameters) error {
+	return nil
+}
+func (NopConnectionTracer) SentPacket(_, _ *pan.UDPAddr, _ *logging.ExtendedHeader, _ logging.ByteCount, _ *logging.AckFrame, _ []logging.Frame) error {
+	return nil
+}
+func (NopConnectionTracer) ReceivedVersionNegotiationPacket(_, _ *pan.UDPAddr, _ *logging.Header, _ []logging.VersionNumber) error {
+	return nil
+}
+func (NopConnectionTracer) ReceivedRetry(_, _ *pan.UDPAddr, _ *logging.Header) error { return nil }
+func (NopConnectionTracer) ReceivedPacket(_, _ *pan.UDPAddr, _ *logging.ExtendedHeader, _ logging.ByteCount, _ []logging.Frame) error {
+	return nil
+}
+func (NopConnectionTracer) BufferedPacket(_, _ *pan.UDPAddr, _ logging.PacketType) error { return nil }
+func (NopConnectionTracer) DroppedPacket(_, _ *pan.UDPAddr, _ logging.PacketType, _ logging.ByteCount, _ logging.PacketDropReason) error {
+	return nil
+}
+func (NopConnectionTracer) UpdatedMetrics(_, _ *pan.UDPAddr, _ *RTTStats, _, _ logging.ByteCount, _ int) error {
+	return nil
+}
+func (NopConnectionTracer) AcknowledgedPacket(_, _ *pan.UDPAddr, _ logging.EncryptionLevel, _ logging.PacketNumber) error {
+	return nil
+}
+func (NopConnectionTracer) LostPacket(_, _ *pan.UDPAddr, _ logging.EncryptionLevel, _ logging.PacketNumber, _ logging.PacketLossReason) error {
+	return nil
+}
+func (NopConnectionTracer) UpdatedCongestionState(_, _ *pan.UDPAddr, _ logging.CongestionState) error {
+	return nil
+}
+func (NopConnectionTracer) UpdatedPTOCount(_, _ *pan.UDPAddr, _ uint32) error { return nil }
+func (NopConnectionTracer) UpdatedKeyFromTLS(_, _ *pan.UDPAddr, _ logging.EncryptionLevel, _ logging.Perspective) error {
+	return nil
+}
+func (NopConnectionTracer) UpdatedKey(_, _ *pan.UDPAddr, _ logging.KeyPhase, _ bool) error {
+	return nil
+}
+func (NopConnectionTracer) DroppedEncryptionLevel(_, _ *pan.UDPAddr, _ logging.EncryptionLevel) error {
+	return nil
+}
+func (NopConnectionTracer) DroppedKey(_, _ *pan.UDPAddr, _ logging.KeyPhase) error { return nil }
+func (NopConnectionTracer) SetLossTimer(_, _ *pan.UDPAddr, _ logging.TimerType, _ logging.EncryptionLevel, _ time.Time) error {
+	return nil
+}
+func (NopConnectionTracer) LossTimerExpired(_, _ *pan.UDPAddr, _ logging.TimerType, _ logging.EncryptionLevel) error {
+	return nil
+}
+func (NopConnectionTracer) LossTimerCanceled(_, _ *pan.UDPAddr) error  { return nil }
+func (NopConnectionTracer) Close(_, _ *pan.UDPAddr) error              { return nil }
+func (NopConnectionTracer) Debug(_, _ *pan.UDPAddr, _, _ string) error { return nil }
@@ -0,0 +1,121 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+type OverrideKind int
+
+const (
+	// OverridePin forces matching connections onto the path with Fingerprint
+	OverridePin OverrideKind = iota
+	// OverrideExcludeIA keeps matching connections off paths crossing IA
+	OverrideExcludeIA
+	// OverrideExcludeInterface keeps matching connections off paths crossing
+	// interface IfID of IA
+	OverrideExcludeInterface
+)
+
+func (k OverrideKind) String() string {
+	switch k {
+	case OverridePin:
+		return "pin"
+	case OverrideExcludeIA:
+		return "exclude-ia"
+	case OverrideExcludeInterface:
+		return "exclude-interface"
+	}
+	return fmt.Sprintf("OverrideKind(%d)", int(k))
+}
+
+// Override is an operator decision that supersedes the path selector.
+// An Override applies to a single connection if Connection is set, to all
+// connections towards Destination if that is set, or to all connections if
+// neither is.
+type Override struct {
+	ID          int
+	Kind        OverrideKind
+	Connection  int
+	Destination pan.IA
+	Fingerprint pan.PathFingerprint
+	IA          pan.IA
+	IfID        pan.IfID
+	// Expires is the point in time after which the Override is dropped, the
+	// zero value means never
+	Expires time.Time
+}
+
+func (o Override) String() string {
+	s := fmt.Sprintf("[%d] %s", o.ID, o.Kind)
+	switch o.Kind {
+	case OverridePin:
+		s += fmt.Sprintf(" %q", o.Fingerprint)
+	case OverrideExcludeIA:
+		s += " " + o.IA.String()
+	case OverrideExcludeInterface:
+		s += fmt.Sprintf(" %s#%d", o.IA, o.IfID)
+	}
+	if o.Connection != 0 {
+		s += fmt.Sprintf(" connection=%d", o.Connection)
+	}
+	if !o.Destination.IsZero() {
+		s += " destination=" + o.Destination.String()
+	}
+	if !o.Expires.IsZero() {
+		s += " expires=" + o.Expires.Format(time.RFC3339)
+	}
+	return s
+}
+
+func (o *Override) expired(now time.Time) bool {
+	return !o.Expires.IsZero() && now.After(o.Expires)
+}
+
+func (o *Override) appliesTo(c *connection) bool {
+	return (o.Connection == 0 || o.Connection == c.id) &&
+		(o.Destination.IsZero() || o.Destination == c.remote.IA)
+}
+
+// excludes reports whether the path p is ruled out by the override.
+// Paths without metadata can not be checked and are never excluded.
+func (o *Override) excludes(p *pan.Path) bool {
+	if p == nil || p.Metadata == nil {
+		return false
+	}
+	for _, i := range p.Metadata.Interfaces {
+		switch o.Kind {
+		case OverrideExcludeIA:
+			if i.IA == o.IA {
+				return true
+			}
+		case OverrideExcludeInterface:
+			if i.IA == o.IA && i.IfID == o.IfID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// OverrideObserver is told by an AdminSelector when the choice of path of its
+// selector was superseded by an Override. chosen is empty if the selector was
+// not consulted at all.
+type OverrideObserver interface {
+	Overridden(local, remote pan.UDPAddr, chosen, actual pan.PathFingerprint, reason string) error
+}
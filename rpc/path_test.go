@@ -0,0 +1,62 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// pantest depends on rpc, hence the external test package
+package rpc_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+func TestSelectorMsgRoundTrip(t *testing.T) {
+	local, remote := pantest.Addr("1-ff00:0:110,127.0.0.1:1"), pantest.Addr("1-ff00:0:111,127.0.0.2:2")
+	p := pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").
+		Latency(time.Millisecond, 2*time.Millisecond, 3*time.Millisecond).
+		Bandwidth(100, 200, 300).
+		Geo(pantest.At(1, 2), pantest.At(3, 4), pantest.At(5, 6), pantest.At(7, 8)).
+		Notes("transit").
+		Expiry(time.Unix(1000, 0).UTC()).
+		Build()
+	intf := p.Metadata.Interfaces[2]
+	msg := rpc.SelectorMsg{
+		Local:         &local,
+		Remote:        &remote,
+		Fingerprint:   &p.Fingerprint,
+		PathInterface: &intf,
+		Preferences:   map[string]string{"latency": "low"},
+		Paths:         []*rpc.Path{rpc.NewPathFrom(p)},
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(&msg); err != nil {
+		t.Fatal(err)
+	}
+	var got rpc.SelectorMsg
+	if err := gob.NewDecoder(&b).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Paths[0].PanPath(), p) {
+		t.Errorf("path changed in transit:\n got %+v\nwant %+v", got.Paths[0].PanPath(), p)
+	}
+	if *got.Local != local || *got.Remote != remote || *got.PathInterface != intf || got.Preferences["latency"] != "low" {
+		t.Errorf("message changed in transit: %+v", got)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"sync"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+// PathPolicies is the middleware enforcing the policy each connection sets
+// with the selector.PathPolicyKey preference. The selector only gets to see
+// the paths complying with it, and any other path it returns is rejected
+// with CodePolicyDenied.
+func PathPolicies(next ServerSelector) ServerSelector {
+	return &policySelector{next: next, conns: map[string]*policed{}}
+}
+
+// policed is a connection, which may have a path policy
+type policed struct {
+	// nil without policy
+	policy pan.Policy
+	// all paths, regardless of the policy
+	paths   []*pan.Path
+	allowed map[pan.PathFingerprint]bool
+}
+
+// filter returns the paths complying with the policy, and remembers them
+func (c *policed) filter() []*pan.Path {
+	if c.policy == nil {
+		c.allowed = nil
+		return c.paths
+	}
+	paths := c.policy.Filter(c.paths)
+	c.allowed = make(map[pan.PathFingerprint]bool, len(paths))
+	for _, p := range paths {
+		c.allowed[p.Fingerprint] = true
+	}
+	return paths
+}
+
+type policySelector struct {
+	next  ServerSelector
+	mu    sync.Mutex
+	conns map[string]*policed
+}
+
+// parsePolicy returns the policy in prefs, nil if there is none
+func parsePolicy(prefs map[string]string) (pan.Policy, error) {
+	s, ok := prefs[selector.PathPolicyKey]
+	if !ok || s == "" {
+		return nil, nil
+	}
+	policy, err := selector.ParsePathPolicy(s)
+	if err != nil {
+		return nil, NewError(CodeInvalidArgument, err)
+	}
+	return policy, nil
+}
+
+// Initialize passes on the complying paths. An invalid policy is reported,
+// the connection is initialized without one.
+func (s *policySelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	key := local.String() + remote.String()
+	policy, err := parsePolicy(prefs)
+	c := &policed{policy: policy, paths: paths}
+	s.mu.Lock()
+	s.conns[key] = c
+	paths = c.filter()
+	s.mu.Unlock()
+	if nerr := s.next.Initialize(prefs, local, remote, paths); nerr != nil {
+		return nerr
+	}
+	return err
+}
+
+// SetPreferences applies a new policy by refreshing the paths of the
+// selector, an empty one lifts it. Preferences with an invalid policy are
+// rejected as a whole.
+func (s *policySelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	policy, err := parsePolicy(prefs)
+	if err != nil {
+		return err
+	}
+	if err := s.next.SetPreferences(prefs, local, remote); err != nil {
+		return err
+	}
+	if _, ok := prefs[selector.PathPolicyKey]; !ok {
+		return nil
+	}
+	s.mu.Lock()
+	c, ok := s.conns[local.String()+remote.String()]
+	if !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	c.policy = policy
+	paths := c.filter()
+	s.mu.Unlock()
+	return s.next.Refresh(local, remote, paths)
+}
+
+func (s *policySelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	p, err := s.next.Path(local, remote)
+	if p == nil || err != nil {
+		return p, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if c, ok := s.conns[local.String()+remote.String()]; ok && c.policy != nil && !c.allowed[p.Fingerprint] {
+		return nil, &Error{Code: CodePolicyDenied, Msg: "path " + string(p.Fingerprint) + " violates the path policy"}
+	}
+	return p, nil
+}
+
+func (s *policySelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	return s.next.PathDown(local, remote, fp, pi)
+}
+
+func (s *policySelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.mu.Lock()
+	if c, ok := s.conns[local.String()+remote.String()]; ok {
+		c.paths = paths
+		paths = c.filter()
+	}
+	s.mu.Unlock()
+	return s.next.Refresh(local, remote, paths)
+}
+
+func (s *policySelector) Close(local, remote pan.UDPAddr) error {
+	s.mu.Lock()
+	delete(s.conns, local.String()+remote.String())
+	s.mu.Unlock()
+	return s.next.Close(local, remote)
+}
@@ -0,0 +1,91 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+// stubbornSelector selects the first of the paths it was initialized with,
+// and ignores refreshes
+type stubbornSelector struct {
+	firstPathSelector
+	refreshed []*pan.Path
+}
+
+func (s *stubbornSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.refreshed = paths
+	return nil
+}
+
+func TestPathPolicies(t *testing.T) {
+	local, remote := pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}
+	path := func(fp pan.PathFingerprint, ias ...string) *pan.Path {
+		p := &pan.Path{Fingerprint: fp, Metadata: &pan.PathMetadata{}}
+		for i, ia := range ias {
+			p.Metadata.Interfaces = append(p.Metadata.Interfaces, pan.PathInterface{IA: pan.MustParseIA(ia), IfID: pan.IfID(i + 1)})
+		}
+		return p
+	}
+	paths := []*pan.Path{
+		path("via-112", "1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:112", "1-ff00:0:111"),
+		path("via-113", "1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:113", "1-ff00:0:111"),
+		{Fingerprint: "no-metadata"},
+	}
+	next := &stubbornSelector{}
+	s := PathPolicies(next)
+	prefs := map[string]string{selector.PathPolicyKey: `{"acl": ["- 1-ff00:0:112", "+"]}`}
+	if err := s.Initialize(prefs, local, remote, paths); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.paths) != 1 || next.paths[0].Fingerprint != "via-113" {
+		t.Fatalf("selector initialized with %v, want via-113 only", next.paths)
+	}
+	if p, err := s.Path(local, remote); err != nil || p.Fingerprint != "via-113" {
+		t.Errorf("Path() = %v, %v, want via-113", p, err)
+	}
+
+	prefs[selector.PathPolicyKey] = `{"sequence": "1-ff00:0:110 1-ff00:0:112 1-ff00:0:111"}`
+	if err := s.SetPreferences(prefs, local, remote); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.refreshed) != 1 || next.refreshed[0].Fingerprint != "via-112" {
+		t.Errorf("selector refreshed with %v, want via-112 only", next.refreshed)
+	}
+	// the selector still returns via-113
+	if p, err := s.Path(local, remote); p != nil || !errors.Is(err, ErrPolicyDenied) {
+		t.Errorf("Path() = %v, %v, want %v", p, err, ErrPolicyDenied)
+	}
+
+	for _, policy := range []string{`{}`, `{"acl": ["- 1-ff00:0:112"]}`, `{"sequence": "1-ff00:0:110 ("}`, `{"allow": ["+"]}`} {
+		err := s.SetPreferences(map[string]string{selector.PathPolicyKey: policy}, local, remote)
+		if !errors.Is(err, ErrInvalidArgument) {
+			t.Errorf("SetPreferences(%s) = %v, want %v", policy, err, ErrInvalidArgument)
+		}
+	}
+
+	if err := s.SetPreferences(map[string]string{selector.PathPolicyKey: ""}, local, remote); err != nil {
+		t.Fatal(err)
+	}
+	if len(next.refreshed) != len(paths) {
+		t.Errorf("selector refreshed with %d paths after lifting the policy, want %d", len(next.refreshed), len(paths))
+	}
+	if p, err := s.Path(local, remote); err != nil || p.Fingerprint != "via-113" {
+		t.Errorf("Path() without policy = %v, %v, want via-113", p, err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"sync"
+
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+// ProfileBackend selects paths for the daemon without a script, with a
+// selector.ProfileSelector per connection. All of them share their usage.
+type ProfileBackend struct {
+	mu    sync.Mutex
+	usage *selector.Usage
+	conns map[string]*selector.ProfileSelector
+}
+
+func NewProfileBackend() *ProfileBackend {
+	return &ProfileBackend{
+		usage: selector.NewUsage(),
+		conns: map[string]*selector.ProfileSelector{},
+	}
+}
+
+// get returns the selector of a connection, creating it if asked to
+func (b *ProfileBackend) get(local, remote pan.UDPAddr, create bool) (*selector.ProfileSelector, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := local.String() + remote.String()
+	s, ok := b.conns[key]
+	if !ok {
+		if !create {
+			return nil, ErrUnknownConnection
+		}
+		s = selector.NewProfileSelector(b.usage)
+		b.conns[key] = s
+	}
+	return s, nil
+}
+
+func (b *ProfileBackend) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s, _ := b.get(local, remote, true)
+	s.Initialize(local, remote, paths)
+	return b.setPreferences(s, prefs)
+}
+
+func (b *ProfileBackend) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	s, err := b.get(local, remote, false)
+	if err != nil {
+		return err
+	}
+	return b.setPreferences(s, prefs)
+}
+
+func (b *ProfileBackend) setPreferences(s *selector.ProfileSelector, prefs map[string]string) error {
+	if err := s.SetPreferences(prefs); err != nil {
+		return NewError(CodeInvalidArgument, err)
+	}
+	return nil
+}
+
+func (b *ProfileBackend) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	s, err := b.get(local, remote, false)
+	if err != nil {
+		return nil, err
+	}
+	return s.Path(), nil
+}
+
+func (b *ProfileBackend) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s, err := b.get(local, remote, false)
+	if err != nil {
+		return err
+	}
+	s.PathDown(fp, pi)
+	return nil
+}
+
+func (b *ProfileBackend) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s, err := b.get(local, remote, false)
+	if err != nil {
+		return err
+	}
+	s.Refresh(paths)
+	return nil
+}
+
+func (b *ProfileBackend) Close(local, remote pan.UDPAddr) error {
+	s, err := b.get(local, remote, false)
+	if err != nil {
+		return err
+	}
+	b.mu.Lock()
+	delete(b.conns, local.String()+remote.String())
+	b.mu.Unlock()
+	return s.Close()
+}
+
+// ConnectionTracer returns the tracer that feeds the metrics of the
+// connections back to their selectors
+func (b *ProfileBackend) ConnectionTracer() ServerConnectionTracer {
+	return profileTracer{b: b}
+}
+
+type profileTracer struct {
+	NopConnectionTracer
+	b *ProfileBackend
+}
+
+func (t profileTracer) UpdatedMetrics(local, remote *pan.UDPAddr, rttStats *RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) error {
+	if local == nil || remote == nil || rttStats == nil {
+		return nil
+	}
+	// connections may be traced before their selector is initialized
+	if s, err := t.b.get(*local, *remote, false); err == nil {
+		s.UpdatedMetrics(rttStats.SmoothedRTT, uint64(cwnd))
+	}
+	return nil
+}
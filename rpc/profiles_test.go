@@ -0,0 +1,69 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package rpc
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+func TestProfileBackend(t *testing.T) {
+	b := NewProfileBackend()
+	ct := b.ConnectionTracer()
+	local := pan.MustParseUDPAddr("1-ff00:0:110,127.0.0.1:1")
+	remote := pan.MustParseUDPAddr("1-ff00:0:111,127.0.0.2:2")
+	paths := []*pan.Path{
+		{Fingerprint: "a", Metadata: &pan.PathMetadata{Latency: []time.Duration{40 * time.Millisecond}}},
+		{Fingerprint: "b", Metadata: &pan.PathMetadata{Latency: []time.Duration{30 * time.Millisecond}}},
+	}
+
+	if _, err := b.Path(local, remote); err != ErrUnknownConnection {
+		t.Errorf("Path() before Initialize = %v, want %v", err, ErrUnknownConnection)
+	}
+	prefs := map[string]string{"ConnCapacityProfile": "LowLatency"}
+	if err := b.Initialize(prefs, local, remote, paths); err != nil {
+		t.Fatal(err)
+	}
+	path := func() pan.PathFingerprint {
+		t.Helper()
+		p, err := b.Path(local, remote)
+		if err != nil || p == nil {
+			t.Fatalf("Path() = %v, %v", p, err)
+		}
+		return p.Fingerprint
+	}
+	if fp := path(); fp != "b" {
+		t.Errorf("Path() = %s, want b", fp)
+	}
+	// b turns out slower than announced
+	if err := ct.UpdatedMetrics(&local, &remote, &RTTStats{SmoothedRTT: 100 * time.Millisecond}, 10000, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if fp := path(); fp != "a" {
+		t.Errorf("Path() after feedback = %s, want a", fp)
+	}
+	err := b.SetPreferences(map[string]string{"ConnCapacityProfile": "Fastest"}, local, remote)
+	if !errors.Is(err, ErrInvalidArgument) {
+		t.Errorf("SetPreferences(Fastest) = %v, want %v", err, ErrInvalidArgument)
+	}
+	if err := b.Close(local, remote); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.Close(local, remote); err != ErrUnknownConnection {
+		t.Errorf("Close() twice = %v, want %v", err, ErrUnknownConnection)
+	}
+}
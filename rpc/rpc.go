@@ -14,14 +14,12 @@
 package rpc
 
 import (
-	"fmt"
 	"io"
-	"log"
 	"net/rpc"
-	"os"
-	"time"
 
 	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsys-lab/pan-lua/logger"
+	"go.uber.org/zap"
 )
 
 type IDMsg struct {
@@ -38,48 +36,35 @@ func (s *IDServer) GetID(arg, resp *IDMsg) error {
 	return nil
 }
 
+// NewServer returns a new RPC server for selector, tracer and
+// connectionTracer. Each call gets its own server, so that several can run
+// in one process.
 func NewServer(selector ServerSelector, tracer logging.Tracer, connectionTracer ServerConnectionTracer) (*rpc.Server, error) {
-	/*err := rpc.Register(IDServer{42})
-	if err != nil {
-		panic(err)
-		return nil, err
-	}*/
-	err := rpc.Register(NewSelectorServer(selector))
+	server := rpc.NewServer()
+	err := server.Register(NewSelectorServer(selector))
 	if err != nil {
 		return nil, err
 	}
-	err = rpc.Register(NewTracerServer(tracer))
+	err = server.Register(NewTracerServer(tracer))
 	if err != nil {
 		return nil, err
 	}
-	err = rpc.Register(NewConnectionTracerServer(connectionTracer))
+	err = server.Register(NewConnectionTracerServer(connectionTracer))
 	if err != nil {
 		return nil, err
 	}
-	return rpc.DefaultServer, nil
+	return server, nil
 }
 
 type Client struct {
 	client *rpc.Client
-	l      *log.Logger
+	l      *zap.SugaredLogger
 	id     int
 }
 
 func NewClient(conn io.ReadWriteCloser) (*Client, error) {
 	client := rpc.NewClient(conn)
-	fname := fmt.Sprintf("/tmp/%s-quic-rpc-client.log", time.Now().Format("2006-01-02-15-04"))
-	//log.Println("quic rpc client file opened as", fname)
-	f, err := os.Create(fname)
-	if err != nil {
-		return nil, err
-	}
-	//FIXME
-	go func(f *os.File) {
-		for f.Sync() == nil {
-			time.Sleep(time.Second)
-		}
-	}(f)
-	//f := os.Stderr
+	l := logger.Default().Named("rpc-client").Sugar()
 
 	n := 42
 	var id = &IDMsg{Value: &n}
@@ -88,15 +73,31 @@ func NewClient(conn io.ReadWriteCloser) (*Client, error) {
 		return nil, err
 	} else {*/
 
-	log.Printf("RPC connection etablished")
+	l.Debug("RPC connection established")
 	//}
 
-	return &Client{client, log.New(f, "rpc-client", log.Lshortfile|log.Ltime), *id.Value}, nil
+	return &Client{client, l, *id.Value}, nil
 }
 
 func (c *Client) Call(serviceMethod string, args interface{}, reply interface{}) error {
-	c.l.Printf("RPC: %s called", serviceMethod)
-	return c.client.Call(serviceMethod, args, reply)
+	c.l.Debugw("RPC call", "method", serviceMethod)
+	if err := c.client.Call(serviceMethod, args, reply); err != nil {
+		return decodeError(err)
+	}
+	return nil
+}
+
+// check handles the error of a call whose caller has no way to return it.
+// Errors with a code are logged, others leave the client unusable and are
+// fatal.
+func (c *Client) check(method string, err error) {
+	if err == nil {
+		return
+	}
+	if CodeOf(err) == CodeUnknown {
+		c.l.Fatalw("RPC call failed", "method", method, "error", err)
+	}
+	c.l.Warnw("RPC call failed", "method", method, "error", err)
 }
 
 func (c *Client) Close() error {
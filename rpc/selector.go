@@ -15,11 +15,12 @@ package rpc
 
 import (
 	"errors"
-	"log"
 	"net"
+	"sync"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
 	"github.com/netsys-lab/pan-lua/selector"
+	"go.uber.org/zap"
 )
 
 var (
@@ -27,7 +28,12 @@ var (
 		Name: "/tmp/scion-pan-rpc.sock",
 		Net:  "unix",
 	}
-	ErrDeref = errors.New("Can not dereference Nil value")
+	ErrDeref = &Error{Code: CodeInvalidArgument, Msg: "Can not dereference Nil value"}
+	// ErrNoTracer is returned for tracer calls to a server without tracer
+	ErrNoTracer = &Error{Code: CodeInvalidArgument, Msg: "no tracer"}
+	// ErrUnknownTracer is returned for calls concerning a connection no
+	// tracer was created for
+	ErrUnknownTracer = &Error{Code: CodeUnknownConnection, Msg: "no tracer for connection"}
 )
 
 type ServerSelector interface {
@@ -41,14 +47,17 @@ type ServerSelector interface {
 
 type serverSelector struct {
 	fn        func(pan.UDPAddr, pan.UDPAddr) selector.Selector
+	mu        sync.Mutex
 	selectors map[string]selector.Selector
 }
 
 func NewServerSelectorFunc(fn func(pan.UDPAddr, pan.UDPAddr) selector.Selector) ServerSelector {
-	return serverSelector{fn, map[string]selector.Selector{}}
+	return &serverSelector{fn: fn, selectors: map[string]selector.Selector{}}
 }
 
 func (s *serverSelector) getSelector(local, remote pan.UDPAddr) selector.Selector {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	addr := local.String() + remote.String()
 	selector, ok := s.selectors[addr]
 	if !ok {
@@ -58,32 +67,34 @@ func (s *serverSelector) getSelector(local, remote pan.UDPAddr) selector.Selecto
 	return selector
 }
 
-func (s serverSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+func (s *serverSelector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
 	s.getSelector(local, remote).Initialize(local, remote, paths)
 	return nil
 }
 
-func (s serverSelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+func (s *serverSelector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
 	return s.getSelector(local, remote).SetPreferences(prefs)
 }
 
-func (s serverSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+func (s *serverSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
 	return s.getSelector(local, remote).Path(), nil
 }
 
-func (s serverSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+func (s *serverSelector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
 	s.getSelector(local, remote).PathDown(fp, pi)
 	return nil
 }
 
-func (s serverSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+func (s *serverSelector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
 	s.getSelector(local, remote).Refresh(paths)
 	return nil
 }
 
-func (s serverSelector) Close(local, remote pan.UDPAddr) error {
+func (s *serverSelector) Close(local, remote pan.UDPAddr) error {
 	err := s.getSelector(local, remote).Close()
+	s.mu.Lock()
 	delete(s.selectors, local.String()+remote.String())
+	s.mu.Unlock()
 	return err
 }
 
@@ -117,16 +128,27 @@ func NewSelectorServer(selector ServerSelector) *SelectorServer {
 	return &SelectorServer{selector}
 }
 
-func (s *SelectorServer) Initialize(args, resp *SelectorMsg) error {
-	//log.Println("Initialize invoked")
-	paths := make([]*pan.Path, len(args.Paths))
-	for i, p := range args.Paths {
+// panPaths converts the paths of a message, which must not contain nil
+func panPaths(ps []*Path) ([]*pan.Path, error) {
+	paths := make([]*pan.Path, len(ps))
+	for i, p := range ps {
+		if p == nil {
+			return nil, ErrDeref
+		}
 		paths[i] = p.PanPath()
-		//log.Printf("%s", paths[i].Source)
 	}
+	return paths, nil
+}
+
+func (s *SelectorServer) Initialize(args, resp *SelectorMsg) error {
+	//log.Println("Initialize invoked")
 	if args.Local == nil || args.Remote == nil {
 		return ErrDeref
 	}
+	paths, err := panPaths(args.Paths)
+	if err != nil {
+		return err
+	}
 	return s.selector.Initialize(args.Preferences, *args.Local, *args.Remote, paths)
 }
 
@@ -139,19 +161,23 @@ func (s *SelectorServer) SetPreferences(args, resp *SelectorMsg) error {
 }
 
 func (s *SelectorServer) Path(args, resp *SelectorMsg) error {
-	if args.Remote == nil {
+	if args.Local == nil || args.Remote == nil {
 		return ErrDeref
 	}
 	p, err := s.selector.Path(*args.Local, *args.Remote)
-	if p != nil {
-		resp.Fingerprint = &p.Fingerprint
+	if err != nil {
+		return err
 	}
-	return err
+	if p == nil {
+		return ErrNoPath
+	}
+	resp.Fingerprint = &p.Fingerprint
+	return nil
 }
 
 func (s *SelectorServer) PathDown(args, resp *SelectorMsg) error {
 	//log.Println("PathDown called")
-	if args.Remote == nil || args.Fingerprint == nil || args.PathInterface == nil {
+	if args.Local == nil || args.Remote == nil || args.Fingerprint == nil || args.PathInterface == nil {
 		return ErrDeref
 	}
 	return s.selector.PathDown(*args.Local, *args.Remote, *args.Fingerprint, *args.PathInterface)
@@ -159,20 +185,19 @@ func (s *SelectorServer) PathDown(args, resp *SelectorMsg) error {
 
 func (s *SelectorServer) Refresh(args, resp *SelectorMsg) error {
 	//log.Println("Refresh invoked")
-	paths := make([]*pan.Path, len(args.Paths))
-	for i, p := range args.Paths {
-		paths[i] = p.PanPath()
-		//log.Printf("%s", paths[i].Source)
-	}
-	if args.Remote == nil {
+	if args.Local == nil || args.Remote == nil {
 		return ErrDeref
 	}
+	paths, err := panPaths(args.Paths)
+	if err != nil {
+		return err
+	}
 	return s.selector.Refresh(*args.Local, *args.Remote, paths)
 }
 
 func (s *SelectorServer) Close(args, resp *SelectorMsg) error {
 	//log.Println("Close called")
-	if args.Remote == nil {
+	if args.Local == nil || args.Remote == nil {
 		return ErrDeref
 	}
 	return s.selector.Close(*args.Local, *args.Remote)
@@ -184,16 +209,48 @@ type SelectorClient struct {
 	paths                 map[pan.PathFingerprint]*pan.Path
 	local                 *pan.UDPAddr
 	remote                *pan.UDPAddr
-	l                     *log.Logger
+	l                     *zap.SugaredLogger
+	mu                    sync.Mutex // guards err
+	err                   error
 }
 
 func NewSelectorClient(client *Client) selector.Selector {
-	client.l.Printf("RPC connection etablished")
-	return &SelectorClient{map[string]string{}, client, map[pan.PathFingerprint]*pan.Path{}, nil, nil, client.l}
+	client.l.Debug("RPC connection established")
+	return &SelectorClient{
+		connectionPreferences: map[string]string{},
+		client:                client,
+		paths:                 map[pan.PathFingerprint]*pan.Path{},
+		l:                     client.l,
+	}
+}
+
+// Err returns the error of the most recent call that could not return it
+// itself, if any, and clears it. Its code tells whether to retry the call,
+// fall back to another selector or give up, see Code.
+func (s *SelectorClient) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.err
+	s.err = nil
+	return err
+}
+
+func (s *SelectorClient) setErr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// check records and handles the error of a call that cannot return it
+func (s *SelectorClient) check(method string, err error) {
+	if err != nil {
+		s.setErr(err)
+		s.client.check(method, err)
+	}
 }
 
 func (s *SelectorClient) Initialize(local, remote pan.UDPAddr, paths []*pan.Path) {
-	s.l.Println("Initialize called")
+	s.l.Debug("Initialize called")
 	s.remote = &remote
 	s.local = &local
 	ps := make([]*Path, len(paths))
@@ -201,19 +258,19 @@ func (s *SelectorClient) Initialize(local, remote pan.UDPAddr, paths []*pan.Path
 		s.paths[p.Fingerprint] = p
 		ps[i] = NewPathFrom(p)
 	}
+	// preferences set before the addresses were known are handed over now
 	err := s.client.Call("SelectorServer.Initialize", &SelectorMsg{
-		Local:  s.local,
-		Remote: s.remote,
-		Paths:  ps,
+		Local:       s.local,
+		Remote:      s.remote,
+		Preferences: s.connectionPreferences,
+		Paths:       ps,
 	}, &SelectorMsg{})
-	if err != nil {
-		s.l.Fatalln(err)
-	}
-	s.l.Printf("Initialize returned")
+	s.check("SelectorServer.Initialize", err)
+	s.l.Debug("Initialize returned")
 }
 
 func (s *SelectorClient) SetPreferences(prefs map[string]string) error {
-	s.l.Println("SetPreferences called")
+	s.l.Debug("SetPreferences called")
 	s.connectionPreferences = prefs
 	if s.local != nil && s.remote != nil {
 		return s.client.Call("SelectorServer.SetPreferences", &SelectorMsg{
@@ -224,7 +281,7 @@ func (s *SelectorClient) SetPreferences(prefs map[string]string) error {
 	} else {
 		//we don't know the connection-identifying local and remote addresses yet
 		//so we wait until "Initialize" gets called naturally
-		s.l.Println("local and remote addresses not yet known, doing nothing for now")
+		s.l.Debug("local and remote addresses not yet known, doing nothing for now")
 		return nil
 	}
 }
@@ -235,9 +292,11 @@ func (s *SelectorClient) Path() *pan.Path {
 		Local:  s.local,
 		Remote: s.remote,
 	}, &msg)
-	if err != nil {
-		s.l.Fatalln(err)
+	if errors.Is(err, ErrNoPath) {
+		s.setErr(err)
+		return nil
 	}
+	s.check("SelectorServer.Path", err)
 	if msg.Fingerprint != nil {
 		return s.paths[*msg.Fingerprint]
 	}
@@ -245,7 +304,7 @@ func (s *SelectorClient) Path() *pan.Path {
 }
 
 func (s *SelectorClient) PathDown(fp pan.PathFingerprint, pi pan.PathInterface) {
-	s.l.Println("PathDown called")
+	s.l.Debug("PathDown called")
 	s.paths[fp] = nil // remove from local table
 	err := s.client.Call("SelectorServer.PathDown", &SelectorMsg{
 		Local:         s.local,
@@ -253,14 +312,12 @@ func (s *SelectorClient) PathDown(fp pan.PathFingerprint, pi pan.PathInterface)
 		Fingerprint:   &fp,
 		PathInterface: &pi,
 	}, &SelectorMsg{})
-	if err != nil {
-		s.l.Fatalln(err)
-	}
+	s.check("SelectorServer.PathDown", err)
 
 }
 
 func (s *SelectorClient) Refresh(paths []*pan.Path) {
-	s.l.Println("Refresh called")
+	s.l.Debug("Refresh called")
 	ps := make([]*Path, len(paths))
 	for i, p := range paths {
 		s.paths[p.Fingerprint] = p
@@ -271,18 +328,18 @@ func (s *SelectorClient) Refresh(paths []*pan.Path) {
 		Remote: s.remote,
 		Paths:  ps,
 	}, &SelectorMsg{})
-	if err != nil {
-		s.l.Fatalln(err)
-	}
-	s.l.Printf("Refresh returned")
+	s.check("SelectorServer.Refresh", err)
+	s.l.Debug("Refresh returned")
 }
 
 func (s *SelectorClient) Close() error {
-	s.l.Println("Close called")
+	s.l.Debug("Close called")
 	err := s.client.Call("SelectorServer.Close", &SelectorMsg{Local: s.local, Remote: s.remote}, &SelectorMsg{})
 	if err != nil {
-		s.l.Println(err)
-		s.l.Println(s.client.client.Close())
+		s.l.Error(err)
+		if err := s.client.client.Close(); err != nil {
+			s.l.Error(err)
+		}
 		return err
 	}
 	return s.client.client.Close()
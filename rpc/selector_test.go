@@ -16,6 +16,10 @@ package rpc
 import (
 	"bytes"
 	"encoding/gob"
+	"errors"
+	"net"
+	"net/rpc"
+	"sync"
 	"testing"
 
 	"github.com/netsec-ethz/scion-apps/pkg/pan"
@@ -37,3 +41,81 @@ func TestSelectorMsgEncoding(t *testing.T) {
 	}
 	t.Logf("%+v", msg)
 }
+
+func TestSelectorServerRejectsNil(t *testing.T) {
+	s := NewSelectorServer(&firstPathSelector{})
+	local, remote := new(pan.UDPAddr), new(pan.UDPAddr)
+	handlers := map[string]func(args, resp *SelectorMsg) error{
+		"Initialize":     s.Initialize,
+		"SetPreferences": s.SetPreferences,
+		"Path":           s.Path,
+		"PathDown":       s.PathDown,
+		"Refresh":        s.Refresh,
+		"Close":          s.Close,
+	}
+	msgs := []SelectorMsg{
+		{},
+		{Local: local},
+		{Remote: remote},
+	}
+	for name, h := range handlers {
+		for _, msg := range msgs {
+			if err := h(&msg, &SelectorMsg{}); err != ErrDeref {
+				t.Errorf("%s(%+v) = %v, want %v", name, msg, err, ErrDeref)
+			}
+		}
+	}
+	msg := SelectorMsg{Local: local, Remote: remote, Paths: []*Path{nil}}
+	if err := s.Initialize(&msg, &SelectorMsg{}); err != ErrDeref {
+		t.Errorf("Initialize with nil path = %v, want %v", err, ErrDeref)
+	}
+	if err := s.Refresh(&msg, &SelectorMsg{}); err != ErrDeref {
+		t.Errorf("Refresh with nil path = %v, want %v", err, ErrDeref)
+	}
+}
+
+type noPathSelector struct {
+	firstPathSelector
+}
+
+func (s *noPathSelector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	return nil, ErrNoPath
+}
+
+func TestSelectorClientErr(t *testing.T) {
+	server := rpc.NewServer()
+	if err := server.Register(NewSelectorServer(&noPathSelector{})); err != nil {
+		t.Fatal(err)
+	}
+	conn, srv := net.Pipe()
+	go server.ServeConn(srv)
+	c, err := NewClient(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s := NewSelectorClient(c).(*SelectorClient)
+	s.Initialize(pan.UDPAddr{Port: 1}, pan.UDPAddr{Port: 2}, nil)
+
+	// Path and Err may be called from different goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			s.Path()
+		}()
+		go func() {
+			defer wg.Done()
+			s.Err()
+		}()
+	}
+	wg.Wait()
+	s.Path()
+	if err := s.Err(); !errors.Is(err, ErrNoPath) {
+		t.Errorf("Err() = %v, want %v", err, ErrNoPath)
+	}
+	if err := s.Err(); err != nil {
+		t.Errorf("Err() after Err() = %v, want nil", err)
+	}
+}
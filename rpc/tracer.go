@@ -15,19 +15,17 @@ package rpc
 
 import (
 	"context"
-	"fmt"
-	"log"
 	"net"
-	"os"
-	"time"
 
 	"github.com/lucas-clemente/quic-go"
 	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsys-lab/pan-lua/logger"
+	"go.uber.org/zap"
 )
 
 type TracerClient struct {
 	rpc *Client
-	l   *log.Logger
+	l   *zap.SugaredLogger
 }
 
 func NewTracerClient(client *Client) logging.Tracer {
@@ -38,14 +36,14 @@ func (c TracerClient) TracerForConnection(ctx context.Context, p logging.Perspec
 
 	id, ok := ctx.Value(quic.SessionTracingKey).(uint64)
 	if !ok {
-		c.l.Fatalln("cast failed")
+		c.l.Fatal("cast failed")
 	}
-	c.l.Printf("TracerForConnection %d %d", p, id)
+	c.l.Debugf("TracerForConnection %d %d", p, id)
 	return NewConnectionTracerClient(c.rpc, id, p, odcid)
 }
 
 func (c TracerClient) SentPacket(addr net.Addr, hdr *logging.Header, n logging.ByteCount, fs []logging.Frame) {
-	c.l.Printf("SentPacket %+v %+v %+v %+v", addr, hdr, n, fs)
+	c.l.Debugf("SentPacket %+v %+v %+v %+v", addr, hdr, n, fs)
 	c.rpc.Call(
 		"TracerServer.SentPacket",
 		&TracerMsg{
@@ -60,7 +58,7 @@ func (c TracerClient) SentPacket(addr net.Addr, hdr *logging.Header, n logging.B
 }
 
 func (c TracerClient) DroppedPacket(addr net.Addr, tp logging.PacketType, n logging.ByteCount, r logging.PacketDropReason) {
-	c.l.Printf("DroppedPacket %+v %+v %+v %+v", addr, tp, n, r)
+	c.l.Debugf("DroppedPacket %+v %+v %+v %+v", addr, tp, n, r)
 	c.rpc.Call(
 		"TracerServer.DroppedPacket",
 		&TracerMsg{
@@ -90,23 +88,11 @@ type TracerMsg struct {
 
 type TracerServer struct {
 	tracer logging.Tracer
-	f      *os.File
-	l      *log.Logger
+	l      *zap.SugaredLogger
 }
 
 func NewTracerServer(tracer logging.Tracer) *TracerServer {
-	fname := fmt.Sprintf("/tmp/%s-quic-server.log", time.Now().Format("2006-01-02-15-04"))
-	log.Println("quic tracer file opened as", fname)
-	f, err := os.Create(fname)
-	if err != nil {
-		panic(err)
-	}
-	go func(f *os.File) {
-		for f.Sync() == nil {
-			time.Sleep(time.Second)
-		}
-	}(f)
-	return &TracerServer{tracer, f, log.New(f, "tracer", log.Lshortfile|log.Ltime)}
+	return &TracerServer{tracer, logger.Default().Named("tracer").Sugar()}
 }
 
 /*func (s *TracerServer) TracerForConnection(args, resp *TracerMsg) error {
@@ -121,8 +107,11 @@ func NewTracerServer(tracer logging.Tracer) *TracerServer {
         }*/
 
 func (s *TracerServer) SentPacket(args, resp *TracerMsg) error {
+	if s.tracer == nil {
+		return ErrNoTracer
+	}
 	if args.Addr != nil && args.ByteCount != nil {
-		s.l.Printf("SentPacket %+v %+v %+v %+v", args.Addr, args.Header, *args.ByteCount, args.Frames)
+		s.l.Debugf("SentPacket %+v %+v %+v %+v", args.Addr, args.Header, *args.ByteCount, args.Frames)
 		s.tracer.SentPacket(args.Addr, args.Header, *args.ByteCount, args.Frames)
 	} else {
 		return ErrDeref
@@ -131,8 +120,11 @@ func (s *TracerServer) SentPacket(args, resp *TracerMsg) error {
 }
 
 func (s *TracerServer) DroppedPacket(args, resp *TracerMsg) error {
+	if s.tracer == nil {
+		return ErrNoTracer
+	}
 	if args.Addr != nil && args.PacketType != nil && args.ByteCount != nil && args.DropReason != nil {
-		s.l.Printf("DroppedPacket %+v %+v %+v %+v", args.Addr, *args.PacketType, *args.ByteCount, *args.DropReason)
+		s.l.Debugf("DroppedPacket %+v %+v %+v %+v", args.Addr, *args.PacketType, *args.ByteCount, *args.DropReason)
 		s.tracer.DroppedPacket(args.Addr, *args.PacketType, *args.ByteCount, *args.DropReason)
 	} else {
 		return ErrDeref
@@ -0,0 +1,97 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector
+
+import (
+	"sort"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// SharedLinks returns the interfaces both a and b pass through, in the order
+// of a
+func SharedLinks(a, b *pan.Path) []pan.PathInterface {
+	if a.Metadata == nil || b.Metadata == nil {
+		return nil
+	}
+	inB := map[pan.PathInterface]bool{}
+	for _, pi := range b.Metadata.Interfaces {
+		inB[pi] = true
+	}
+	var shared []pan.PathInterface
+	for _, pi := range a.Metadata.Interfaces {
+		if inB[pi] {
+			shared = append(shared, pi)
+		}
+	}
+	return shared
+}
+
+// Disjointness tells how little a and b have in common, from 0 if one passes
+// through all interfaces of the other to 1 for none in common, as the share
+// of the interfaces of the shorter path that the other one does not pass
+// through. Paths without metadata are not known to be disjoint from anything,
+// their disjointness is 0.
+func Disjointness(a, b *pan.Path) float64 {
+	if a.Metadata == nil || b.Metadata == nil {
+		return 0
+	}
+	n := len(a.Metadata.Interfaces)
+	if m := len(b.Metadata.Interfaces); m < n {
+		n = m
+	}
+	if n == 0 {
+		return 1
+	}
+	return 1 - float64(len(SharedLinks(a, b)))/float64(n)
+}
+
+// MostDisjoint picks up to k of paths, other than reference, that are as
+// disjoint as possible from reference and from each other. It adds one path
+// at a time, the one whose disjointness from the paths picked so far is
+// highest at its lowest, preferring fewer hops and then the order of paths
+// among equals. A nil reference starts out with the path of fewest hops.
+func MostDisjoint(paths []*pan.Path, reference *pan.Path, k int) []*pan.Path {
+	var candidates []*pan.Path
+	for _, p := range paths {
+		if reference == nil || p.Fingerprint != reference.Fingerprint {
+			candidates = append(candidates, p)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return hops(candidates[i]) < hops(candidates[j])
+	})
+	var picked, against []*pan.Path
+	if reference != nil {
+		against = append(against, reference)
+	}
+	for len(picked) < k && len(candidates) > 0 {
+		best, bestScore := 0, -1.0
+		for i, p := range candidates {
+			score := 1.0
+			for _, q := range against {
+				if d := Disjointness(p, q); d < score {
+					score = d
+				}
+			}
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		picked = append(picked, candidates[best])
+		against = append(against, candidates[best])
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+	return picked
+}
@@ -0,0 +1,80 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector_test
+
+import (
+	"testing"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+func TestDisjointness(t *testing.T) {
+	paths := pantest.Paths(
+		pantest.NewPath().Fingerprint("primary").
+			Interfaces("1-ff00:0:110#1", "1-ff00:0:112#2", "1-ff00:0:112#3", "1-ff00:0:111#4"),
+		// shares the first link with primary
+		pantest.NewPath().Fingerprint("partial").
+			Interfaces("1-ff00:0:110#1", "1-ff00:0:112#2", "1-ff00:0:112#5", "1-ff00:0:113#6", "1-ff00:0:113#7", "1-ff00:0:111#8"),
+		pantest.NewPath().Fingerprint("disjoint").
+			Interfaces("1-ff00:0:110#9", "1-ff00:0:114#10", "1-ff00:0:114#11", "1-ff00:0:111#12"),
+		// shares the first link with disjoint
+		pantest.NewPath().Fingerprint("via-114").
+			Interfaces("1-ff00:0:110#9", "1-ff00:0:114#10", "1-ff00:0:114#13", "1-ff00:0:113#14", "1-ff00:0:113#15", "1-ff00:0:111#16"),
+	)
+	primary, partial, disjoint := paths[0], paths[1], paths[2]
+
+	shared := selector.SharedLinks(primary, partial)
+	want := primary.Metadata.Interfaces[:2]
+	if len(shared) != 2 || shared[0] != want[0] || shared[1] != want[1] {
+		t.Errorf("SharedLinks(primary, partial) = %v, want %v", shared, want)
+	}
+	for _, c := range []struct {
+		a, b *pan.Path
+		want float64
+	}{
+		{primary, primary, 0},
+		{primary, partial, .5},
+		{primary, disjoint, 1},
+		{primary, &pan.Path{}, 0},
+	} {
+		if d := selector.Disjointness(c.a, c.b); d != c.want {
+			t.Errorf("Disjointness(%s, %s) = %v, want %v", c.a.Fingerprint, c.b.Fingerprint, d, c.want)
+		}
+	}
+
+	for _, c := range []struct {
+		reference *pan.Path
+		k         int
+		want      []pan.PathFingerprint
+	}{
+		{primary, 1, []pan.PathFingerprint{"disjoint"}},
+		// partial and via-114 are equally disjoint from the others
+		{primary, 2, []pan.PathFingerprint{"disjoint", "partial"}},
+		{nil, 2, []pan.PathFingerprint{"primary", "disjoint"}},
+		{primary, 5, []pan.PathFingerprint{"disjoint", "partial", "via-114"}},
+	} {
+		picked := selector.MostDisjoint(paths, c.reference, c.k)
+		if len(picked) != len(c.want) {
+			t.Errorf("MostDisjoint(%v, %d) = %d paths, want %v", c.reference, c.k, len(picked), c.want)
+			continue
+		}
+		for i, p := range picked {
+			if p.Fingerprint != c.want[i] {
+				t.Errorf("MostDisjoint(%v, %d)[%d] = %s, want %s", c.reference, c.k, i, p.Fingerprint, c.want[i])
+			}
+		}
+	}
+}
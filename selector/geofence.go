@@ -0,0 +1,263 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector
+
+import (
+	"bytes"
+	"compress/gzip"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+var (
+	ErrUnknownCountry = errors.New("unknown country code")
+	ErrInvalidPolygon = errors.New("polygon needs at least three vertices")
+	ErrUnknownGeoMode = errors.New("geofence mode must be strict or lenient")
+)
+
+// The modes of a geofence, which decide about hops of unknown location
+const (
+	// GeoLenient ignores hops of unknown location
+	GeoLenient = "lenient"
+	// GeoStrict excludes paths with any hop of unknown location
+	GeoStrict = "strict"
+)
+
+//go:embed countries.csv.gz
+var countriesCSV []byte
+
+var (
+	countriesOnce sync.Once
+	countries     map[string][]ring
+)
+
+// ring is a closed polygon of [latitude, longitude] vertices, with its
+// bounding box
+type ring struct {
+	v                              [][2]float32
+	minLat, minLon, maxLat, maxLon float32
+}
+
+func newRing(v [][2]float32) ring {
+	r := ring{v: v, minLat: 90, minLon: 180, maxLat: -90, maxLon: -180}
+	for _, p := range v {
+		r.minLat, r.maxLat = min32(r.minLat, p[0]), max32(r.maxLat, p[0])
+		r.minLon, r.maxLon = min32(r.minLon, p[1]), max32(r.maxLon, p[1])
+	}
+	return r
+}
+
+// crosses tells whether a ray from c towards increasing longitude crosses
+// an odd number of edges of r
+func (r ring) crosses(c pan.GeoCoordinates) bool {
+	if c.Latitude < r.minLat || c.Latitude > r.maxLat || c.Longitude > r.maxLon {
+		return false
+	}
+	in := false
+	for i, j := 0, len(r.v)-1; i < len(r.v); j, i = i, i+1 {
+		a, b := r.v[i], r.v[j]
+		if (a[0] > c.Latitude) != (b[0] > c.Latitude) &&
+			c.Longitude < (b[1]-a[1])*(c.Latitude-a[0])/(b[0]-a[0])+a[1] {
+			in = !in
+		}
+	}
+	return in
+}
+
+func min32(a, b float32) float32 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max32(a, b float32) float32 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// countryRings returns the rings of a country's boundary
+func countryRings(code string) ([]ring, bool) {
+	countriesOnce.Do(func() {
+		countries = map[string][]ring{}
+		zr, err := gzip.NewReader(bytes.NewReader(countriesCSV))
+		if err != nil {
+			panic(fmt.Sprintf("countries.csv.gz: %v", err))
+		}
+		csv, err := io.ReadAll(zr)
+		if err != nil {
+			panic(fmt.Sprintf("countries.csv.gz: %v", err))
+		}
+		for _, line := range strings.Split(string(csv), "\n") {
+			if line == "" || line[0] == '#' {
+				continue
+			}
+			f := strings.Split(line, ",")
+			v := make([][2]float32, 0, len(f)/2)
+			var lat, lon int
+			for i := 1; i+1 < len(f); i += 2 {
+				dlat, err1 := strconv.Atoi(f[i])
+				dlon, err2 := strconv.Atoi(f[i+1])
+				if err1 != nil || err2 != nil {
+					panic(fmt.Sprintf("countries.csv.gz: invalid ring of %s", f[0]))
+				}
+				lat, lon = lat+dlat, lon+dlon
+				v = append(v, [2]float32{float32(lat) / 100, float32(lon) / 100})
+			}
+			countries[f[0]] = append(countries[f[0]], newRing(v))
+		}
+	})
+	r, ok := countries[strings.ToUpper(code)]
+	return r, ok
+}
+
+// Region is an area of the world, either a country or a polygon. In JSON, a
+// country is given by its ISO 3166-1 alpha-2 code, such as "CH", a polygon
+// as a list of [latitude, longitude] vertices.
+//
+// Country boundaries are those of Natural Earth, simplified to within about
+// a kilometre at land borders and two along coasts, so hops right at a border
+// may be taken to be on the wrong side. Polygons must not cross the
+// antimeridian.
+type Region struct {
+	Country string
+	Polygon [][2]float32
+	rings   []ring
+}
+
+func (r *Region) UnmarshalJSON(b []byte) error {
+	if err := json.Unmarshal(b, &r.Country); err == nil {
+		var ok bool
+		if r.rings, ok = countryRings(r.Country); !ok {
+			return fmt.Errorf("%w: %s", ErrUnknownCountry, r.Country)
+		}
+		return nil
+	}
+	if err := json.Unmarshal(b, &r.Polygon); err != nil {
+		return err
+	}
+	if len(r.Polygon) < 3 {
+		return ErrInvalidPolygon
+	}
+	r.rings = []ring{newRing(r.Polygon)}
+	return nil
+}
+
+func (r *Region) MarshalJSON() ([]byte, error) {
+	if r.Country != "" {
+		return json.Marshal(r.Country)
+	}
+	return json.Marshal(r.Polygon)
+}
+
+// contains tells whether c lies in the region, that is inside an odd number
+// of its rings
+func (r *Region) contains(c pan.GeoCoordinates) bool {
+	rings := r.rings
+	if rings == nil {
+		if r.Country != "" {
+			rings, _ = countryRings(r.Country)
+		} else {
+			rings = []ring{newRing(r.Polygon)}
+		}
+	}
+	in := false
+	for _, rg := range rings {
+		if rg.crosses(c) {
+			in = !in
+		}
+	}
+	return in
+}
+
+// Geofence restricts paths to hops located in the allowed regions, if there
+// are any, and outside of the denied ones. Locations come from the Geo
+// metadata of the paths. Hops without location are ignored in the lenient
+// mode, the default, and exclude the path in the strict mode.
+type Geofence struct {
+	Allow []Region `json:"allow,omitempty"`
+	Deny  []Region `json:"deny,omitempty"`
+	Mode  string   `json:"mode,omitempty"`
+}
+
+func (g *Geofence) validate() error {
+	if g.Mode != "" && g.Mode != GeoLenient && g.Mode != GeoStrict {
+		return ErrUnknownGeoMode
+	}
+	return nil
+}
+
+// Filter returns the paths inside the fence
+func (g *Geofence) Filter(paths []*pan.Path) []*pan.Path {
+	var ps []*pan.Path
+	for _, p := range paths {
+		if g.Complies(p) {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
+
+// Complies tells whether all hops of p are inside the fence. A path without
+// metadata has no hops of known location, so it passes in the lenient mode
+// only. Policies from ParsePathPolicy with an ACL or sequence exclude such
+// paths before they reach the geofence.
+func (g *Geofence) Complies(p *pan.Path) bool {
+	if p.Metadata == nil {
+		return g.Mode != GeoStrict
+	}
+	for i := range p.Metadata.Interfaces {
+		var c pan.GeoCoordinates
+		if i < len(p.Metadata.Geo) {
+			c = p.Metadata.Geo[i]
+		}
+		if c.Latitude == 0 && c.Longitude == 0 {
+			if g.Mode == GeoStrict {
+				return false
+			}
+			continue
+		}
+		if !g.allows(c) {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *Geofence) allows(c pan.GeoCoordinates) bool {
+	for i := range g.Deny {
+		if g.Deny[i].contains(c) {
+			return false
+		}
+	}
+	if len(g.Allow) == 0 {
+		return true
+	}
+	for i := range g.Allow {
+		if g.Allow[i].contains(c) {
+			return true
+		}
+	}
+	return false
+}
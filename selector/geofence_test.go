@@ -0,0 +1,148 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+func TestGeofence(t *testing.T) {
+	var (
+		zurich    = pantest.At(47.37, 8.54)
+		frankfurt = pantest.At(50.11, 8.68)
+		moscow    = pantest.At(55.75, 37.62)
+	)
+	paths := pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("ch").
+			Geo(zurich, zurich, frankfurt, frankfurt),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:111").Fingerprint("ru").
+			Geo(zurich, moscow, moscow, frankfurt),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:114", "1-ff00:0:111").Fingerprint("unknown").
+			Geo(zurich, zurich),
+	)
+	for _, c := range []struct {
+		policy string
+		want   []pan.PathFingerprint
+	}{
+		{`{"geofence": {"deny": ["RU"]}}`, []pan.PathFingerprint{"ch", "unknown"}},
+		{`{"geofence": {"deny": ["ru"], "mode": "strict"}}`, []pan.PathFingerprint{"ch"}},
+		{`{"geofence": {"allow": ["CH", "DE"]}}`, []pan.PathFingerprint{"ch", "unknown"}},
+		{`{"geofence": {"allow": ["CH"]}}`, []pan.PathFingerprint{"unknown"}},
+		// around Zurich
+		{`{"geofence": {"deny": [[[47.3, 8.4], [47.5, 8.4], [47.5, 8.7], [47.3, 8.7]]]}}`, nil},
+		{`{"geofence": {"allow": [[[40, 0], [60, 0], [60, 40], [40, 40]]], "mode": "strict"}}`, []pan.PathFingerprint{"ch", "ru"}},
+		{`{"acl": ["- 1-ff00:0:112", "+"], "geofence": {"deny": ["RU"]}}`, []pan.PathFingerprint{"unknown"}},
+	} {
+		policy, err := selector.ParsePathPolicy(c.policy)
+		if err != nil {
+			t.Errorf("ParsePathPolicy(%s): %v", c.policy, err)
+			continue
+		}
+		got := policy.Filter(paths)
+		ok := len(got) == len(c.want)
+		for i := 0; ok && i < len(got); i++ {
+			ok = got[i].Fingerprint == c.want[i]
+		}
+		if !ok {
+			fps := make([]pan.PathFingerprint, len(got))
+			for i, p := range got {
+				fps[i] = p.Fingerprint
+			}
+			t.Errorf("%s: %v, want %v", c.policy, fps, c.want)
+		}
+	}
+
+	for _, policy := range []string{
+		`{"geofence": {"deny": ["XX"]}}`,
+		`{"geofence": {"deny": [[[47.3, 8.4], [47.5, 8.4]]]}}`,
+		`{"geofence": {"deny": ["RU"], "mode": "loose"}}`,
+	} {
+		if _, err := selector.ParsePathPolicy(policy); err == nil {
+			t.Errorf("ParsePathPolicy(%s) succeeded", policy)
+		}
+	}
+}
+
+func TestGeofenceBorders(t *testing.T) {
+	for _, c := range []struct {
+		city     string
+		lat, lon float32
+		country  string
+		in       bool
+	}{
+		{"Zurich", 47.37, 8.54, "CH", true},
+		{"Geneva", 46.20, 6.15, "CH", true},
+		{"Basel", 47.56, 7.59, "CH", true},
+		{"Lugano", 46.00, 8.95, "CH", true},
+		{"Mulhouse", 47.75, 7.34, "CH", false},
+		{"Konstanz", 47.678, 9.173, "CH", false},
+		{"Como", 45.81, 9.085, "CH", false},
+		{"New York", 40.71, -74.01, "US", true},
+		{"Seattle", 47.61, -122.33, "US", true},
+		{"Detroit", 42.33, -83.05, "US", true},
+		{"San Diego", 32.72, -117.16, "US", true},
+		{"Honolulu", 21.31, -157.86, "US", true},
+		{"Toronto", 43.65, -79.38, "US", false},
+		{"Vancouver", 49.28, -123.12, "US", false},
+		{"Montreal", 45.50, -73.57, "US", false},
+		{"Tijuana", 32.51, -117.04, "US", false},
+		{"Moscow", 55.75, 37.62, "RU", true},
+		{"Kaliningrad", 54.71, 20.51, "RU", true},
+		{"Vladivostok", 43.12, 131.89, "RU", true},
+		{"Kyiv", 50.45, 30.52, "RU", false},
+		{"Minsk", 53.90, 27.56, "RU", false},
+		{"Sapporo", 43.06, 141.35, "RU", false},
+		{"Harbin", 45.80, 126.53, "RU", false},
+	} {
+		var g selector.Geofence
+		if err := json.Unmarshal([]byte(`{"allow": ["`+c.country+`"]}`), &g); err != nil {
+			t.Fatal(err)
+		}
+		p := pantest.NewPath("1-ff00:0:110", "1-ff00:0:111").Geo(pantest.At(c.lat, c.lon)).Build()
+		if got := g.Complies(p); got != c.in {
+			t.Errorf("%s in %s: %t, want %t", c.city, c.country, got, c.in)
+		}
+	}
+}
+
+func TestGeofenceWithoutMetadata(t *testing.T) {
+	p := &pan.Path{Fingerprint: "none"}
+	lenient := selector.Geofence{Deny: []selector.Region{{Country: "RU"}}}
+	if !lenient.Complies(p) {
+		t.Error("lenient geofence excludes a path without metadata")
+	}
+	strict := selector.Geofence{Deny: []selector.Region{{Country: "RU"}}, Mode: selector.GeoStrict}
+	if strict.Complies(p) {
+		t.Error("strict geofence lets a path without metadata pass")
+	}
+
+	for policy, want := range map[string]int{
+		`{"geofence": {"deny": ["RU"]}}`:                   1,
+		`{"geofence": {"deny": ["RU"], "mode": "strict"}}`: 0,
+		`{"acl": ["+"], "geofence": {"deny": ["RU"]}}`:     0,
+	} {
+		pol, err := selector.ParsePathPolicy(policy)
+		if err != nil {
+			t.Fatalf("ParsePathPolicy(%s): %v", policy, err)
+		}
+		if got := len(pol.Filter([]*pan.Path{p})); got != want {
+			t.Errorf("ParsePathPolicy(%s) lets %d paths without metadata pass, want %d", policy, got, want)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector
+
+// Middleware wraps a selector with behaviour that does not depend on how the
+// selector picks its paths
+type Middleware func(Selector) Selector
+
+// Chain wraps s in mws. The first middleware is the outermost one, it sees
+// every call first.
+func Chain(s Selector, mws ...Middleware) Selector {
+	for i := len(mws) - 1; i >= 0; i-- {
+		s = mws[i](s)
+	}
+	return s
+}
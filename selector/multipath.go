@@ -0,0 +1,238 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+// WeightedPath is a member of the set of paths a connection sends on
+type WeightedPath struct {
+	Path *pan.Path
+	// Weight is the share of the packets the path gets with weighted
+	// round-robin
+	Weight float64
+	// Cap limits the rate MinRTT sends on the path, in Kbit/s. Zero means no
+	// limit.
+	Cap float64
+	// RTT replaces the RTT MinRTT derives from the metadata of the path, if
+	// non-zero
+	RTT time.Duration
+}
+
+// Scheduler spreads the packets of a connection across a set of paths
+type Scheduler interface {
+	// Update replaces the set of paths, keeping the state of the paths that
+	// remain in it
+	Update(set []WeightedPath) error
+	// Next returns the path for the next packet, nil for an empty set
+	Next() *pan.Path
+}
+
+const (
+	// SchedulerWeightedRoundRobin gives each path a share of the packets
+	// proportional to its weight
+	SchedulerWeightedRoundRobin = "WeightedRoundRobin"
+	// SchedulerMinRTT sends on the path with the lowest RTT, moving on to
+	// the next one once a path exceeds its cap
+	SchedulerMinRTT = "MinRTT"
+)
+
+var (
+	ErrUnknownScheduler = errors.New("unknown scheduler")
+	ErrInvalidWeight    = errors.New("weights and caps must not be negative")
+)
+
+// NewScheduler returns the scheduler called name, the empty string being
+// weighted round-robin. The clock c drives the caps of MinRTT, nil means the
+// wall clock.
+func NewScheduler(name string, c clock.Clock) (Scheduler, error) {
+	switch name {
+	case "", SchedulerWeightedRoundRobin:
+		return &WeightedRoundRobin{}, nil
+	case SchedulerMinRTT:
+		if c == nil {
+			c = clock.Real
+		}
+		return &MinRTT{clock: c}, nil
+	}
+	return nil, ErrUnknownScheduler
+}
+
+func validate(set []WeightedPath) error {
+	for _, wp := range set {
+		if !(wp.Weight >= 0) || !(wp.Cap >= 0) || math.IsInf(wp.Weight, 1) {
+			return ErrInvalidWeight
+		}
+	}
+	return nil
+}
+
+// WeightedRoundRobin interleaves the paths as evenly as their weights allow,
+// i.e. weights 2 and 1 give the sequence a b a a b a. Paths of weight zero
+// are only used if all weights are zero.
+type WeightedRoundRobin struct {
+	set []WeightedPath
+	// the credit of each member of the set
+	current []float64
+}
+
+func (s *WeightedRoundRobin) Update(set []WeightedPath) error {
+	if err := validate(set); err != nil {
+		return err
+	}
+	credit := map[pan.PathFingerprint]float64{}
+	for i, wp := range s.set {
+		credit[wp.Path.Fingerprint] = s.current[i]
+	}
+	s.set = set
+	s.current = make([]float64, len(set))
+	for i, wp := range set {
+		s.current[i] = credit[wp.Path.Fingerprint]
+	}
+	return nil
+}
+
+func (s *WeightedRoundRobin) Next() *pan.Path {
+	var total float64
+	for _, wp := range s.set {
+		total += wp.Weight
+	}
+	best := -1
+	for i, wp := range s.set {
+		w := wp.Weight
+		if total == 0 {
+			w = 1
+		}
+		s.current[i] += w
+		if best < 0 || s.current[i] > s.current[best] {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	if total == 0 {
+		total = float64(len(s.set))
+	}
+	s.current[best] -= total
+	return s.set[best].Path
+}
+
+// defaultPacketSize is what MinRTT counts against the cap of a path without
+// an MTU in its metadata
+const defaultPacketSize = 1400
+
+// capBurst is how long a path may send at its cap in one go
+const capBurst = 50 * time.Millisecond
+
+// MinRTT sends on the path with the lowest RTT that has not exhausted its cap.
+// Each packet is counted as a full MTU. Once all paths are at their cap, it
+// sends on the one closest to being allowed to.
+type MinRTT struct {
+	clock clock.Clock
+	set   []WeightedPath
+	// the bytes each member of the set may still send
+	tokens []float64
+	last   time.Time
+}
+
+func (s *MinRTT) Update(set []WeightedPath) error {
+	if err := validate(set); err != nil {
+		return err
+	}
+	s.refill()
+	tokens := map[pan.PathFingerprint]float64{}
+	for i, wp := range s.set {
+		tokens[wp.Path.Fingerprint] = s.tokens[i]
+	}
+	s.set = set
+	s.tokens = make([]float64, len(set))
+	for i, wp := range set {
+		t, ok := tokens[wp.Path.Fingerprint]
+		if !ok || t > burst(wp) {
+			t = burst(wp)
+		}
+		s.tokens[i] = t
+	}
+	return nil
+}
+
+func (s *MinRTT) Next() *pan.Path {
+	s.refill()
+	best, fullest := -1, -1
+	for i, wp := range s.set {
+		if wp.Cap == 0 || s.tokens[i] >= packetSize(wp.Path) {
+			if best < 0 || pathRTT(wp) < pathRTT(s.set[best]) {
+				best = i
+			}
+		}
+		if fullest < 0 || s.deficit(i) < s.deficit(fullest) {
+			fullest = i
+		}
+	}
+	if best < 0 {
+		best = fullest
+	}
+	if best < 0 {
+		return nil
+	}
+	if s.set[best].Cap > 0 {
+		s.tokens[best] -= packetSize(s.set[best].Path)
+	}
+	return s.set[best].Path
+}
+
+// refill credits the paths with what their caps allowed since the last time
+func (s *MinRTT) refill() {
+	now := s.clock.Now()
+	elapsed := now.Sub(s.last).Seconds()
+	s.last = now
+	for i, wp := range s.set {
+		s.tokens[i] = math.Min(s.tokens[i]+wp.Cap*1000/8*elapsed, burst(wp))
+	}
+}
+
+// deficit returns how long path i of the set has to wait for its next packet
+func (s *MinRTT) deficit(i int) float64 {
+	wp := s.set[i]
+	if wp.Cap == 0 {
+		return 0
+	}
+	return (packetSize(wp.Path) - s.tokens[i]) / (wp.Cap * 1000 / 8)
+}
+
+// burst returns the bytes wp may send at once
+func burst(wp WeightedPath) float64 {
+	return math.Max(wp.Cap*1000/8*capBurst.Seconds(), packetSize(wp.Path))
+}
+
+func packetSize(p *pan.Path) float64 {
+	if p.Metadata == nil || p.Metadata.MTU == 0 {
+		return defaultPacketSize
+	}
+	return float64(p.Metadata.MTU)
+}
+
+func pathRTT(wp WeightedPath) time.Duration {
+	if wp.RTT > 0 {
+		return wp.RTT
+	}
+	return metadataRTT(wp.Path)
+}
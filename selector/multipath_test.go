@@ -0,0 +1,97 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+// sequence returns the fingerprints of the next n paths of s
+func sequence(s selector.Scheduler, n int) string {
+	var fps []string
+	for i := 0; i < n; i++ {
+		fps = append(fps, string(s.Next().Fingerprint))
+	}
+	return strings.Join(fps, " ")
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	paths := profilePaths()
+	s, err := selector.NewScheduler("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := s.Next(); p != nil {
+		t.Errorf("Next() of an empty set = %v", p)
+	}
+	if err := s.Update([]selector.WeightedPath{{Path: paths[1], Weight: 2}, {Path: paths[2], Weight: 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if seq, want := sequence(s, 6), "fast wide fast fast wide fast"; seq != want {
+		t.Errorf("sequence %q, want %q", seq, want)
+	}
+	if err := s.Update([]selector.WeightedPath{{Path: paths[1]}, {Path: paths[2]}}); err != nil {
+		t.Fatal(err)
+	}
+	if seq, want := sequence(s, 4), "fast wide fast wide"; seq != want {
+		t.Errorf("sequence without weights %q, want %q", seq, want)
+	}
+	if err := s.Update([]selector.WeightedPath{{Path: paths[0], Weight: -1}}); err != selector.ErrInvalidWeight {
+		t.Errorf("Update(-1) = %v, want %v", err, selector.ErrInvalidWeight)
+	}
+}
+
+func TestMinRTT(t *testing.T) {
+	paths := pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:111").Fingerprint("near").
+			Latency(5*time.Millisecond).MTU(1000),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("far").
+			Latency(50*time.Millisecond, time.Millisecond, 50*time.Millisecond).MTU(1000),
+	)
+	c := clock.NewManual(pantest.Epoch)
+	s, err := selector.NewScheduler(selector.SchedulerMinRTT, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 1600 Kbit/s are 10 packets of 1000 bytes in the 50ms of burst
+	set := []selector.WeightedPath{{Path: paths[0], Cap: 1600}, {Path: paths[1]}}
+	if err := s.Update(set); err != nil {
+		t.Fatal(err)
+	}
+	if seq, want := sequence(s, 12), "near near near near near near near near near near far far"; seq != want {
+		t.Errorf("sequence %q, want %q", seq, want)
+	}
+	c.Advance(5 * time.Millisecond)
+	if seq, want := sequence(s, 2), "near far"; seq != want {
+		t.Errorf("sequence after 5ms %q, want %q", seq, want)
+	}
+
+	// measurements take precedence over the metadata
+	set[1].RTT = time.Millisecond
+	if err := s.Update(set); err != nil {
+		t.Fatal(err)
+	}
+	if seq, want := sequence(s, 2), "far far"; seq != want {
+		t.Errorf("sequence with RTT %q, want %q", seq, want)
+	}
+	if _, err := selector.NewScheduler("Random", nil); err != selector.ErrUnknownScheduler {
+		t.Errorf("NewScheduler(Random) = %v, want %v", err, selector.ErrUnknownScheduler)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// PathPolicyKey is the preference that restricts the paths of a connection
+// to those complying with a PathPolicy
+const PathPolicyKey = "PathPolicy"
+
+var ErrEmptyPolicy = errors.New("path policy has neither ACL, sequence nor geofence")
+
+// PathPolicy is a SCION path policy, given as JSON in the PathPolicy
+// preference, such as
+//
+//	{"acl": ["- 1-ff00:0:133", "+"], "sequence": "1-ff00:0:110 0* 1-ff00:0:111"}
+//
+// The ACL is an ordered list of allow (+) and deny (-) entries over ISD-AS#IF
+// patterns, of which the first matching one decides about a hop. It must end
+// with a default entry. The sequence is a space-separated list of hop
+// predicates. See https://scion.docs.anapaya.net/en/latest/PathPolicy.html
+// for both.
+//
+// The geofence restricts the locations of the hops, see Geofence:
+//
+//	{"geofence": {"allow": ["CH", "DE"], "deny": [[[47.3, 8.5], [47.4, 8.5], [47.4, 8.6]]], "mode": "strict"}}
+type PathPolicy struct {
+	ACL      []string  `json:"acl,omitempty"`
+	Sequence string    `json:"sequence,omitempty"`
+	Geofence *Geofence `json:"geofence,omitempty"`
+}
+
+// ParsePathPolicy returns the policy in s. Paths without metadata can not
+// comply with an ACL or sequence, a geofence on its own treats them according
+// to its mode.
+func ParsePathPolicy(s string) (pan.Policy, error) {
+	var pp PathPolicy
+	dec := json.NewDecoder(bytes.NewReader([]byte(s)))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&pp); err != nil {
+		return nil, err
+	}
+	if len(pp.ACL) == 0 && pp.Sequence == "" && pp.Geofence == nil {
+		return nil, ErrEmptyPolicy
+	}
+	var policy pan.PolicyChain
+	if len(pp.ACL) > 0 || pp.Sequence != "" {
+		policy = append(policy, pan.PolicyFunc(withMetadata))
+	}
+	if len(pp.ACL) > 0 {
+		acl, err := pan.NewACL(pp.ACL)
+		if err != nil {
+			return nil, err
+		}
+		policy = append(policy, acl)
+	}
+	if pp.Sequence != "" {
+		seq, err := pan.NewSequence(pp.Sequence)
+		if err != nil {
+			return nil, err
+		}
+		policy = append(policy, seq)
+	}
+	if pp.Geofence != nil {
+		if err := pp.Geofence.validate(); err != nil {
+			return nil, err
+		}
+		policy = append(policy, pp.Geofence)
+	}
+	return policy, nil
+}
+
+func withMetadata(paths []*pan.Path) []*pan.Path {
+	var ps []*pan.Path
+	for _, p := range paths {
+		if p.Metadata != nil {
+			ps = append(ps, p)
+		}
+	}
+	return ps
+}
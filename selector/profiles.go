@@ -0,0 +1,384 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+)
+
+// ProfileKey is the preference that sets the capacity profile of a
+// connection
+const ProfileKey = "ConnCapacityProfile"
+
+// Profile is what a connection wants from its path
+type Profile string
+
+const (
+	// ProfileDefault sticks to a path until it goes down
+	ProfileDefault Profile = "Default"
+	// ProfileCapacitySeeking prefers the path with the highest capacity
+	ProfileCapacitySeeking Profile = "CapacitySeeking"
+	// ProfileScavenger prefers the path used by the fewest other
+	// connections, so as to stay out of their way
+	ProfileScavenger Profile = "Scavenger"
+	// ProfileLowLatency prefers the path with the lowest round-trip time
+	ProfileLowLatency Profile = "LowLatency"
+)
+
+var ErrUnknownProfile = errors.New("unknown capacity profile")
+
+// ParseProfile returns the profile named s. The empty string is the default
+// profile, LowLatencyInteractive and LowLatencyNonInteractive are taken as
+// LowLatency.
+func ParseProfile(s string) (Profile, error) {
+	switch s {
+	case "", string(ProfileDefault):
+		return ProfileDefault, nil
+	case string(ProfileCapacitySeeking), string(ProfileScavenger), string(ProfileLowLatency):
+		return Profile(s), nil
+	case "LowLatencyInteractive", "LowLatencyNonInteractive":
+		return ProfileLowLatency, nil
+	}
+	return "", ErrUnknownProfile
+}
+
+// Usage counts the connections currently sending on each path. Selectors
+// sharing it can take each other into account.
+type Usage struct {
+	mu    sync.Mutex
+	conns map[pan.PathFingerprint]int
+	// version changes with every move
+	version uint64
+}
+
+func NewUsage() *Usage {
+	return &Usage{conns: map[pan.PathFingerprint]int{}}
+}
+
+// Connections returns the number of connections on the path
+func (u *Usage) Connections(fp pan.PathFingerprint) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.conns[fp]
+}
+
+func (u *Usage) move(from, to *pan.Path) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if from != nil {
+		u.conns[from.Fingerprint]--
+		if u.conns[from.Fingerprint] <= 0 {
+			delete(u.conns, from.Fingerprint)
+		}
+	}
+	if to != nil {
+		u.conns[to.Fingerprint]++
+	}
+	u.version++
+}
+
+func (u *Usage) changed(since uint64) (uint64, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.version, u.version != since
+}
+
+// pathStats is what the tracer reported while a path was in use
+type pathStats struct {
+	rtt time.Duration
+	// rate is the congestion window over the RTT, in Kbit/s
+	rate float64
+}
+
+// ProfileSelector selects paths according to the capacity profile set with
+// the ProfileKey preference. It ranks paths by their metadata and, once it
+// has any, by the feedback passed to UpdatedMetrics for the paths it used.
+type ProfileSelector struct {
+	mu      sync.Mutex
+	usage   *Usage
+	profile Profile
+	paths   []*pan.Path
+	down    map[pan.PathFingerprint]bool
+	stats   map[pan.PathFingerprint]*pathStats
+	current *pan.Path
+	// whether the current path has to be chosen again
+	stale bool
+	// the version of usage the current path was chosen at
+	seen uint64
+}
+
+// NewProfileSelector returns a selector with the default profile. Selectors
+// of a process should share usage, nil gives the selector its own.
+func NewProfileSelector(usage *Usage) *ProfileSelector {
+	if usage == nil {
+		usage = NewUsage()
+	}
+	return &ProfileSelector{
+		usage:   usage,
+		profile: ProfileDefault,
+		down:    map[pan.PathFingerprint]bool{},
+		stats:   map[pan.PathFingerprint]*pathStats{},
+	}
+}
+
+// Profile returns the current profile
+func (s *ProfileSelector) Profile() Profile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.profile
+}
+
+// SetPreferences sets the profile, if prefs has one
+func (s *ProfileSelector) SetPreferences(prefs map[string]string) error {
+	name, ok := prefs[ProfileKey]
+	if !ok {
+		return nil
+	}
+	p, err := ParseProfile(name)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p != s.profile {
+		s.profile = p
+		s.stale = true
+	}
+	return nil
+}
+
+func (s *ProfileSelector) Initialize(local, remote pan.UDPAddr, paths []*pan.Path) {
+	s.Refresh(paths)
+}
+
+// Refresh replaces the paths. Paths reported down before are considered up
+// again, feedback is kept for the paths that remain.
+func (s *ProfileSelector) Refresh(paths []*pan.Path) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = paths
+	s.down = map[pan.PathFingerprint]bool{}
+	stats := map[pan.PathFingerprint]*pathStats{}
+	for _, p := range paths {
+		if st, ok := s.stats[p.Fingerprint]; ok {
+			stats[p.Fingerprint] = st
+		}
+	}
+	s.stats = stats
+	s.stale = true
+}
+
+// PathDown marks the path with fingerprint fp, as well as all paths through
+// pi, as down
+func (s *ProfileSelector) PathDown(fp pan.PathFingerprint, pi pan.PathInterface) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.paths {
+		if p.Fingerprint == fp || throughInterface(p, pi) {
+			s.down[p.Fingerprint] = true
+			s.stale = true
+		}
+	}
+}
+
+func (s *ProfileSelector) Path() *pan.Path {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.profile == ProfileScavenger {
+		// other connections moved
+		var changed bool
+		s.seen, changed = s.usage.changed(s.seen)
+		s.stale = s.stale || changed
+	}
+	if s.stale {
+		s.choose()
+	}
+	return s.current
+}
+
+// UpdatedMetrics attributes the RTT and congestion window reported by the
+// tracer to the current path
+func (s *ProfileSelector) UpdatedMetrics(rtt time.Duration, cwnd uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.current == nil || rtt <= 0 {
+		return
+	}
+	s.stats[s.current.Fingerprint] = &pathStats{
+		rtt:  rtt,
+		rate: float64(cwnd) * 8 / 1000 / rtt.Seconds(),
+	}
+	if s.profile == ProfileLowLatency || s.profile == ProfileCapacitySeeking {
+		s.stale = true
+	}
+}
+
+func (s *ProfileSelector) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.usage.move(s.current, nil)
+	s.current = nil
+	return nil
+}
+
+// choose picks the best path for the profile, preferring the current one
+// among equals. The caller must hold the lock.
+func (s *ProfileSelector) choose() {
+	s.stale = false
+	var candidates []*pan.Path
+	for _, p := range s.paths {
+		if !s.down[p.Fingerprint] {
+			candidates = append(candidates, p)
+		}
+	}
+	if len(candidates) == 0 {
+		// down notifications may be stale, anything beats no path
+		candidates = s.paths
+	}
+
+	var best *pan.Path
+	if s.profile == ProfileDefault {
+		best = s.same(candidates)
+		if best == nil && len(candidates) > 0 {
+			best = candidates[0]
+		}
+	} else {
+		for _, p := range candidates {
+			if best == nil || s.better(p, best) {
+				best = p
+			}
+		}
+		if cur := s.same(candidates); cur != nil && !s.better(best, cur) {
+			best = cur
+		}
+	}
+	if s.current == nil || best == nil || best.Fingerprint != s.current.Fingerprint {
+		s.usage.move(s.current, best)
+	}
+	s.current = best
+}
+
+// same returns the current path among paths
+func (s *ProfileSelector) same(paths []*pan.Path) *pan.Path {
+	if s.current == nil {
+		return nil
+	}
+	for _, p := range paths {
+		if p.Fingerprint == s.current.Fingerprint {
+			return p
+		}
+	}
+	return nil
+}
+
+// better tells whether a is strictly better than b for the profile. Equal
+// paths are told apart by their number of hops.
+func (s *ProfileSelector) better(a, b *pan.Path) bool {
+	switch s.profile {
+	case ProfileLowLatency:
+		if ra, rb := s.rtt(a), s.rtt(b); ra != rb {
+			return ra < rb
+		}
+	case ProfileCapacitySeeking:
+		if ra, rb := s.rate(a), s.rate(b); ra != rb {
+			return ra > rb
+		}
+	case ProfileScavenger:
+		if ua, ub := s.others(a), s.others(b); ua != ub {
+			return ua < ub
+		}
+		// leave the better paths to others
+		if ra, rb := s.rate(a), s.rate(b); ra != rb {
+			return ra < rb
+		}
+	}
+	return hops(a) < hops(b)
+}
+
+// unknownRTT ranks paths without any latency information last
+const unknownRTT = time.Hour
+
+// rtt returns the measured RTT of p, or twice the latency announced in its
+// metadata
+func (s *ProfileSelector) rtt(p *pan.Path) time.Duration {
+	if st, ok := s.stats[p.Fingerprint]; ok {
+		return st.rtt
+	}
+	return metadataRTT(p)
+}
+
+// metadataRTT returns twice the latency announced in the metadata of p
+func metadataRTT(p *pan.Path) time.Duration {
+	if p.Metadata == nil || len(p.Metadata.Latency) == 0 {
+		return unknownRTT
+	}
+	var sum time.Duration
+	for _, l := range p.Metadata.Latency {
+		if l <= 0 {
+			return unknownRTT
+		}
+		sum += l
+	}
+	return 2 * sum
+}
+
+// rate returns the measured rate of p, or the bottleneck bandwidth announced
+// in its metadata, in Kbit/s. Zero means unknown.
+func (s *ProfileSelector) rate(p *pan.Path) float64 {
+	if st, ok := s.stats[p.Fingerprint]; ok {
+		return st.rate
+	}
+	if p.Metadata == nil {
+		return 0
+	}
+	var min uint64
+	for _, b := range p.Metadata.Bandwidth {
+		if b > 0 && (min == 0 || b < min) {
+			min = b
+		}
+	}
+	return float64(min)
+}
+
+// others returns the number of other connections on p
+func (s *ProfileSelector) others(p *pan.Path) int {
+	n := s.usage.Connections(p.Fingerprint)
+	if s.current != nil && s.current.Fingerprint == p.Fingerprint {
+		n--
+	}
+	return n
+}
+
+func hops(p *pan.Path) int {
+	if p.Metadata == nil {
+		return 0
+	}
+	return len(p.Metadata.Interfaces)
+}
+
+func throughInterface(p *pan.Path, pi pan.PathInterface) bool {
+	if p.Metadata == nil || pi == (pan.PathInterface{}) {
+		return false
+	}
+	for _, i := range p.Metadata.Interfaces {
+		if i == pi {
+			return true
+		}
+	}
+	return false
+}
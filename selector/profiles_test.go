@@ -0,0 +1,113 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/pantest"
+	"github.com/netsys-lab/pan-lua/selector"
+)
+
+// three paths: slow is short but narrow, fast has the lowest latency, wide
+// the highest bandwidth
+func profilePaths() []*pan.Path {
+	return pantest.Paths(
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:111").Fingerprint("slow").
+			Latency(50*time.Millisecond).Bandwidth(1000),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:112", "1-ff00:0:111").Fingerprint("fast").
+			Latency(5*time.Millisecond, time.Millisecond, 5*time.Millisecond).Bandwidth(10000, 10000, 10000),
+		pantest.NewPath("1-ff00:0:110", "1-ff00:0:113", "1-ff00:0:111").Fingerprint("wide").
+			Latency(20*time.Millisecond, time.Millisecond, 20*time.Millisecond).Bandwidth(100000, 100000, 100000),
+	)
+}
+
+func expect(t *testing.T, s *selector.ProfileSelector, fp pan.PathFingerprint) {
+	t.Helper()
+	if p := s.Path(); p == nil || p.Fingerprint != fp {
+		t.Errorf("%s: Path() = %v, want %s", s.Profile(), p, fp)
+	}
+}
+
+func TestProfileSelector(t *testing.T) {
+	local, remote := pantest.Addr("1-ff00:0:110,127.0.0.1:1"), pantest.Addr("1-ff00:0:111,127.0.0.2:2")
+	s := selector.NewProfileSelector(nil)
+	s.Initialize(local, remote, profilePaths())
+	expect(t, s, "slow")
+
+	for _, c := range []struct {
+		profile string
+		want    pan.PathFingerprint
+	}{
+		{"LowLatency", "fast"},
+		{"CapacitySeeking", "wide"},
+		{"LowLatencyInteractive", "fast"},
+	} {
+		if err := s.SetPreferences(map[string]string{selector.ProfileKey: c.profile}); err != nil {
+			t.Fatal(err)
+		}
+		expect(t, s, c.want)
+	}
+	if err := s.SetPreferences(map[string]string{selector.ProfileKey: "Fastest"}); err != selector.ErrUnknownProfile {
+		t.Errorf("SetPreferences(Fastest) = %v, want %v", err, selector.ErrUnknownProfile)
+	}
+
+	// feedback overrides the metadata
+	s.UpdatedMetrics(100*time.Millisecond, 12500)
+	expect(t, s, "wide")
+	s.PathDown("", profilePaths()[2].Metadata.Interfaces[2])
+	expect(t, s, "slow")
+	s.Refresh(profilePaths())
+	expect(t, s, "wide")
+}
+
+func TestScavenger(t *testing.T) {
+	local, remote := pantest.Addr("1-ff00:0:110,127.0.0.1:1"), pantest.Addr("1-ff00:0:111,127.0.0.2:2")
+	usage := selector.NewUsage()
+	seeker := selector.NewProfileSelector(usage)
+	seeker.Initialize(local, remote, profilePaths())
+	if err := seeker.SetPreferences(map[string]string{selector.ProfileKey: "CapacitySeeking"}); err != nil {
+		t.Fatal(err)
+	}
+	expect(t, seeker, "wide")
+
+	scavenger := selector.NewProfileSelector(usage)
+	scavenger.Initialize(local, remote, profilePaths())
+	if err := scavenger.SetPreferences(map[string]string{selector.ProfileKey: "Scavenger"}); err != nil {
+		t.Fatal(err)
+	}
+	// the narrowest of the unused paths
+	expect(t, scavenger, "slow")
+	if n := usage.Connections("slow"); n != 1 {
+		t.Errorf("Connections(slow) = %d, want 1", n)
+	}
+
+	seeker.PathDown("wide", pan.PathInterface{})
+	expect(t, seeker, "fast")
+	expect(t, scavenger, "slow")
+	if err := seeker.SetPreferences(map[string]string{selector.ProfileKey: "Default"}); err != nil {
+		t.Fatal(err)
+	}
+	seeker.Refresh(profilePaths()[:1])
+	expect(t, seeker, "slow")
+	// the scavenger makes way
+	expect(t, scavenger, "fast")
+	seeker.Close()
+	scavenger.Close()
+	if n := usage.Connections("fast"); n != 0 {
+		t.Errorf("Connections(fast) after Close = %d, want 0", n)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package selector
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+)
+
+// Tracer returns a QUIC tracer that feeds the metrics of the connection
+// using s back to it, for use in the quic.Config of that connection when
+// selecting paths in-process
+func (s *ProfileSelector) Tracer() logging.Tracer {
+	return profileTracer{s}
+}
+
+type profileTracer struct {
+	s *ProfileSelector
+}
+
+func (t profileTracer) TracerForConnection(context.Context, logging.Perspective, logging.ConnectionID) logging.ConnectionTracer {
+	return profileConnectionTracer(t)
+}
+func (profileTracer) SentPacket(net.Addr, *logging.Header, logging.ByteCount, []logging.Frame) {}
+func (profileTracer) DroppedPacket(net.Addr, logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
+
+type profileConnectionTracer struct {
+	s *ProfileSelector
+}
+
+func (t profileConnectionTracer) UpdatedMetrics(rtt *logging.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) {
+	if rtt != nil {
+		t.s.UpdatedMetrics(rtt.SmoothedRTT(), uint64(cwnd))
+	}
+}
+
+func (profileConnectionTracer) StartedConnection(local, remote net.Addr, srcConnID, destConnID logging.ConnectionID) {
+}
+func (profileConnectionTracer) NegotiatedVersion(chosen logging.VersionNumber, clientVersions, serverVersions []logging.VersionNumber) {
+}
+func (profileConnectionTracer) ClosedConnection(error)                                   {}
+func (profileConnectionTracer) SentTransportParameters(*logging.TransportParameters)     {}
+func (profileConnectionTracer) ReceivedTransportParameters(*logging.TransportParameters) {}
+func (profileConnectionTracer) RestoredTransportParameters(*logging.TransportParameters) {}
+func (profileConnectionTracer) SentPacket(*logging.ExtendedHeader, logging.ByteCount, *logging.AckFrame, []logging.Frame) {
+}
+func (profileConnectionTracer) ReceivedVersionNegotiationPacket(*logging.Header, []logging.VersionNumber) {
+}
+func (profileConnectionTracer) ReceivedRetry(*logging.Header) {}
+func (profileConnectionTracer) ReceivedPacket(*logging.ExtendedHeader, logging.ByteCount, []logging.Frame) {
+}
+func (profileConnectionTracer) BufferedPacket(logging.PacketType) {}
+func (profileConnectionTracer) DroppedPacket(logging.PacketType, logging.ByteCount, logging.PacketDropReason) {
+}
+func (profileConnectionTracer) AcknowledgedPacket(logging.EncryptionLevel, logging.PacketNumber) {}
+func (profileConnectionTracer) LostPacket(logging.EncryptionLevel, logging.PacketNumber, logging.PacketLossReason) {
+}
+func (profileConnectionTracer) UpdatedCongestionState(logging.CongestionState)                     {}
+func (profileConnectionTracer) UpdatedPTOCount(uint32)                                             {}
+func (profileConnectionTracer) UpdatedKeyFromTLS(logging.EncryptionLevel, logging.Perspective)     {}
+func (profileConnectionTracer) UpdatedKey(logging.KeyPhase, bool)                                  {}
+func (profileConnectionTracer) DroppedEncryptionLevel(logging.EncryptionLevel)                     {}
+func (profileConnectionTracer) DroppedKey(logging.KeyPhase)                                        {}
+func (profileConnectionTracer) SetLossTimer(logging.TimerType, logging.EncryptionLevel, time.Time) {}
+func (profileConnectionTracer) LossTimerExpired(logging.TimerType, logging.EncryptionLevel)        {}
+func (profileConnectionTracer) LossTimerCanceled()                                                 {}
+func (profileConnectionTracer) Close()                                                             {}
+func (profileConnectionTracer) Debug(name, msg string)                                             {}
@@ -0,0 +1,39 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sim
+
+import (
+	"path/filepath"
+
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/lua"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// LuaStrategy runs the path-selection script in file, with a fresh Lua state
+// for every run
+func LuaStrategy(file string) Strategy {
+	return Strategy{
+		Name: filepath.Base(file),
+		New: func(c clock.Clock) (rpc.ServerSelector, rpc.ServerConnectionTracer, error) {
+			state := lua.NewState()
+			sel := lua.NewSelector(state, c)
+			stats := lua.NewStats(state, c)
+			if err := state.LoadScript(file); err != nil {
+				return nil, nil, err
+			}
+			return sel, stats, nil
+		},
+	}
+}
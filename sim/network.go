@@ -0,0 +1,318 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sim evaluates path-selection strategies offline, against a
+// synthetic network whose links change over time
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/scionproto/scion/go/lib/snet"
+)
+
+// LinkState is the condition of a link at some point in time
+type LinkState struct {
+	Delay time.Duration
+	// Capacity in Kbit/s
+	Capacity uint64
+	// Loss is the probability of a packet getting lost, between 0 and 1
+	Loss float64
+	Down bool
+}
+
+// Change sets the state of a link from At, relative to the start of the
+// simulation, onwards
+type Change struct {
+	At    time.Duration
+	Link  int
+	State LinkState
+}
+
+// Link connects two consecutive interfaces of a path, either between two
+// ASes or through one
+type Link struct {
+	A, B pan.PathInterface
+	// Base is the announced state of the link
+	Base LinkState
+	// Jitter is the maximum random deviation added to the delay
+	Jitter time.Duration
+}
+
+// Path is a path of the network along with the links it traverses
+type Path struct {
+	*pan.Path
+	Links []int
+}
+
+// Network is a set of paths between two hosts. All randomness is fixed by
+// the seed, so that every strategy sees the same conditions.
+type Network struct {
+	Local, Remote pan.UDPAddr
+	Links         []*Link
+	Paths         []*Path
+	// Changes must be sorted by time
+	Changes []Change
+	Seed    int64
+}
+
+// Config describes the network built by Generate
+type Config struct {
+	Paths int
+	// MaxTransit is the maximum number of transit ASes per path
+	MaxTransit int
+	// Failures and Congestions are the number of link failures and
+	// congestion episodes spread over Duration. Episodes on the same link
+	// do not overlap; one that finds no free link is left out.
+	Failures, Congestions int
+	Duration              time.Duration
+	Seed                  int64
+}
+
+// DefaultConfig is a small network with a few disturbances over ten minutes
+var DefaultConfig = Config{
+	Paths:       4,
+	MaxTransit:  3,
+	Failures:    2,
+	Congestions: 4,
+	Duration:    10 * time.Minute,
+	Seed:        1,
+}
+
+// the speed of light in fibre, in km per millisecond
+const fibreSpeed = 200
+
+type as struct {
+	ia  pan.IA
+	geo pan.GeoCoordinates
+}
+
+// Generate builds a random network from cfg. Paths share ASes and links,
+// their metadata is derived from the links, with delays following the
+// distance between the ASes.
+func Generate(cfg Config) *Network {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+	if cfg.Paths <= 0 {
+		cfg.Paths = 1
+	}
+	if cfg.MaxTransit <= 0 {
+		cfg.MaxTransit = 1
+	}
+
+	newAS := func(ia string) *as {
+		return &as{
+			ia: pan.MustParseIA(ia),
+			geo: pan.GeoCoordinates{
+				Latitude:  float32(rng.Float64()*120 - 60),
+				Longitude: float32(rng.Float64()*360 - 180),
+			},
+		}
+	}
+	src, dst := newAS("1-ff00:0:110"), newAS("2-ff00:0:210")
+	transit := make([]*as, cfg.Paths+cfg.MaxTransit)
+	for i := range transit {
+		transit[i] = newAS(fmt.Sprintf("%d-ff00:0:%x", 1+i%2, 0x120+i))
+	}
+
+	n := &Network{
+		Local:  pan.UDPAddr{IA: src.ia, Port: 1},
+		Remote: pan.UDPAddr{IA: dst.ia, Port: 1},
+		Seed:   cfg.Seed,
+	}
+	// links between ASes are shared by all paths crossing both
+	type interLink struct {
+		a, b *as
+	}
+	inter := map[interLink]int{}
+	// interface IDs are unique in the whole network, so that the IfID
+	// sequences making up fingerprints tell all paths apart
+	var nextIf pan.IfID
+	interIfs := map[int][2]pan.PathInterface{}
+	addLink := func(a, b pan.PathInterface, delay time.Duration, capacity uint64) int {
+		n.Links = append(n.Links, &Link{
+			A: a,
+			B: b,
+			Base: LinkState{
+				Delay:    delay,
+				Capacity: capacity,
+				Loss:     rng.Float64() * 0.001,
+			},
+			Jitter: delay / 20,
+		})
+		return len(n.Links) - 1
+	}
+	link := func(a, b *as) int {
+		if i, ok := inter[interLink{a, b}]; ok {
+			return i
+		}
+		ia := pan.PathInterface{IA: a.ia, IfID: nextIf + 1}
+		ib := pan.PathInterface{IA: b.ia, IfID: nextIf + 2}
+		nextIf += 2
+		delay := time.Millisecond + time.Duration(distance(a.geo, b.geo)/fibreSpeed*float64(time.Millisecond))
+		capacities := []uint64{1e6, 1e7, 4e7, 1e8}
+		i := addLink(ia, ib, delay, capacities[rng.Intn(len(capacities))])
+		inter[interLink{a, b}] = i
+		interIfs[i] = [2]pan.PathInterface{ia, ib}
+		return i
+	}
+
+	seen := map[pan.PathFingerprint]bool{}
+	for tries := 0; len(n.Paths) < cfg.Paths && tries < 100*cfg.Paths; tries++ {
+		hops := []*as{src}
+		for _, i := range rng.Perm(len(transit))[:1+rng.Intn(cfg.MaxTransit)] {
+			hops = append(hops, transit[i])
+		}
+		hops = append(hops, dst)
+
+		var links []int
+		var ifs []pan.PathInterface
+		for i := 0; i < len(hops)-1; i++ {
+			l := link(hops[i], hops[i+1])
+			if len(ifs) > 0 {
+				// crossing the AS
+				links = append(links, addLink(ifs[len(ifs)-1], interIfs[l][0],
+					time.Duration(200+rng.Intn(1800))*time.Microsecond, 1e8))
+			}
+			links = append(links, l)
+			ifs = append(ifs, interIfs[l][0], interIfs[l][1])
+		}
+		fp := fingerprint(ifs)
+		if seen[fp] {
+			continue
+		}
+		seen[fp] = true
+		n.Paths = append(n.Paths, &Path{
+			Path: &pan.Path{
+				Source:      src.ia,
+				Destination: dst.ia,
+				Metadata:    n.metadata(ifs, links, hops),
+				Fingerprint: fp,
+			},
+			Links: links,
+		})
+	}
+
+	n.Changes = n.disturb(rng, cfg)
+	return n
+}
+
+// metadata announces the base state of the links of a path
+func (n *Network) metadata(ifs []pan.PathInterface, links []int, hops []*as) *pan.PathMetadata {
+	md := &pan.PathMetadata{
+		Interfaces: ifs,
+		MTU:        1472,
+	}
+	for _, l := range links {
+		md.Latency = append(md.Latency, n.Links[l].Base.Delay)
+		md.Bandwidth = append(md.Bandwidth, n.Links[l].Base.Capacity)
+	}
+	for i := range ifs {
+		md.Geo = append(md.Geo, hops[(i+1)/2].geo)
+	}
+	for i := 0; i < len(ifs)/2; i++ {
+		md.LinkType = append(md.LinkType, snet.LinkTypeDirect)
+	}
+	for i := 1; i < len(hops)-1; i++ {
+		md.InternalHops = append(md.InternalHops, 1)
+	}
+	return md
+}
+
+// disturb schedules link failures, each followed by a recovery, and
+// congestion episodes with increased delay and loss at reduced capacity
+func (n *Network) disturb(rng *rand.Rand, cfg Config) []Change {
+	var changes []Change
+	if cfg.Duration <= 0 || len(n.Links) == 0 {
+		return nil
+	}
+	// episodes on the same link never overlap, as the end of one would
+	// restore the base state in the middle of the other
+	type span struct{ from, to time.Duration }
+	busy := map[int][]span{}
+	free := func(link int, sp span) bool {
+		for _, b := range busy[link] {
+			if sp.from <= b.to && b.from <= sp.to {
+				return false
+			}
+		}
+		return true
+	}
+	// episode places an episode in state on a random link that is free at
+	// a random time, giving up after a few attempts
+	episode := func(state func(LinkState) LinkState) {
+		for try := 0; try < 16; try++ {
+			l := rng.Intn(len(n.Links))
+			at := time.Duration(rng.Int63n(int64(cfg.Duration)))
+			sp := span{at, at + time.Duration(rng.Int63n(int64(cfg.Duration/10)+1))}
+			s := state(n.Links[l].Base)
+			if !free(l, sp) {
+				continue
+			}
+			busy[l] = append(busy[l], sp)
+			changes = append(changes,
+				Change{At: sp.from, Link: l, State: s},
+				Change{At: sp.to, Link: l, State: n.Links[l].Base},
+			)
+			return
+		}
+	}
+	for i := 0; i < cfg.Failures; i++ {
+		episode(func(s LinkState) LinkState {
+			s.Down = true
+			return s
+		})
+	}
+	for i := 0; i < cfg.Congestions; i++ {
+		episode(func(s LinkState) LinkState {
+			s.Delay *= time.Duration(2 + rng.Intn(4))
+			s.Capacity /= uint64(2 + rng.Intn(8))
+			s.Loss += 0.01 + rng.Float64()*0.05
+			return s
+		})
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].At < changes[j].At
+	})
+	return changes
+}
+
+// fingerprint returns the fingerprint pan gives a path with the interfaces
+// ifs, the sequence of their IfIDs
+func fingerprint(ifs []pan.PathInterface) pan.PathFingerprint {
+	ids := make([]string, len(ifs))
+	for i, intf := range ifs {
+		ids[i] = strconv.FormatUint(uint64(intf.IfID), 10)
+	}
+	return pan.PathFingerprint(strings.Join(ids, " "))
+}
+
+// distance returns the great-circle distance between a and b in km
+func distance(a, b pan.GeoCoordinates) float64 {
+	const r = 6371
+	rad := func(deg float32) float64 {
+		return float64(deg) * math.Pi / 180
+	}
+	dlat := rad(b.Latitude - a.Latitude)
+	dlon := rad(b.Longitude - a.Longitude)
+	h := math.Sin(dlat/2)*math.Sin(dlat/2) +
+		math.Cos(rad(a.Latitude))*math.Cos(rad(b.Latitude))*math.Sin(dlon/2)*math.Sin(dlon/2)
+	return 2 * r * math.Asin(math.Sqrt(h))
+}
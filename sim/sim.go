@@ -0,0 +1,366 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sim
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// Epoch is the virtual time at which every simulation starts
+var Epoch = time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+
+var (
+	ErrNoSelector = errors.New("strategy without selector")
+	// ErrFinished is reported to the tracer as reason for closing the
+	// connection at the end of a run
+	ErrFinished = errors.New("simulation finished")
+)
+
+// Strategy builds a fresh selector, and optionally a connection tracer, for
+// each simulation run. Both have to use the given clock as time source.
+type Strategy struct {
+	Name string
+	New  func(c clock.Clock) (rpc.ServerSelector, rpc.ServerConnectionTracer, error)
+}
+
+// Options control a simulation run
+type Options struct {
+	Duration time.Duration
+	// Step is the interval at which the selector is asked for a path and
+	// metrics are reported to the tracer
+	Step time.Duration
+	// Demand is the rate the application tries to send at, in Kbit/s
+	Demand     uint64
+	PacketSize int
+}
+
+// DefaultOptions sends 10 Mbit/s for ten minutes
+var DefaultOptions = Options{
+	Duration:   10 * time.Minute,
+	Step:       100 * time.Millisecond,
+	Demand:     1e4,
+	PacketSize: 1200,
+}
+
+// Report summarises what a strategy achieved
+type Report struct {
+	Strategy string
+	Duration time.Duration
+	// MeanLatency and P95Latency are one-way delays over the steps a usable
+	// path was selected
+	MeanLatency, P95Latency time.Duration
+	// Goodput is the mean rate of delivered data, in Kbit/s
+	Goodput float64
+	// Switches counts how often the selected path changed
+	Switches int
+	// Lost counts packets lost to loss and to unusable paths
+	Lost int
+	// Outage is the time during which no usable path was selected
+	Outage time.Duration
+}
+
+func (r *Report) String() string {
+	return fmt.Sprintf("%-20s latency %8s (p95 %8s)  goodput %10.1f Kbit/s  switches %4d  lost %7d  outage %s",
+		r.Strategy, r.MeanLatency.Round(time.Microsecond), r.P95Latency.Round(time.Microsecond),
+		r.Goodput, r.Switches, r.Lost, r.Outage)
+}
+
+// Compare runs every strategy against the same network
+func Compare(n *Network, opts Options, strategies ...Strategy) ([]*Report, error) {
+	var reports []*Report
+	for _, s := range strategies {
+		r, err := Run(n, opts, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.Name, err)
+		}
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
+
+type run struct {
+	n       *Network
+	opts    Options
+	clock   *clock.Manual
+	sel     rpc.ServerSelector
+	tracer  rpc.ServerConnectionTracer
+	rng     *rand.Rand
+	links   []LinkState
+	jitter  []time.Duration
+	changes []Change
+	// the paths reported down
+	down map[pan.PathFingerprint]bool
+	rtt  *rpc.RTTStats
+	pn   logging.PacketNumber
+}
+
+// Run simulates a single connection over n that follows the decisions of s
+func Run(n *Network, opts Options, s Strategy) (*Report, error) {
+	if s.New == nil {
+		return nil, ErrNoSelector
+	}
+	if opts.Step <= 0 {
+		opts.Step = DefaultOptions.Step
+	}
+	if opts.Demand == 0 {
+		opts.Demand = DefaultOptions.Demand
+	}
+	if opts.PacketSize <= 0 {
+		opts.PacketSize = DefaultOptions.PacketSize
+	}
+	c := clock.NewManual(Epoch)
+	sel, tracer, err := s.New(c)
+	if err != nil {
+		return nil, err
+	}
+	if sel == nil {
+		return nil, ErrNoSelector
+	}
+	r := &run{
+		n:       n,
+		opts:    opts,
+		clock:   c,
+		sel:     sel,
+		tracer:  tracer,
+		rng:     rand.New(rand.NewSource(n.Seed)),
+		changes: n.Changes,
+		down:    map[pan.PathFingerprint]bool{},
+	}
+	for _, l := range n.Links {
+		r.links = append(r.links, l.Base)
+	}
+	r.jitter = make([]time.Duration, len(n.Links))
+	return r.run(s.Name)
+}
+
+func (r *run) run(name string) (*Report, error) {
+	local, remote := r.n.Local, r.n.Remote
+	if r.tracer != nil {
+		if err := r.tracer.StartedConnection(&local, &remote, nil, nil); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.sel.Initialize(nil, local, remote, r.available()); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Strategy: name, Duration: r.opts.Duration}
+	var latencies []time.Duration
+	var delivered float64
+	var last pan.PathFingerprint
+	for t := time.Duration(0); t < r.opts.Duration; t += r.opts.Step {
+		r.clock.Set(Epoch.Add(t))
+		if err := r.update(t); err != nil {
+			return nil, err
+		}
+		// draw the same random numbers whatever path was selected
+		for i, l := range r.n.Links {
+			r.jitter[i] = 0
+			if l.Jitter > 0 {
+				r.jitter[i] = time.Duration(r.rng.Int63n(int64(l.Jitter)))
+			}
+		}
+		round := r.rng.Float64()
+
+		p, err := r.sel.Path(local, remote)
+		if err != nil {
+			return nil, err
+		}
+		sent := int(float64(r.opts.Demand) * 1000 / 8 * r.opts.Step.Seconds() / float64(r.opts.PacketSize))
+		path := r.path(p)
+		if path == nil {
+			report.Outage += r.opts.Step
+			report.Lost += sent
+			continue
+		}
+		if last != "" && path.Fingerprint != last {
+			report.Switches++
+			r.rtt = nil
+		}
+		last = path.Fingerprint
+
+		delay, capacity, loss := r.conditions(path)
+		latencies = append(latencies, delay)
+		rate := float64(r.opts.Demand)
+		if float64(capacity) < rate {
+			rate = float64(capacity)
+		}
+		delivered += rate * (1 - loss) * r.opts.Step.Seconds()
+		lost := int(float64(sent)*(1-rate/float64(r.opts.Demand)) + float64(sent)*rate/float64(r.opts.Demand)*loss + round)
+		report.Lost += lost
+		if err := r.report(2*delay, rate, lost); err != nil {
+			return nil, err
+		}
+	}
+	r.clock.Set(Epoch.Add(r.opts.Duration))
+	if r.tracer != nil {
+		if err := r.tracer.ClosedConnection(&local, &remote, ErrFinished); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.sel.Close(local, remote); err != nil {
+		return nil, err
+	}
+
+	if len(latencies) > 0 {
+		var sum time.Duration
+		for _, l := range latencies {
+			sum += l
+		}
+		report.MeanLatency = sum / time.Duration(len(latencies))
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		report.P95Latency = latencies[len(latencies)*95/100]
+	}
+	if r.opts.Duration > 0 {
+		report.Goodput = delivered / r.opts.Duration.Seconds()
+	}
+	return report, nil
+}
+
+// update applies the changes due at t. Paths crossing a failed link are
+// reported down, paths that recovered are handed out again with Refresh.
+func (r *run) update(t time.Duration) error {
+	changed := false
+	for len(r.changes) > 0 && r.changes[0].At <= t {
+		c := r.changes[0]
+		r.changes = r.changes[1:]
+		changed = changed || c.State.Down != r.links[c.Link].Down
+		r.links[c.Link] = c.State
+	}
+	if !changed {
+		return nil
+	}
+	local, remote := r.n.Local, r.n.Remote
+	recovered := false
+	for _, p := range r.n.Paths {
+		failed := r.failed(p)
+		switch {
+		case failed >= 0 && !r.down[p.Fingerprint]:
+			r.down[p.Fingerprint] = true
+			l := r.n.Links[failed]
+			if err := r.sel.PathDown(local, remote, p.Fingerprint, l.A); err != nil {
+				return err
+			}
+		case failed < 0 && r.down[p.Fingerprint]:
+			delete(r.down, p.Fingerprint)
+			recovered = true
+		}
+	}
+	if recovered {
+		return r.sel.Refresh(local, remote, r.available())
+	}
+	return nil
+}
+
+// failed returns the first link of p that is down, or -1
+func (r *run) failed(p *Path) int {
+	for _, l := range p.Links {
+		if r.links[l].Down {
+			return l
+		}
+	}
+	return -1
+}
+
+// available returns the paths that are currently up
+func (r *run) available() []*pan.Path {
+	var paths []*pan.Path
+	for _, p := range r.n.Paths {
+		if r.failed(p) < 0 {
+			paths = append(paths, p.Path)
+		}
+	}
+	return paths
+}
+
+// path returns the network path p refers to, if it is usable
+func (r *run) path(p *pan.Path) *Path {
+	if p == nil {
+		return nil
+	}
+	for _, np := range r.n.Paths {
+		if np.Fingerprint == p.Fingerprint {
+			if r.failed(np) >= 0 {
+				return nil
+			}
+			return np
+		}
+	}
+	return nil
+}
+
+// conditions returns the one-way delay, the bottleneck capacity and the
+// loss rate currently experienced on p
+func (r *run) conditions(p *Path) (time.Duration, uint64, float64) {
+	var delay time.Duration
+	capacity := ^uint64(0)
+	delivered := 1.0
+	for _, i := range p.Links {
+		s := r.links[i]
+		delay += s.Delay + r.jitter[i]
+		if s.Capacity < capacity {
+			capacity = s.Capacity
+		}
+		delivered *= 1 - s.Loss
+	}
+	return delay, capacity, 1 - delivered
+}
+
+// report hands the synthetic transport metrics of the last step to the
+// tracer, in the way the QUIC congestion controller would
+func (r *run) report(rtt time.Duration, rate float64, lost int) error {
+	if r.tracer == nil {
+		return nil
+	}
+	local, remote := r.n.Local, r.n.Remote
+	if r.rtt == nil {
+		r.rtt = &rpc.RTTStats{MinRTT: rtt, SmoothedRTT: rtt, MeanDeviation: rtt / 2}
+	}
+	dev := r.rtt.SmoothedRTT - rtt
+	if dev < 0 {
+		dev = -dev
+	}
+	r.rtt.LatestRTT = rtt
+	if rtt < r.rtt.MinRTT {
+		r.rtt.MinRTT = rtt
+	}
+	r.rtt.MeanDeviation = (3*r.rtt.MeanDeviation + dev) / 4
+	r.rtt.SmoothedRTT = (7*r.rtt.SmoothedRTT + rtt) / 8
+	r.rtt.PTO = r.rtt.SmoothedRTT + 4*r.rtt.MeanDeviation
+	stats := *r.rtt
+
+	// the window needed to sustain rate over rtt
+	cwnd := logging.ByteCount(rate * 1000 / 8 * rtt.Seconds())
+	packets := int(cwnd) / r.opts.PacketSize
+	if err := r.tracer.UpdatedMetrics(&local, &remote, &stats, cwnd, cwnd, packets); err != nil {
+		return err
+	}
+	for i := 0; i < lost; i++ {
+		r.pn++
+		if err := r.tracer.LostPacket(&local, &remote, logging.Encryption1RTT, r.pn, logging.PacketLossReorderingThreshold); err != nil {
+			return err
+		}
+	}
+	r.pn += logging.PacketNumber(packets)
+	return nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package sim
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// sticks to the first path it was given, even if it went down
+type firstPath struct {
+	paths []*pan.Path
+}
+
+func (s *firstPath) Initialize(_ map[string]string, _, _ pan.UDPAddr, paths []*pan.Path) error {
+	s.paths = paths
+	return nil
+}
+func (s *firstPath) SetPreferences(map[string]string, pan.UDPAddr, pan.UDPAddr) error { return nil }
+func (s *firstPath) Path(pan.UDPAddr, pan.UDPAddr) (*pan.Path, error)                 { return s.paths[0], nil }
+func (s *firstPath) PathDown(pan.UDPAddr, pan.UDPAddr, pan.PathFingerprint, pan.PathInterface) error {
+	return nil
+}
+func (s *firstPath) Refresh(pan.UDPAddr, pan.UDPAddr, []*pan.Path) error { return nil }
+func (s *firstPath) Close(pan.UDPAddr, pan.UDPAddr) error                { return nil }
+
+// avoids paths that went down
+const failoverScript = `
+local paths, down = {}, {}
+function panapi.Initialize(prefs, laddr, raddr, ps) paths = ps end
+function panapi.Refresh(laddr, raddr, ps) paths = ps; down = {} end
+function panapi.PathDown(laddr, raddr, fp, pi) down[fp] = true end
+function panapi.Path(laddr, raddr)
+	for _, p in ipairs(paths) do
+		if not down[p.Fingerprint] then return p end
+	end
+end
+function panapi.Close(laddr, raddr) end
+function panapi.Periodic(seconds) end
+
+lost = 0
+function stats.LostPacket(laddr, raddr) lost = lost + 1 end
+`
+
+// two disjoint paths, the first one fails between one and three seconds
+func testNetwork() *Network {
+	ia := pan.MustParseIA("1-ff00:0:110")
+	n := &Network{Local: pan.UDPAddr{IA: ia, Port: 1}, Remote: pan.UDPAddr{IA: ia, Port: 2}}
+	for i := 0; i < 2; i++ {
+		n.Links = append(n.Links, &Link{
+			A:    pan.PathInterface{IA: ia, IfID: pan.IfID(i + 1)},
+			Base: LinkState{Delay: time.Duration(i+1) * 10 * time.Millisecond, Capacity: 1e5},
+		})
+		n.Paths = append(n.Paths, &Path{
+			Path:  &pan.Path{Fingerprint: pan.PathFingerprint([]string{"a", "b"}[i])},
+			Links: []int{i},
+		})
+	}
+	down := n.Links[0].Base
+	down.Down = true
+	n.Changes = []Change{{At: time.Second, Link: 0, State: down}, {At: 3 * time.Second, Link: 0, State: n.Links[0].Base}}
+	return n
+}
+
+func TestRun(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "failover.lua")
+	if err := os.WriteFile(name, []byte(failoverScript), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first := Strategy{
+		Name: "first",
+		New: func(clock.Clock) (rpc.ServerSelector, rpc.ServerConnectionTracer, error) {
+			return &firstPath{}, nil, nil
+		},
+	}
+	opts := Options{Duration: 5 * time.Second, Step: 100 * time.Millisecond, Demand: 1e4}
+	reports, err := Compare(testNetwork(), opts, first, LuaStrategy(name))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r := reports[0]; r.Outage != 2*time.Second || r.Switches != 0 || r.MeanLatency != 10*time.Millisecond {
+		t.Errorf("unexpected report %s", r)
+	}
+	if r := reports[1]; r.Outage != 0 || r.Switches != 2 || r.Lost != 0 {
+		t.Errorf("unexpected report %s", r)
+	}
+	if reports[1].Goodput <= reports[0].Goodput {
+		t.Errorf("failover achieved %f Kbit/s, sticking to a path %f", reports[1].Goodput, reports[0].Goodput)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	cfg := DefaultConfig
+	a, b := Generate(cfg), Generate(cfg)
+	if !reflect.DeepEqual(a, b) {
+		t.Error("networks generated from the same seed differ")
+	}
+	if len(a.Paths) != cfg.Paths || len(a.Changes) != 2*(cfg.Failures+cfg.Congestions) {
+		t.Fatalf("got %d paths and %d changes", len(a.Paths), len(a.Changes))
+	}
+	for _, p := range a.Paths {
+		md := p.Metadata
+		if len(md.Latency) != len(md.Interfaces)-1 || len(md.Geo) != len(md.Interfaces) || len(p.Links) != len(md.Latency) {
+			t.Errorf("inconsistent metadata %+v", md)
+		}
+	}
+	for i := 1; i < len(a.Changes); i++ {
+		if a.Changes[i].At < a.Changes[i-1].At {
+			t.Fatal("changes not sorted")
+		}
+	}
+
+	reports, err := Compare(a, Options{Duration: time.Minute}, Strategy{
+		Name: "first",
+		New: func(clock.Clock) (rpc.ServerSelector, rpc.ServerConnectionTracer, error) {
+			return &firstPath{}, nil, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := reports[0]; r.MeanLatency == 0 || r.Goodput == 0 {
+		t.Errorf("unexpected report %s", r)
+	}
+}
+
+func TestEpisodesDoNotOverlap(t *testing.T) {
+	cfg := DefaultConfig
+	cfg.Paths, cfg.Failures, cfg.Congestions = 2, 20, 40
+	n := Generate(cfg)
+	if len(n.Changes) == 0 {
+		t.Fatal("no episodes")
+	}
+	down := map[int]bool{}
+	for _, c := range n.Changes {
+		disturbed := c.State != n.Links[c.Link].Base
+		if disturbed && down[c.Link] {
+			t.Fatalf("episode on link %d starts at %s during another", c.Link, c.At)
+		}
+		down[c.Link] = disturbed
+	}
+}
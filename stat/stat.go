@@ -0,0 +1,229 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+// Package stat provides the running statistics scripts keep on metrics, cheap
+// to update for every sample
+package stat
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+var (
+	ErrInvalidAlpha   = errors.New("alpha must be in (0, 1]")
+	ErrInvalidWindow  = errors.New("window must be positive")
+	ErrInvalidBuckets = errors.New("buckets must be ascending")
+)
+
+// EWMA is an exponentially weighted moving average
+type EWMA struct {
+	alpha float64
+	value float64
+	n     int
+}
+
+// NewEWMA returns an average that gives new samples the weight alpha
+func NewEWMA(alpha float64) (*EWMA, error) {
+	if !(alpha > 0 && alpha <= 1) {
+		return nil, ErrInvalidAlpha
+	}
+	return &EWMA{alpha: alpha}, nil
+}
+
+// Update adds v and returns the new average. The first sample is taken as
+// is.
+func (e *EWMA) Update(v float64) float64 {
+	if e.n == 0 {
+		e.value = v
+	} else {
+		e.value += e.alpha * (v - e.value)
+	}
+	e.n++
+	return e.value
+}
+
+// Value returns the average, false before the first sample
+func (e *EWMA) Value() (float64, bool) {
+	return e.value, e.n > 0
+}
+
+// Count returns the number of samples
+func (e *EWMA) Count() int {
+	return e.n
+}
+
+type sample struct {
+	t time.Time
+	v float64
+}
+
+// Window holds the samples of the last d under its clock
+type Window struct {
+	d       time.Duration
+	clock   clock.Clock
+	samples []sample
+}
+
+// NewWindow returns a window of length d, nil c meaning the wall clock
+func NewWindow(d time.Duration, c clock.Clock) (*Window, error) {
+	if d <= 0 {
+		return nil, ErrInvalidWindow
+	}
+	if c == nil {
+		c = clock.Real
+	}
+	return &Window{d: d, clock: c}, nil
+}
+
+// Add adds v at the current time
+func (w *Window) Add(v float64) {
+	w.samples = append(w.expire(), sample{w.clock.Now(), v})
+}
+
+// expire drops the samples that left the window, reusing the space once
+// half of it is unused
+func (w *Window) expire() []sample {
+	cutoff := w.clock.Now().Add(-w.d)
+	i := sort.Search(len(w.samples), func(i int) bool {
+		return w.samples[i].t.After(cutoff)
+	})
+	w.samples = w.samples[i:]
+	if len(w.samples) < cap(w.samples)/2 {
+		w.samples = append([]sample(nil), w.samples...)
+	}
+	return w.samples
+}
+
+// Count returns the number of samples in the window
+func (w *Window) Count() int {
+	return len(w.expire())
+}
+
+// Quantile returns the q-quantile of the samples in the window, the nearest
+// rank, false if the window is empty
+func (w *Window) Quantile(q float64) (float64, bool) {
+	samples := w.expire()
+	if len(samples) == 0 {
+		return 0, false
+	}
+	vs := make([]float64, len(samples))
+	for i, s := range samples {
+		vs[i] = s.v
+	}
+	sort.Float64s(vs)
+	i := int(math.Ceil(q*float64(len(vs)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(vs) {
+		i = len(vs) - 1
+	}
+	return vs[i], true
+}
+
+// Min returns the smallest sample in the window
+func (w *Window) Min() (float64, bool) {
+	return w.fold(math.Min)
+}
+
+// Max returns the largest sample in the window
+func (w *Window) Max() (float64, bool) {
+	return w.fold(math.Max)
+}
+
+// Mean returns the mean of the samples in the window
+func (w *Window) Mean() (float64, bool) {
+	sum, ok := w.fold(func(a, b float64) float64 { return a + b })
+	return sum / float64(len(w.samples)), ok
+}
+
+func (w *Window) fold(f func(a, b float64) float64) (float64, bool) {
+	samples := w.expire()
+	if len(samples) == 0 {
+		return 0, false
+	}
+	acc := samples[0].v
+	for _, s := range samples[1:] {
+		acc = f(acc, s.v)
+	}
+	return acc, true
+}
+
+// Histogram counts samples in buckets given by their upper bounds, plus one
+// for the samples above all of them
+type Histogram struct {
+	bounds []float64
+	counts []uint64
+	sum    float64
+	n      uint64
+}
+
+func NewHistogram(bounds []float64) (*Histogram, error) {
+	for i := 1; i < len(bounds); i++ {
+		if !(bounds[i] > bounds[i-1]) {
+			return nil, ErrInvalidBuckets
+		}
+	}
+	return &Histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}, nil
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	h.sum += v
+	h.n++
+}
+
+// Counts returns the number of samples in each bucket, the last one counting
+// those above all bounds
+func (h *Histogram) Counts() []uint64 {
+	return append([]uint64(nil), h.counts...)
+}
+
+func (h *Histogram) Count() uint64 {
+	return h.n
+}
+
+func (h *Histogram) Sum() float64 {
+	return h.sum
+}
+
+// Quantile returns the upper bound of the bucket holding the q-quantile, +Inf
+// if it lies above all bounds, false if there are no samples
+func (h *Histogram) Quantile(q float64) (float64, bool) {
+	if h.n == 0 {
+		return 0, false
+	}
+	rank := uint64(math.Ceil(q * float64(h.n)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen uint64
+	for i, c := range h.counts[:len(h.bounds)] {
+		seen += c
+		if seen >= rank {
+			return h.bounds[i], true
+		}
+	}
+	return math.Inf(1), true
+}
+
+// Reset forgets all samples
+func (h *Histogram) Reset() {
+	h.counts = make([]uint64, len(h.bounds)+1)
+	h.sum, h.n = 0, 0
+}
@@ -0,0 +1,99 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package stat
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/clock"
+)
+
+func TestEWMA(t *testing.T) {
+	e, err := NewEWMA(.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Value(); ok {
+		t.Error("Value() without samples")
+	}
+	for _, v := range []float64{4, 8, 0} {
+		e.Update(v)
+	}
+	if v, ok := e.Value(); !ok || v != 3 {
+		t.Errorf("Value() = %v, %v, want 3", v, ok)
+	}
+	if _, err := NewEWMA(0); err != ErrInvalidAlpha {
+		t.Errorf("NewEWMA(0) = %v, want %v", err, ErrInvalidAlpha)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	c := clock.NewManual(time.Unix(0, 0))
+	w, err := NewWindow(10*time.Second, c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 20; i++ {
+		w.Add(float64(i))
+		c.Advance(time.Second)
+	}
+	// 12 to 20 are left, 11 is exactly 10s old
+	check := func(name string, f func() (float64, bool), want float64) {
+		t.Helper()
+		if v, ok := f(); !ok || v != want {
+			t.Errorf("%s = %v, %v, want %v", name, v, ok, want)
+		}
+	}
+	check("Min()", w.Min, 12)
+	check("Max()", w.Max, 20)
+	check("Mean()", w.Mean, 16)
+	check("Quantile(.5)", func() (float64, bool) { return w.Quantile(.5) }, 16)
+	check("Quantile(.95)", func() (float64, bool) { return w.Quantile(.95) }, 20)
+	c.Advance(time.Minute)
+	if n := w.Count(); n != 0 {
+		t.Errorf("Count() a minute later = %d", n)
+	}
+	if _, ok := w.Min(); ok {
+		t.Error("Min() of an empty window")
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h, err := NewHistogram([]float64{1, 10, 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []float64{0.5, 1, 5, 50, 500} {
+		h.Observe(v)
+	}
+	counts := h.Counts()
+	if len(counts) != 4 || counts[0] != 2 || counts[1] != 1 || counts[2] != 1 || counts[3] != 1 {
+		t.Errorf("Counts() = %v", counts)
+	}
+	if q, _ := h.Quantile(.5); q != 10 {
+		t.Errorf("Quantile(.5) = %v, want 10", q)
+	}
+	if q, _ := h.Quantile(1); !math.IsInf(q, 1) {
+		t.Errorf("Quantile(1) = %v, want +Inf", q)
+	}
+	h.Reset()
+	if h.Count() != 0 || h.Sum() != 0 {
+		t.Errorf("Count(), Sum() after Reset() = %d, %v", h.Count(), h.Sum())
+	}
+	if _, err := NewHistogram([]float64{1, 1}); err != ErrInvalidBuckets {
+		t.Errorf("NewHistogram(1, 1) = %v, want %v", err, ErrInvalidBuckets)
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trace
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lucas-clemente/quic-go/logging"
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/logger"
+	"github.com/netsys-lab/pan-lua/rpc"
+	"go.uber.org/zap"
+)
+
+// Recorder writes the calls passing through its selector and connection
+// tracer to a trace. The events are rebuilt as the messages the RPC
+// client would have sent, frames of sent and received packets are not
+// recorded as they are not transmitted either.
+type Recorder struct {
+	w     *Writer
+	clock clock.Clock
+	l     *zap.SugaredLogger
+	once  sync.Once
+}
+
+// NewRecorder writes to w, with timestamps taken from c
+func NewRecorder(w *Writer, c clock.Clock) *Recorder {
+	return &Recorder{w: w, clock: c, l: logger.Default().Named("trace").Sugar()}
+}
+
+func (r *Recorder) record(method string, s *rpc.SelectorMsg, t *rpc.ConnectionTracerMsg) {
+	err := r.w.Write(&Event{Time: r.clock.Now(), Method: method, Selector: s, Tracer: t})
+	if err != nil {
+		r.once.Do(func() {
+			r.l.Errorw("recording stopped", "error", err)
+		})
+	}
+}
+
+type selector struct {
+	r        *Recorder
+	selector rpc.ServerSelector
+}
+
+// Selector records the calls to s and the paths it returns
+func (r *Recorder) Selector(s rpc.ServerSelector) rpc.ServerSelector {
+	return &selector{r, s}
+}
+
+func newPaths(paths []*pan.Path) []*rpc.Path {
+	ps := make([]*rpc.Path, len(paths))
+	for i, p := range paths {
+		ps[i] = rpc.NewPathFrom(p)
+	}
+	return ps
+}
+
+func (s *selector) Initialize(prefs map[string]string, local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.r.record("SelectorServer.Initialize", &rpc.SelectorMsg{
+		Local:       &local,
+		Remote:      &remote,
+		Preferences: prefs,
+		Paths:       newPaths(paths),
+	}, nil)
+	return s.selector.Initialize(prefs, local, remote, paths)
+}
+
+func (s *selector) SetPreferences(prefs map[string]string, local, remote pan.UDPAddr) error {
+	s.r.record("SelectorServer.SetPreferences", &rpc.SelectorMsg{
+		Local:       &local,
+		Remote:      &remote,
+		Preferences: prefs,
+	}, nil)
+	return s.selector.SetPreferences(prefs, local, remote)
+}
+
+func (s *selector) Path(local, remote pan.UDPAddr) (*pan.Path, error) {
+	p, err := s.selector.Path(local, remote)
+	msg := &rpc.SelectorMsg{Local: &local, Remote: &remote}
+	if p != nil {
+		fp := p.Fingerprint
+		msg.Fingerprint = &fp
+	}
+	s.r.record("SelectorServer.Path", msg, nil)
+	return p, err
+}
+
+func (s *selector) PathDown(local, remote pan.UDPAddr, fp pan.PathFingerprint, pi pan.PathInterface) error {
+	s.r.record("SelectorServer.PathDown", &rpc.SelectorMsg{
+		Local:         &local,
+		Remote:        &remote,
+		Fingerprint:   &fp,
+		PathInterface: &pi,
+	}, nil)
+	return s.selector.PathDown(local, remote, fp, pi)
+}
+
+func (s *selector) Refresh(local, remote pan.UDPAddr, paths []*pan.Path) error {
+	s.r.record("SelectorServer.Refresh", &rpc.SelectorMsg{
+		Local:  &local,
+		Remote: &remote,
+		Paths:  newPaths(paths),
+	}, nil)
+	return s.selector.Refresh(local, remote, paths)
+}
+
+func (s *selector) Close(local, remote pan.UDPAddr) error {
+	s.r.record("SelectorServer.Close", &rpc.SelectorMsg{Local: &local, Remote: &remote}, nil)
+	return s.selector.Close(local, remote)
+}
+
+type connectionTracer struct {
+	r  *Recorder
+	ct rpc.ServerConnectionTracer
+}
+
+// ConnectionTracer records the calls to ct
+func (r *Recorder) ConnectionTracer(ct rpc.ServerConnectionTracer) rpc.ServerConnectionTracer {
+	return &connectionTracer{r, ct}
+}
+
+func (t *connectionTracer) record(method string, msg *rpc.ConnectionTracerMsg) {
+	t.r.record("ConnectionTracerServer."+method, nil, msg)
+}
+
+func (t *connectionTracer) TracerForConnection(id uint64, p logging.Perspective, odcid logging.ConnectionID) error {
+	t.record("NewTracerForConnection", &rpc.ConnectionTracerMsg{TracingID: id, Perspective: p, OdcID: &odcid})
+	return t.ct.TracerForConnection(id, p, odcid)
+}
+
+func (t *connectionTracer) StartedConnection(local, remote *pan.UDPAddr, srcConnID, destConnID logging.ConnectionID) error {
+	t.record("StartedConnection", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, SrcConnID: &srcConnID, DestConnID: &destConnID})
+	return t.ct.StartedConnection(local, remote, srcConnID, destConnID)
+}
+
+func (t *connectionTracer) NegotiatedVersion(local, remote *pan.UDPAddr, chosen logging.VersionNumber, clientVersions, serverVersions []logging.VersionNumber) error {
+	t.record("NegotiatedVersion", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Chosen: chosen, ClientVersions: clientVersions, ServerVersions: serverVersions})
+	return t.ct.NegotiatedVersion(local, remote, chosen, clientVersions, serverVersions)
+}
+
+func (t *connectionTracer) ClosedConnection(local, remote *pan.UDPAddr, err error) error {
+	msg := &rpc.ConnectionTracerMsg{Local: local, Remote: remote}
+	if err != nil {
+		s := err.Error()
+		msg.ErrorMsg = &s
+	}
+	t.record("ClosedConnection", msg)
+	return t.ct.ClosedConnection(local, remote, err)
+}
+
+func (t *connectionTracer) SentTransportParameters(local, remote *pan.UDPAddr, parameters *logging.TransportParameters) error {
+	t.record("SentTransportParameters", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Parameters: parameters})
+	return t.ct.SentTransportParameters(local, remote, parameters)
+}
+
+func (t *connectionTracer) ReceivedTransportParameters(local, remote *pan.UDPAddr, parameters *logging.TransportParameters) error {
+	t.record("ReceivedTransportParameters", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Parameters: parameters})
+	return t.ct.ReceivedTransportParameters(local, remote, parameters)
+}
+
+func (t *connectionTracer) RestoredTransportParameters(local, remote *pan.UDPAddr, parameters *logging.TransportParameters) error {
+	t.record("RestoredTransportParameters", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Parameters: parameters})
+	return t.ct.RestoredTransportParameters(local, remote, parameters)
+}
+
+func (t *connectionTracer) SentPacket(local, remote *pan.UDPAddr, hdr *logging.ExtendedHeader, size logging.ByteCount, ack *logging.AckFrame, frames []logging.Frame) error {
+	t.record("SentPacket", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, ExtendedHeader: hdr, ByteCount: size, AckFrame: ack})
+	return t.ct.SentPacket(local, remote, hdr, size, ack, frames)
+}
+
+func (t *connectionTracer) ReceivedVersionNegotiationPacket(local, remote *pan.UDPAddr, hdr *logging.Header, versions []logging.VersionNumber) error {
+	t.record("ReceivedVersionNegotiationPacket", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Header: hdr, Versions: versions})
+	return t.ct.ReceivedVersionNegotiationPacket(local, remote, hdr, versions)
+}
+
+func (t *connectionTracer) ReceivedRetry(local, remote *pan.UDPAddr, hdr *logging.Header) error {
+	t.record("ReceivedRetry", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Header: hdr})
+	return t.ct.ReceivedRetry(local, remote, hdr)
+}
+
+func (t *connectionTracer) ReceivedPacket(local, remote *pan.UDPAddr, hdr *logging.ExtendedHeader, size logging.ByteCount, frames []logging.Frame) error {
+	t.record("ReceivedPacket", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, ExtendedHeader: hdr, ByteCount: size})
+	return t.ct.ReceivedPacket(local, remote, hdr, size, frames)
+}
+
+func (t *connectionTracer) BufferedPacket(local, remote *pan.UDPAddr, ptype logging.PacketType) error {
+	t.record("BufferedPacket", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, PacketType: ptype})
+	return t.ct.BufferedPacket(local, remote, ptype)
+}
+
+func (t *connectionTracer) DroppedPacket(local, remote *pan.UDPAddr, ptype logging.PacketType, size logging.ByteCount, reason logging.PacketDropReason) error {
+	t.record("DroppedPacket", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, PacketType: ptype, ByteCount: size, DropReason: reason})
+	return t.ct.DroppedPacket(local, remote, ptype, size, reason)
+}
+
+func (t *connectionTracer) UpdatedMetrics(local, remote *pan.UDPAddr, rttStats *rpc.RTTStats, cwnd, bytesInFlight logging.ByteCount, packetsInFlight int) error {
+	t.record("UpdatedMetrics", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, RTTStats: rttStats, Cwnd: cwnd, ByteCount: bytesInFlight, Packets: packetsInFlight})
+	return t.ct.UpdatedMetrics(local, remote, rttStats, cwnd, bytesInFlight, packetsInFlight)
+}
+
+func (t *connectionTracer) AcknowledgedPacket(local, remote *pan.UDPAddr, level logging.EncryptionLevel, num logging.PacketNumber) error {
+	t.record("AcknowledgedPacket", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, EncryptionLevel: level, PacketNumber: num})
+	return t.ct.AcknowledgedPacket(local, remote, level, num)
+}
+
+func (t *connectionTracer) LostPacket(local, remote *pan.UDPAddr, level logging.EncryptionLevel, num logging.PacketNumber, reason logging.PacketLossReason) error {
+	t.record("LostPacket", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, EncryptionLevel: level, PacketNumber: num, LossReason: reason})
+	return t.ct.LostPacket(local, remote, level, num, reason)
+}
+
+func (t *connectionTracer) UpdatedCongestionState(local, remote *pan.UDPAddr, state logging.CongestionState) error {
+	t.record("UpdatedCongestionState", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, CongestionState: state})
+	return t.ct.UpdatedCongestionState(local, remote, state)
+}
+
+func (t *connectionTracer) UpdatedPTOCount(local, remote *pan.UDPAddr, value uint32) error {
+	t.record("UpdatedPTOCount", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, PTOCount: value})
+	return t.ct.UpdatedPTOCount(local, remote, value)
+}
+
+func (t *connectionTracer) UpdatedKeyFromTLS(local, remote *pan.UDPAddr, level logging.EncryptionLevel, p logging.Perspective) error {
+	t.record("UpdatedKeyFromTLS", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, EncryptionLevel: level, Perspective: p})
+	return t.ct.UpdatedKeyFromTLS(local, remote, level, p)
+}
+
+func (t *connectionTracer) UpdatedKey(local, remote *pan.UDPAddr, generation logging.KeyPhase, rem bool) error {
+	t.record("UpdatedKey", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Generation: generation, Bool: rem})
+	return t.ct.UpdatedKey(local, remote, generation, rem)
+}
+
+func (t *connectionTracer) DroppedEncryptionLevel(local, remote *pan.UDPAddr, level logging.EncryptionLevel) error {
+	t.record("DroppedEncryptionLevel", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, EncryptionLevel: level})
+	return t.ct.DroppedEncryptionLevel(local, remote, level)
+}
+
+func (t *connectionTracer) DroppedKey(local, remote *pan.UDPAddr, generation logging.KeyPhase) error {
+	t.record("DroppedKey", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Generation: generation})
+	return t.ct.DroppedKey(local, remote, generation)
+}
+
+func (t *connectionTracer) SetLossTimer(local, remote *pan.UDPAddr, ttype logging.TimerType, level logging.EncryptionLevel, when time.Time) error {
+	t.record("SetLossTimer", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, TimerType: ttype, EncryptionLevel: level, Time: &when})
+	return t.ct.SetLossTimer(local, remote, ttype, level, when)
+}
+
+func (t *connectionTracer) LossTimerExpired(local, remote *pan.UDPAddr, ttype logging.TimerType, level logging.EncryptionLevel) error {
+	t.record("LossTimerExpired", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, TimerType: ttype, EncryptionLevel: level})
+	return t.ct.LossTimerExpired(local, remote, ttype, level)
+}
+
+func (t *connectionTracer) LossTimerCanceled(local, remote *pan.UDPAddr) error {
+	t.record("LossTimerCanceled", &rpc.ConnectionTracerMsg{Local: local, Remote: remote})
+	return t.ct.LossTimerCanceled(local, remote)
+}
+
+func (t *connectionTracer) Close(local, remote *pan.UDPAddr) error {
+	t.record("Close", &rpc.ConnectionTracerMsg{Local: local, Remote: remote})
+	return t.ct.Close(local, remote)
+}
+
+func (t *connectionTracer) Debug(local, remote *pan.UDPAddr, name, msg string) error {
+	t.record("Debug", &rpc.ConnectionTracerMsg{Local: local, Remote: remote, Key: &name, Value: &msg})
+	return t.ct.Debug(local, remote, name, msg)
+}
@@ -0,0 +1,108 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trace
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+// Difference is a path decision of the replayed selector that differs from
+// the recorded one
+type Difference struct {
+	Event              *Event
+	Recorded, Replayed *pan.PathFingerprint
+}
+
+func fingerprintString(fp *pan.PathFingerprint) string {
+	if fp == nil {
+		return "<none>"
+	}
+	return string(*fp)
+}
+
+func (d *Difference) String() string {
+	return fmt.Sprintf("%s %s -> %s: recorded %s, replayed %s",
+		d.Event.Time.Format("15:04:05.000000"), d.Event.Selector.Local, d.Event.Selector.Remote,
+		fingerprintString(d.Recorded), fingerprintString(d.Replayed))
+}
+
+// Replayer feeds recorded events into a selector and connection tracer
+type Replayer struct {
+	servers map[string]reflect.Value
+	clock   *clock.Manual
+}
+
+// NewReplayer replays events into selector and tracer, setting c to the time
+// of each event before it is replayed. The clock may be nil.
+func NewReplayer(selector rpc.ServerSelector, tracer rpc.ServerConnectionTracer, c *clock.Manual) *Replayer {
+	return &Replayer{
+		servers: map[string]reflect.Value{
+			"SelectorServer":         reflect.ValueOf(rpc.NewSelectorServer(selector)),
+			"ConnectionTracerServer": reflect.ValueOf(rpc.NewConnectionTracerServer(tracer)),
+		},
+		clock: c,
+	}
+}
+
+// Replay invokes the RPC method of e. For Path calls, it returns the
+// difference between the recorded and the replayed decision, if any.
+func (r *Replayer) Replay(e *Event) (*Difference, error) {
+	if r.clock != nil {
+		r.clock.Set(e.Time)
+	}
+	i := strings.Index(e.Method, ".")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid method %q", e.Method)
+	}
+	server, ok := r.servers[e.Method[:i]]
+	if !ok {
+		return nil, fmt.Errorf("unknown service in %q", e.Method)
+	}
+	m := server.MethodByName(e.Method[i+1:])
+	if !m.IsValid() {
+		return nil, fmt.Errorf("unknown method %q", e.Method)
+	}
+
+	var args, resp reflect.Value
+	switch {
+	case e.Selector != nil:
+		args, resp = reflect.ValueOf(e.Selector), reflect.ValueOf(&rpc.SelectorMsg{})
+	case e.Tracer != nil:
+		args, resp = reflect.ValueOf(e.Tracer), reflect.ValueOf(&rpc.NilMsg{})
+	default:
+		return nil, fmt.Errorf("%s: event without message", e.Method)
+	}
+	if m.Type().NumIn() != 2 || m.Type().In(0) != args.Type() || m.Type().In(1) != resp.Type() {
+		return nil, fmt.Errorf("%s: message does not match method", e.Method)
+	}
+	if err, _ := m.Call([]reflect.Value{args, resp})[0].Interface().(error); err != nil {
+		return nil, fmt.Errorf("%s: %w", e.Method, err)
+	}
+
+	if e.Method != "SelectorServer.Path" {
+		return nil, nil
+	}
+	replayed := resp.Interface().(*rpc.SelectorMsg).Fingerprint
+	recorded := e.Selector.Fingerprint
+	if (recorded == nil) != (replayed == nil) || (recorded != nil && *recorded != *replayed) {
+		return &Difference{e, recorded, replayed}, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,119 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trace
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/clock"
+	"github.com/netsys-lab/pan-lua/lua"
+)
+
+// switches to the second path after two seconds
+const recordedScript = `
+local paths, start
+function panapi.Initialize(prefs, laddr, raddr, ps) paths = ps; start = panapi.Now() end
+function panapi.Path(laddr, raddr)
+	if panapi.Now() - start >= 2e6 then return paths[2] end
+	return paths[1]
+end
+function panapi.Periodic(seconds) end
+`
+
+// switches after one second, and only on Periodic
+const candidateScript = `
+local paths, elapsed = nil, 0
+function panapi.Initialize(prefs, laddr, raddr, ps) paths = ps end
+function panapi.Path(laddr, raddr)
+	if elapsed >= 1 then return paths[2] end
+	return paths[1]
+end
+function panapi.Periodic(seconds) elapsed = elapsed + seconds end
+`
+
+func TestReplay(t *testing.T) {
+	start := time.Unix(1000, 0)
+	local := pan.UDPAddr{Port: 1}
+	remote := pan.UDPAddr{IA: pan.MustParseIA("1-ff00:0:110"), Port: 2}
+	paths := []*pan.Path{{Fingerprint: "a"}, {Fingerprint: "b"}}
+
+	// record
+	name := filepath.Join(t.TempDir(), "trace")
+	w, err := Create(name, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := clock.NewManual(start)
+	state := lua.NewState()
+	sel := NewRecorder(w, c).Selector(lua.NewSelector(state, c))
+	loadScript(t, state, recordedScript)
+	if err := sel.Initialize(nil, local, remote, paths); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 6; i++ {
+		if _, err := sel.Path(local, remote); err != nil {
+			t.Fatal(err)
+		}
+		c.Advance(500 * time.Millisecond)
+	}
+	w.Close()
+
+	events, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 7 {
+		t.Fatalf("recorded %d events, want 7", len(events))
+	}
+
+	// replay the candidate, the recorded Path calls happened at 0s, 0.5s,
+	// ..., 2.5s, Periodic runs every second
+	c = clock.NewManual(events[0].Time)
+	state = lua.NewState()
+	r := NewReplayer(lua.NewSelector(state, c), lua.NewStats(state, c), c)
+	loadScript(t, state, candidateScript)
+	var differences []*Difference
+	for _, e := range events {
+		d, err := r.Replay(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d != nil {
+			differences = append(differences, d)
+		}
+	}
+	if len(differences) != 2 {
+		t.Fatalf("got %d differences, want 2: %v", len(differences), differences)
+	}
+	for i, want := range []time.Duration{time.Second, 1500 * time.Millisecond} {
+		d := differences[i]
+		if at := d.Event.Time.Sub(start); at != want || *d.Recorded != "a" || *d.Replayed != "b" {
+			t.Errorf("unexpected difference at %s: %s", at, d)
+		}
+	}
+}
+
+func loadScript(t *testing.T, state *lua.State, script string) {
+	name := filepath.Join(t.TempDir(), "script.lua")
+	if err := os.WriteFile(name, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.LoadScript(name); err != nil {
+		t.Fatal(err)
+	}
+}
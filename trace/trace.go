@@ -0,0 +1,125 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package trace records the RPC events handled by the daemon to trace files
+// and reads them back.
+//
+// A trace file starts with the 8 byte magic "PANTRACE" and a version byte,
+// followed by a gob stream of Events. Each file is a stream of its own, so
+// rotated files can be decoded independently.
+package trace
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+const (
+	Magic   = "PANTRACE"
+	Version = 1
+)
+
+var (
+	ErrNotATrace          = errors.New("not a trace file")
+	ErrUnsupportedVersion = errors.New("unsupported trace version")
+)
+
+// Event is a single recorded RPC call. Method is the RPC method name (e.g.
+// "SelectorServer.Initialize"), exactly one of Selector and Tracer is set.
+// For SelectorServer.Path, the Fingerprint of Selector is the path that was
+// returned, nil if there was none.
+type Event struct {
+	Time     time.Time
+	Method   string
+	Selector *rpc.SelectorMsg
+	Tracer   *rpc.ConnectionTracerMsg
+}
+
+func (e *Event) String() string {
+	return fmt.Sprintf("%s %s", e.Time.Format(time.RFC3339Nano), e.Method)
+}
+
+func writeHeader(w io.Writer) error {
+	_, err := w.Write(append([]byte(Magic), Version))
+	return err
+}
+
+type Reader struct {
+	dec *gob.Decoder
+}
+
+// NewReader checks the header of the trace read from r
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	header := make([]byte, len(Magic)+1)
+	if _, err := io.ReadFull(br, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrNotATrace
+		}
+		return nil, err
+	}
+	if string(header[:len(Magic)]) != Magic {
+		return nil, ErrNotATrace
+	}
+	if v := header[len(Magic)]; v != Version {
+		return nil, fmt.Errorf("%w %d", ErrUnsupportedVersion, v)
+	}
+	return &Reader{gob.NewDecoder(br)}, nil
+}
+
+// Next returns the next event, or io.EOF at the end of the trace. A
+// truncated last event, as left behind by a crashed daemon, counts as the
+// end of the trace.
+func (r *Reader) Next() (*Event, error) {
+	var e Event
+	err := r.dec.Decode(&e)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// ReadFile returns all events of the trace file name
+func ReadFile(name string) ([]*Event, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r, err := NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	var events []*Event
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			return events, nil
+		}
+		if err != nil {
+			return events, fmt.Errorf("%s: %w", name, err)
+		}
+		events = append(events, e)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/netsec-ethz/scion-apps/pkg/pan"
+	"github.com/netsys-lab/pan-lua/rpc"
+)
+
+func TestWriterRotation(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "daemon.trace")
+	w, err := Create(name, 4096, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	local := pan.UDPAddr{Port: 1}
+	remote := pan.UDPAddr{IA: pan.MustParseIA("1-ff00:0:110"), Port: 2}
+	const n = 100
+	for i := 0; i < n; i++ {
+		fp := pan.PathFingerprint(string(rune('a' + i%26)))
+		err := w.Write(&Event{
+			Time:     time.Unix(int64(i), 0),
+			Method:   "SelectorServer.Path",
+			Selector: &rpc.SelectorMsg{Local: &local, Remote: &remote, Fingerprint: &fp},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the files hold consecutive events and decode on their own
+	var events []*Event
+	for _, f := range []string{name + ".3", name + ".2", name + ".1", name} {
+		if info, err := os.Stat(f); err != nil {
+			t.Fatal(err)
+		} else if info.Size() > 4096 {
+			t.Errorf("%s has %d bytes", f, info.Size())
+		}
+		es, err := ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, es...)
+	}
+	if len(events) == 0 || len(events) >= n {
+		t.Fatalf("expected the oldest events to be dropped, got %d", len(events))
+	}
+	first := events[0].Time.Unix()
+	for i, e := range events {
+		if e.Time.Unix() != first+int64(i) || *e.Selector.Remote != remote {
+			t.Fatalf("event %d: %s", i, e)
+		}
+	}
+	if last := events[len(events)-1].Time.Unix(); last != n-1 {
+		t.Errorf("last event at %d, want %d", last, n-1)
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "daemon.trace")
+	w, err := Create(name, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		w.Write(&Event{Time: time.Now(), Method: "ConnectionTracerServer.Close", Tracer: &rpc.ConnectionTracerMsg{}})
+	}
+	w.Close()
+
+	b, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(name, b[:len(b)-3], 0644)
+	events, err := ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Errorf("got %d events, want 2", len(events))
+	}
+
+	if _, err := NewReader(bytes.NewReader([]byte("PANTRACE\x63"))); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("expected ErrUnsupportedVersion, got %v", err)
+	}
+	if _, err := NewReader(bytes.NewReader([]byte("#!/usr/bin/lua"))); err != ErrNotATrace {
+		t.Errorf("expected ErrNotATrace, got %v", err)
+	}
+}
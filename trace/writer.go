@@ -0,0 +1,158 @@
+// Copyright 2022 Thorben Krüger (thorben.krueger@ovgu.de)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package trace
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// flushInterval bounds how long recorded events stay in memory
+const flushInterval = time.Second
+
+// Writer appends events to a trace file. Once the file grows beyond maxSize
+// it is moved aside to name.1, older files are shifted to name.2 and so on.
+type Writer struct {
+	mu       sync.Mutex
+	name     string
+	maxSize  int64
+	maxFiles int
+
+	f    *os.File
+	w    *bufio.Writer
+	buf  bytes.Buffer
+	enc  *gob.Encoder
+	size int64
+	done chan struct{}
+	err  error
+}
+
+// Create starts a new trace file name, an existing file is rotated first so
+// that each file holds a single stream. A maxSize of 0 disables rotation.
+func Create(name string, maxSize int64, maxFiles int) (*Writer, error) {
+	w := &Writer{name: name, maxSize: maxSize, maxFiles: maxFiles, done: make(chan struct{})}
+	if info, err := os.Stat(name); err == nil && info.Size() > 0 {
+		if err := w.shift(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	go w.flusher()
+	return w, nil
+}
+
+func (w *Writer) open() error {
+	f, err := os.OpenFile(w.name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	w.f = f
+	w.w = bufio.NewWriter(f)
+	w.buf.Reset()
+	w.enc = gob.NewEncoder(&w.buf)
+	w.size = int64(len(Magic) + 1)
+	return writeHeader(w.w)
+}
+
+// shift moves the current file aside, dropping the oldest one
+func (w *Writer) shift() error {
+	if w.maxFiles <= 0 {
+		return os.Remove(w.name)
+	}
+	for i := w.maxFiles - 1; i > 0; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.name, i), fmt.Sprintf("%s.%d", w.name, i+1))
+	}
+	return os.Rename(w.name, w.name+".1")
+}
+
+func (w *Writer) rotate() error {
+	if err := w.w.Flush(); err != nil {
+		return err
+	}
+	if err := w.f.Close(); err != nil {
+		return err
+	}
+	if err := w.shift(); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+// Write appends e to the trace. After the first error, all further writes
+// fail with that error.
+func (w *Writer) Write(e *Event) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.write(e)
+	return w.err
+}
+
+func (w *Writer) write(e *Event) error {
+	w.buf.Reset()
+	if err := w.enc.Encode(e); err != nil {
+		return err
+	}
+	empty := w.size == int64(len(Magic)+1)
+	if w.maxSize > 0 && !empty && w.size+int64(w.buf.Len()) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+		// the new stream needs the type information again
+		if err := w.enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	n, err := w.w.Write(w.buf.Bytes())
+	w.size += int64(n)
+	return err
+}
+
+func (w *Writer) flusher() {
+	t := time.NewTicker(flushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.mu.Lock()
+			if w.err == nil {
+				w.err = w.w.Flush()
+			}
+			w.mu.Unlock()
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// Close flushes and closes the trace file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	close(w.done)
+	err := w.w.Flush()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}